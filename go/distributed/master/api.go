@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yourusername/distributed/pkg/utils"
+	pb "github.com/yourusername/distributed/proto"
+)
+
+const (
+	// maxWaitTimeout caps how long a single WaitForResult call blocks.
+	// Clients that need to wait longer call it again.
+	maxWaitTimeout = 60 * time.Second
+)
+
+// SubmitTask handles task submissions from clients
+func (m *Master) SubmitTask(ctx context.Context, req *pb.SubmitTaskRequest) (*pb.SubmitTaskResponse, error) {
+	if req.TaskType == "" {
+		return &pb.SubmitTaskResponse{
+			Success: false,
+			Message: "Task type is required",
+		}, nil
+	}
+
+	task := &utils.Task{
+		ID:        utils.GenerateUniqueID("task"),
+		Type:      req.TaskType,
+		Payload:   req.Payload,
+		CreatedAt: time.Now(),
+		State:     utils.TaskPending,
+	}
+
+	m.tasksMutex.Lock()
+	m.tasks[task.ID] = task
+	m.saveTask(task)
+	m.tasksMutex.Unlock()
+	m.signalDispatch()
+
+	log.Printf("Task %s of type %s submitted", task.ID, task.Type)
+	return &pb.SubmitTaskResponse{
+		TaskId:  task.ID,
+		Success: true,
+		Message: "Task submitted",
+	}, nil
+}
+
+// GetTaskStatus handles task status lookups
+func (m *Master) GetTaskStatus(ctx context.Context, req *pb.TaskStatusRequest) (*pb.TaskStatus, error) {
+	return m.taskStatus(req.TaskId), nil
+}
+
+// WaitForResult handles requests to wait for a task to finish. It returns
+// the status of the task once it finished, or its current status when the
+// timeout passes first.
+func (m *Master) WaitForResult(ctx context.Context, req *pb.WaitForResultRequest) (*pb.TaskStatus, error) {
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 || timeout > maxWaitTimeout {
+		timeout = maxWaitTimeout
+	}
+
+	// Holding tasksMutex keeps finishTask from running between the check
+	// and the registration of the waiter. A task that is not unfinished is
+	// either finished or unknown, and needs no waiting.
+	m.tasksMutex.RLock()
+	if _, exists := m.tasks[req.TaskId]; !exists {
+		m.tasksMutex.RUnlock()
+		return m.taskStatus(req.TaskId), nil
+	}
+	waiter := make(chan struct{})
+	m.resultsMutex.Lock()
+	m.waiters[req.TaskId] = append(m.waiters[req.TaskId], waiter)
+	m.resultsMutex.Unlock()
+	m.tasksMutex.RUnlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-waiter:
+	case <-timer.C:
+		m.removeWaiter(req.TaskId, waiter)
+	case <-ctx.Done():
+		m.removeWaiter(req.TaskId, waiter)
+		return nil, ctx.Err()
+	}
+
+	return m.taskStatus(req.TaskId), nil
+}
+
+// removeWaiter unregisters a WaitForResult call that stopped waiting
+func (m *Master) removeWaiter(taskID string, waiter chan struct{}) {
+	m.resultsMutex.Lock()
+	defer m.resultsMutex.Unlock()
+
+	waiters := m.waiters[taskID]
+	for i, w := range waiters {
+		if w == waiter {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(m.waiters, taskID)
+	} else {
+		m.waiters[taskID] = waiters
+	}
+}
+
+// CancelTask handles task cancellations from clients. The slave running the
+// task, if any, is asked to stop it.
+func (m *Master) CancelTask(ctx context.Context, req *pb.CancelTaskRequest) (*pb.CancelTaskResponse, error) {
+	taskID := req.TaskId
+
+	m.tasksMutex.Lock()
+	task, exists := m.tasks[taskID]
+	if !exists {
+		m.tasksMutex.Unlock()
+
+		message := fmt.Sprintf("Task %s not found", taskID)
+		m.resultsMutex.RLock()
+		if _, done := m.results[taskID]; done {
+			message = fmt.Sprintf("Task %s already finished", taskID)
+		}
+		m.resultsMutex.RUnlock()
+
+		return &pb.CancelTaskResponse{
+			TaskId:  taskID,
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	slaveID := task.AssignedTo
+	m.finishTask(&utils.TaskResult{
+		TaskID:         taskID,
+		Success:        false,
+		ErrorMessage:   "task cancelled",
+		CompletionTime: time.Now(),
+		State:          utils.TaskCancelled,
+	})
+	m.tasksMutex.Unlock()
+
+	if slaveID != 0 {
+		m.releaseSlave(slaveID)
+		go m.cancelOnSlave(slaveID, taskID)
+	}
+
+	log.Printf("Task %s cancelled", taskID)
+	return &pb.CancelTaskResponse{
+		TaskId:  taskID,
+		Success: true,
+		Message: "Task cancelled",
+	}, nil
+}
+
+// cancelOnSlave asks a slave to stop a task. The task is already finished
+// on the master, so a failure only means the slave keeps running it to no
+// purpose until its deadline.
+func (m *Master) cancelOnSlave(slaveID int32, taskID string) {
+	m.slavesMutex.RLock()
+	slave, exists := m.slaves[slaveID]
+	m.slavesMutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := slave.Client.CancelTask(ctx, &pb.CancelTaskRequest{TaskId: taskID, Term: m.term.Load()})
+	if err != nil {
+		log.Printf("Failed to cancel task %s on slave %d: %v", taskID, slaveID, err)
+		return
+	}
+	if !resp.Success {
+		log.Printf("Slave %d did not cancel task %s: %s", slaveID, taskID, resp.Message)
+	}
+}
+
+// taskStatus looks a task up among the unfinished and the finished tasks.
+// Holding tasksMutex across both lookups keeps finishTask from moving the
+// task from one to the other in between.
+func (m *Master) taskStatus(taskID string) *pb.TaskStatus {
+	m.tasksMutex.RLock()
+	defer m.tasksMutex.RUnlock()
+
+	if task, exists := m.tasks[taskID]; exists {
+		return &pb.TaskStatus{
+			TaskId:   taskID,
+			Found:    true,
+			State:    protoTaskState(taskState(task)),
+			TaskType: task.Type,
+			SlaveId:  task.AssignedTo,
+			Attempts: int32(task.Attempts),
+		}
+	}
+
+	m.resultsMutex.RLock()
+	result, done := m.results[taskID]
+	m.resultsMutex.RUnlock()
+
+	if !done {
+		return &pb.TaskStatus{
+			TaskId: taskID,
+			Found:  false,
+		}
+	}
+	return &pb.TaskStatus{
+		TaskId:         taskID,
+		Found:          true,
+		State:          protoTaskState(resultState(result)),
+		Result:         result.Result,
+		ErrorMessage:   result.ErrorMessage,
+		CompletionTime: result.CompletionTime.Unix(),
+	}
+}
+
+// taskState returns the state of an unfinished task. Tasks saved before
+// states were tracked have none.
+func taskState(task *utils.Task) utils.TaskState {
+	switch {
+	case task.State != "":
+		return task.State
+	case task.AssignedTo != 0:
+		return utils.TaskAssigned
+	default:
+		return utils.TaskPending
+	}
+}
+
+// resultState returns the state of a finished task. Results saved before
+// states were tracked have none.
+func resultState(result *utils.TaskResult) utils.TaskState {
+	switch {
+	case result.State != "":
+		return result.State
+	case result.Success:
+		return utils.TaskSucceeded
+	default:
+		return utils.TaskFailed
+	}
+}
+
+// protoTaskState converts a task state to its protobuf enum value
+func protoTaskState(state utils.TaskState) pb.TaskState {
+	switch state {
+	case utils.TaskPending:
+		return pb.TaskState_TASK_STATE_PENDING
+	case utils.TaskAssigned:
+		return pb.TaskState_TASK_STATE_ASSIGNED
+	case utils.TaskRunning:
+		return pb.TaskState_TASK_STATE_RUNNING
+	case utils.TaskSucceeded:
+		return pb.TaskState_TASK_STATE_SUCCEEDED
+	case utils.TaskFailed:
+		return pb.TaskState_TASK_STATE_FAILED
+	case utils.TaskCancelled:
+		return pb.TaskState_TASK_STATE_CANCELLED
+	}
+	return pb.TaskState_TASK_STATE_UNSPECIFIED
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yourusername/distributed/pkg/utils"
+	pb "github.com/yourusername/distributed/proto"
+)
+
+func TestSubmitTaskRequiresType(t *testing.T) {
+	m, _ := newTestMaster(t)
+
+	resp, err := m.SubmitTask(context.Background(), &pb.SubmitTaskRequest{})
+	if err != nil || resp.Success {
+		t.Errorf("Task without a type was accepted: %v %v", resp, err)
+	}
+
+	taskID := submitTestTask(t, m, "echo")
+	status, err := m.GetTaskStatus(context.Background(), &pb.TaskStatusRequest{TaskId: taskID})
+	if err != nil || !status.Found || status.State != pb.TaskState_TASK_STATE_PENDING || status.TaskType != "echo" {
+		t.Errorf("Expected a pending echo task, got %v %v", status, err)
+	}
+	if status, _ := m.GetTaskStatus(context.Background(), &pb.TaskStatusRequest{TaskId: "unknown"}); status.Found {
+		t.Errorf("Unknown task was found: %v", status)
+	}
+}
+
+func TestTaskStatusDuringCompletion(t *testing.T) {
+	m, _ := newTestMaster(t)
+
+	const numTasks = 200
+	m.tasksMutex.Lock()
+	for i := 0; i < numTasks; i++ {
+		taskID := fmt.Sprintf("task-%d", i)
+		m.tasks[taskID] = &utils.Task{ID: taskID, Type: "echo", State: utils.TaskRunning, AssignedTo: 1, Attempts: 1}
+	}
+	m.tasksMutex.Unlock()
+
+	// A task moving from the unfinished to the finished tasks is always
+	// found in one of them
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < numTasks; i++ {
+			m.tasksMutex.Lock()
+			m.finishTask(&utils.TaskResult{TaskID: fmt.Sprintf("task-%d", i), Success: true, CompletionTime: time.Now()})
+			m.tasksMutex.Unlock()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < numTasks; i++ {
+			taskID := fmt.Sprintf("task-%d", i)
+			for {
+				status := m.taskStatus(taskID)
+				if !status.Found {
+					t.Errorf("Task %s was not found while it finished", taskID)
+					return
+				}
+				if status.State == pb.TaskState_TASK_STATE_SUCCEEDED {
+					break
+				}
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestWaitForResultTimeout(t *testing.T) {
+	m, _ := newTestMaster(t)
+	taskID := submitTestTask(t, m, "echo")
+
+	start := time.Now()
+	status, err := m.WaitForResult(context.Background(), &pb.WaitForResultRequest{TaskId: taskID, TimeoutMs: 50})
+	if err != nil {
+		t.Fatalf("WaitForResult: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("WaitForResult returned after %v, before its timeout", elapsed)
+	}
+	if status.State != pb.TaskState_TASK_STATE_PENDING {
+		t.Errorf("Expected the current, pending status, got %v", status)
+	}
+
+	m.resultsMutex.RLock()
+	waiters := len(m.waiters[taskID])
+	m.resultsMutex.RUnlock()
+	if waiters != 0 {
+		t.Errorf("A waiter that timed out is still registered")
+	}
+}
+
+func TestWaitForResultWakesUp(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+	dispatch(t, m, conn)
+
+	const numWaiters = 3
+	statuses := make(chan *pb.TaskStatus, numWaiters)
+	for i := 0; i < numWaiters; i++ {
+		go func() {
+			status, err := m.WaitForResult(context.Background(), &pb.WaitForResultRequest{TaskId: taskID, TimeoutMs: 10000})
+			if err != nil {
+				t.Errorf("WaitForResult: %v", err)
+			}
+			statuses <- status
+		}()
+	}
+	waitFor(t, "the waiters to register", func() bool {
+		m.resultsMutex.RLock()
+		defer m.resultsMutex.RUnlock()
+		return len(m.waiters[taskID]) == numWaiters
+	})
+
+	completeTask(m, &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true, Result: []byte("done")})
+	for i := 0; i < numWaiters; i++ {
+		select {
+		case status := <-statuses:
+			if status.State != pb.TaskState_TASK_STATE_SUCCEEDED || string(status.Result) != "done" {
+				t.Errorf("Expected the result, got %v", status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("WaitForResult did not wake up when the task finished")
+		}
+	}
+
+	// A finished task is answered right away
+	status, err := m.WaitForResult(context.Background(), &pb.WaitForResultRequest{TaskId: taskID})
+	if err != nil || status.State != pb.TaskState_TASK_STATE_SUCCEEDED {
+		t.Errorf("Expected the result of the finished task, got %v %v", status, err)
+	}
+}
+
+func TestWaitForResultCancelledContext(t *testing.T) {
+	m, _ := newTestMaster(t)
+	taskID := submitTestTask(t, m, "echo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := m.WaitForResult(ctx, &pb.WaitForResultRequest{TaskId: taskID}); err == nil {
+		t.Error("WaitForResult ignored the end of its context")
+	}
+}
+
+func TestCancelPendingTask(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+
+	resp, err := m.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: taskID})
+	if err != nil || !resp.Success {
+		t.Fatalf("CancelTask failed: %v %v", resp, err)
+	}
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_CANCELLED {
+		t.Errorf("Expected the task to be cancelled, got %v", status)
+	}
+	if m.dispatchNext() {
+		t.Error("A cancelled task was dispatched")
+	}
+	select {
+	case taskID := <-conn.cancelled:
+		t.Errorf("Slave was asked to cancel task %s it never got", taskID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCancelAssignedTask(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+	dispatch(t, m, conn)
+
+	resp, err := m.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: taskID})
+	if err != nil || !resp.Success {
+		t.Fatalf("CancelTask failed: %v %v", resp, err)
+	}
+	select {
+	case cancelled := <-conn.cancelled:
+		if cancelled != taskID {
+			t.Errorf("Slave was asked to cancel %s instead of %s", cancelled, taskID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The slave running the task was not asked to stop it")
+	}
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_CANCELLED {
+		t.Errorf("Expected the task to be cancelled, got %v", status)
+	}
+
+	// The slave's late report of the stopped task changes nothing
+	ack := completeTask(m, &pb.TaskResult{
+		TaskId:  taskID,
+		SlaveId: 1,
+		Status:  pb.ResultStatus_RESULT_STATUS_CANCELLED,
+	})
+	if ack.Received {
+		t.Error("Result for a cancelled task was accepted")
+	}
+}
+
+func TestCancelFinishedTask(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+	dispatch(t, m, conn)
+	completeTask(m, &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true})
+
+	resp, err := m.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: taskID})
+	if err != nil || resp.Success || resp.Message != "Task "+taskID+" already finished" {
+		t.Errorf("Expected CancelTask to refuse a finished task, got %v %v", resp, err)
+	}
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_SUCCEEDED {
+		t.Errorf("Cancelling changed the result of a finished task: %v", status)
+	}
+
+	resp, _ = m.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: "unknown"})
+	if resp.Success || resp.Message != "Task unknown not found" {
+		t.Errorf("Expected CancelTask to report an unknown task, got %v", resp)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/yourusername/distributed/pkg/auth"
+	"github.com/yourusername/distributed/pkg/election"
+	"github.com/yourusername/distributed/pkg/scheduler"
+	"github.com/yourusername/distributed/pkg/store"
+	pb "github.com/yourusername/distributed/proto"
+)
+
+const (
+	defaultElectionTTL = 5 * time.Second
+
+	// replicationBuffer is how many changes a follower may lag behind
+	// before the leader drops it and it has to start over from a snapshot
+	replicationBuffer = 1024
+
+	// followRetryDelay is how long a follower waits before it connects to
+	// the leader again
+	followRetryDelay = 1 * time.Second
+)
+
+// isLeader reports whether the master serves slaves and clients. A master
+// that runs without leader election always does.
+func (m *Master) isLeader() bool {
+	return m.elector == nil || m.leading.Load()
+}
+
+// checkLeader rejects calls to a master that does not lead, except for
+// GetLeader, and tells the caller which master does
+func (m *Master) checkLeader(method string) error {
+	if m.isLeader() || method == pb.DistributedSystem_GetLeader_FullMethodName {
+		return nil
+	}
+
+	lease, err := m.elector.Leader()
+	if err == nil && lease.Valid(time.Now()) && lease.Holder != m.config.NodeID {
+		return status.Errorf(codes.FailedPrecondition,
+			"not the leader, master %s at %s leads", lease.Holder, lease.Address)
+	}
+	return status.Error(codes.Unavailable, "no leader elected yet")
+}
+
+func (m *Master) leaderUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := m.checkLeader(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (m *Master) leaderStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := m.checkLeader(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// GetLeader tells which master leads
+func (m *Master) GetLeader(ctx context.Context, req *pb.LeaderRequest) (*pb.LeaderInfo, error) {
+	if m.elector == nil {
+		return &pb.LeaderInfo{Known: true}, nil
+	}
+
+	lease, err := m.elector.Leader()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to read the leader lease: %v", err)
+	}
+	if !lease.Valid(time.Now()) {
+		return &pb.LeaderInfo{Known: false, Term: lease.Term}, nil
+	}
+	return &pb.LeaderInfo{
+		Known:    true,
+		LeaderId: lease.Holder,
+		Address:  lease.Address,
+		Term:     lease.Term,
+	}, nil
+}
+
+// Replicate streams the leader's state to a following master
+func (m *Master) Replicate(req *pb.ReplicateRequest, stream pb.DistributedSystem_ReplicateServer) error {
+	if err := m.authenticator.AuthorizeMaster(stream.Context()); err != nil {
+		log.Printf("Rejecting replication to master %s: %v", req.FollowerId, err)
+		return err
+	}
+
+	// A follower that expects another term follows another leader, or this
+	// master in a term it no longer leads
+	term := m.term.Load()
+	if req.Term != term {
+		return status.Errorf(codes.FailedPrecondition,
+			"master %s expects term %d, this master leads term %d", req.FollowerId, req.Term, term)
+	}
+	done := m.stopped()
+
+	// Subscribe before taking the snapshot, so no change falls between the
+	// two. Changes made in between show up in both, which is harmless since
+	// the follower applies them in order.
+	sub := m.replicated.Subscribe(replicationBuffer)
+	defer sub.Close()
+
+	state, err := m.store.Load()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to load state: %v", err)
+	}
+	snapshot, err := json.Marshal(state)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode state: %v", err)
+	}
+	if err := stream.Send(&pb.ReplicationEvent{Snapshot: snapshot, Term: term}); err != nil {
+		return err
+	}
+	log.Printf("Master %s is replicating from this master", req.FollowerId)
+
+	for {
+		select {
+		case change := <-sub.C:
+			data, err := json.Marshal(change)
+			if err != nil {
+				return status.Errorf(codes.Internal, "failed to encode change: %v", err)
+			}
+			if err := stream.Send(&pb.ReplicationEvent{Change: data, Term: term}); err != nil {
+				return err
+			}
+		case <-sub.Dropped():
+			log.Printf("Master %s fell behind on replication, dropping it", req.FollowerId)
+			return status.Error(codes.ResourceExhausted, "follower fell too far behind")
+		case <-done:
+			return status.Error(codes.Unavailable, "master stopped leading")
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// runElection takes part in leader elections until ctx ends. While another
+// master leads, this one replicates its state, and takes over with that
+// state once elected. A leader that loses the leadership steps down and
+// follows again.
+func (m *Master) runElection(ctx context.Context) {
+	var stopFollowing func()
+	startFollowing := func() {
+		followCtx, cancel := context.WithCancel(ctx)
+		following := make(chan struct{})
+		go func() {
+			defer close(following)
+			m.follow(followCtx)
+		}()
+		stopFollowing = func() {
+			cancel()
+			<-following
+		}
+	}
+	startFollowing()
+	defer func() { stopFollowing() }()
+
+	m.elector.Run(ctx, func(lease election.Lease) error {
+		stopFollowing()
+		if err := m.lead(lease); err != nil {
+			startFollowing()
+			return err
+		}
+		return nil
+	}, func() {
+		m.stepDown()
+		startFollowing()
+	})
+}
+
+// lead takes over as leader with the state replicated so far. A master that
+// cannot load the state does not lead and keeps following.
+func (m *Master) lead(lease election.Lease) error {
+	if err := m.loadState(); err != nil {
+		return err
+	}
+	m.term.Store(lease.Term)
+	m.start()
+	m.leading.Store(true)
+	log.Printf("Master %s is the leader for term %d", m.config.NodeID, lease.Term)
+	return nil
+}
+
+// stepDown stops a master that lost the leadership, since another master
+// may lead already. It stops serving and dispatching, and drops its slaves
+// so they look for the new leader. Their tasks are left as they are: the
+// new leader has them, and this master catches up with it before it can
+// lead again.
+func (m *Master) stepDown() {
+	log.Printf("Master %s lost the leadership for term %d, following again",
+		m.config.NodeID, m.term.Load())
+	m.leading.Store(false)
+	m.stop()
+
+	m.slavesMutex.Lock()
+	slaves := m.slaves
+	m.slaves = make(map[int32]*Slave)
+	m.slavesMutex.Unlock()
+
+	for _, slave := range slaves {
+		slave.Client.Close()
+		if f, ok := m.scheduler.(scheduler.Forgetter); ok {
+			f.Forget(slave.ID)
+		}
+	}
+}
+
+// follow replicates the leader's state into the master's store until ctx
+// ends, connecting again whenever the stream breaks
+func (m *Master) follow(ctx context.Context) {
+	for {
+		err := m.replicateFrom(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Replication from the leader stopped: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(followRetryDelay):
+		}
+	}
+}
+
+// replicateFrom copies the state of the current leader into the master's
+// store until the stream breaks. It returns nil right away if there is no
+// other master to follow.
+func (m *Master) replicateFrom(ctx context.Context) error {
+	lease, err := m.elector.Leader()
+	if err != nil {
+		return err
+	}
+	if !lease.Valid(time.Now()) || lease.Holder == m.config.NodeID {
+		return nil
+	}
+
+	creds := insecure.NewCredentials()
+	if m.config.ClientTLS != nil {
+		creds = credentials.NewTLS(m.config.ClientTLS)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	secret := m.config.MasterSecret
+	if len(secret) == 0 {
+		secret = m.config.AuthSecret
+	}
+	if len(secret) > 0 {
+		opts = append(opts, grpc.WithPerRPCCredentials(
+			auth.NewTokenCredentials(secret, auth.MasterID, m.config.ClientTLS != nil)))
+	}
+	conn, err := grpc.Dial(lease.Address, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to leader: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewDistributedSystemClient(conn).Replicate(ctx, &pb.ReplicateRequest{
+		FollowerId: m.config.NodeID,
+		Term:       lease.Term,
+	})
+	if err != nil {
+		return err
+	}
+
+	event, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if event.Term != lease.Term {
+		return fmt.Errorf("snapshot of term %d while following term %d", event.Term, lease.Term)
+	}
+	if len(event.Snapshot) == 0 {
+		return errors.New("leader did not start with a snapshot")
+	}
+	var state store.State
+	if err := json.Unmarshal(event.Snapshot, &state); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+	if err := store.Restore(m.store, &state); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %v", err)
+	}
+	log.Printf("Replicating from master %s at %s, term %d: %d tasks and %d results",
+		lease.Holder, lease.Address, lease.Term, len(state.Tasks), len(state.Results))
+
+	checked := time.Now()
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		// Drop a leader that was deposed but still sends changes, before it
+		// notices itself
+		if event.Term != lease.Term {
+			return fmt.Errorf("change of term %d while following term %d", event.Term, lease.Term)
+		}
+		if time.Since(checked) > followRetryDelay {
+			current, err := m.elector.Leader()
+			if err != nil {
+				return err
+			}
+			if current.Term != lease.Term {
+				return fmt.Errorf("term %d ended, term %d began", lease.Term, current.Term)
+			}
+			checked = time.Now()
+		}
+		var change store.Change
+		if err := json.Unmarshal(event.Change, &change); err != nil {
+			return fmt.Errorf("failed to decode change: %v", err)
+		}
+		if err := store.Apply(m.store, &change); err != nil {
+			return fmt.Errorf("failed to apply change: %v", err)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/yourusername/distributed/pkg/client"
+	"github.com/yourusername/distributed/pkg/election"
+	"github.com/yourusername/distributed/pkg/store"
+	pb "github.com/yourusername/distributed/proto"
+)
+
+const testElectionTTL = 300 * time.Millisecond
+
+// testMaster is one master of an in-process cluster
+type testMaster struct {
+	id      string
+	address string
+	master  *Master
+	server  *grpc.Server
+	cancel  context.CancelFunc
+	killed  bool
+}
+
+func startTestMaster(t *testing.T, dir, id string) *testMaster {
+	t.Helper()
+	return startTestMasterWithStore(t, dir, id, store.NewMemoryStore())
+}
+
+// startTestMasterWithStore starts a master of the cluster that keeps its
+// state in st
+func startTestMasterWithStore(t *testing.T, dir, id string, st store.Store) *testMaster {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newMaster(st, Config{
+		MaxRetries:  defaultMaxRetries,
+		TaskTimeout: 10 * time.Second,
+		LeaseTTL:    time.Minute,
+		Scheduler:   defaultScheduler,
+		ElectionDir: dir,
+		NodeID:      id,
+		Advertise:   lis.Addr().String(),
+		ElectionTTL: testElectionTTL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := m.newServer()
+	go server.Serve(lis)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tm := &testMaster{
+		id:      id,
+		address: lis.Addr().String(),
+		master:  m,
+		server:  server,
+		cancel:  cancel,
+	}
+	go m.runElection(ctx)
+	t.Cleanup(tm.kill)
+	return tm
+}
+
+// kill stops the master the way a crash would, without giving up its lease
+func (tm *testMaster) kill() {
+	tm.killed = true
+	tm.cancel()
+	tm.server.Stop()
+	tm.master.stop()
+}
+
+// waitForLeader returns the live master that leads once one does
+func waitForLeader(t *testing.T, masters []*testMaster) *testMaster {
+	t.Helper()
+	var leader *testMaster
+	waitFor(t, "a leader", func() bool {
+		for _, tm := range masters {
+			if !tm.killed && tm.master.isLeader() {
+				leader = tm
+				return true
+			}
+		}
+		return false
+	})
+	return leader
+}
+
+// runTestSlave works for whichever master leads until ctx ends, answering
+// tasks of type "echo" with their payload
+func runTestSlave(ctx context.Context, slaveID int32, addresses []string) {
+	for ctx.Err() == nil {
+		serveTestSlave(ctx, slaveID, addresses)
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func serveTestSlave(ctx context.Context, slaveID int32, addresses []string) error {
+	leader, err := client.FindLeader(ctx, addresses)
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.Dial(leader, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewDistributedSystemClient(conn).WorkStream(ctx)
+	if err != nil {
+		return err
+	}
+	err = stream.Send(&pb.SlaveMessage{Message: &pb.SlaveMessage_Register{Register: &pb.RegisterRequest{
+		SlaveId:   slaveID,
+		TaskTypes: []string{"echo"},
+		Slots:     4,
+	}}})
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		task := msg.GetTask()
+		if task == nil {
+			continue
+		}
+		err = stream.Send(&pb.SlaveMessage{Message: &pb.SlaveMessage_TaskResponse{TaskResponse: &pb.TaskResponse{
+			TaskId:   task.TaskId,
+			Accepted: true,
+		}}})
+		if err != nil {
+			return err
+		}
+		err = stream.Send(&pb.SlaveMessage{Message: &pb.SlaveMessage_Result{Result: &pb.TaskResult{
+			TaskId:  task.TaskId,
+			Success: true,
+			Result:  task.Payload,
+			Status:  pb.ResultStatus_RESULT_STATUS_SUCCEEDED,
+		}}})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// dialLeader connects a client to the leading master
+func dialLeader(t *testing.T, addresses []string) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	leader, err := client.FindLeader(ctx, addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.Dial(leader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// runEcho submits an echo task to the leader and waits for its result
+func runEcho(t *testing.T, addresses []string, payload string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := dialLeader(t, addresses)
+	taskID, err := c.Submit(ctx, "echo", []byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := c.Wait(ctx, taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != pb.TaskState_TASK_STATE_SUCCEEDED || string(status.Result) != payload {
+		t.Fatalf("task %s ended %v with %q, want it to succeed with %q",
+			taskID, status.State, status.Result, payload)
+	}
+	return taskID
+}
+
+// replicated reports whether a master's store holds the given unfinished
+// tasks and results
+func replicated(tm *testMaster, taskIDs, resultIDs []string) bool {
+	state, err := tm.master.store.Load()
+	if err != nil {
+		return false
+	}
+	for _, taskID := range taskIDs {
+		if _, exists := state.Tasks[taskID]; !exists {
+			return false
+		}
+	}
+	for _, taskID := range resultIDs {
+		if _, exists := state.Results[taskID]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLeaderFailover(t *testing.T) {
+	dir := t.TempDir()
+	var masters []*testMaster
+	var addresses []string
+	for i := 1; i <= 3; i++ {
+		tm := startTestMaster(t, dir, fmt.Sprintf("master-%d", i))
+		masters = append(masters, tm)
+		addresses = append(addresses, tm.address)
+	}
+	leader := waitForLeader(t, masters)
+
+	// Only the leader serves
+	for _, tm := range masters {
+		if tm != leader && tm.master.isLeader() {
+			t.Fatalf("both %s and %s lead", leader.id, tm.id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runTestSlave(ctx, 1, addresses)
+
+	// One task finishes under the first leader, another one waits for a
+	// slave that can run it
+	finished := runEcho(t, addresses, "before failover")
+	pending, err := dialLeader(t, addresses).Submit(ctx, "unsupported", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tm := range masters {
+		if tm != leader {
+			waitFor(t, tm.id+" to replicate", func() bool {
+				return replicated(tm, []string{pending}, []string{finished})
+			})
+		}
+	}
+
+	leader.kill()
+	next := waitForLeader(t, masters)
+	t.Logf("%s took over from %s", next.id, leader.id)
+
+	// The new leader knows both tasks
+	c := dialLeader(t, addresses)
+	status, err := c.Status(ctx, finished)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != pb.TaskState_TASK_STATE_SUCCEEDED || string(status.Result) != "before failover" {
+		t.Fatalf("finished task is %v with %q after failover", status.State, status.Result)
+	}
+	status, err = c.Status(ctx, pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != pb.TaskState_TASK_STATE_PENDING {
+		t.Fatalf("pending task is %v after failover", status.State)
+	}
+
+	// The slave follows the new leader, and the remaining master replicates
+	// from it
+	after := runEcho(t, addresses, "after failover")
+	for _, tm := range masters {
+		if tm != leader && tm != next {
+			waitFor(t, tm.id+" to replicate from the new leader", func() bool {
+				return replicated(tm, []string{pending}, []string{finished, after})
+			})
+		}
+	}
+}
+
+// forgeLease hands the leader lease to a master outside the cluster, the
+// way masters cut off from the leader would see another master take over
+func forgeLease(t *testing.T, dir string, lease election.Lease) {
+	t.Helper()
+	data, err := json.Marshal(lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "forged.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "leader.json")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeposedLeaderStepsDown(t *testing.T) {
+	dir := t.TempDir()
+	var masters []*testMaster
+	var addresses []string
+	for i := 1; i <= 3; i++ {
+		tm := startTestMaster(t, dir, fmt.Sprintf("master-%d", i))
+		masters = append(masters, tm)
+		addresses = append(addresses, tm.address)
+	}
+	leader := waitForLeader(t, masters)
+	term := leader.master.term.Load()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runTestSlave(ctx, 1, addresses)
+	runEcho(t, addresses, "before stepping down")
+
+	// A follower that expects another term is turned away
+	conn, err := grpc.Dial(leader.address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := pb.NewDistributedSystemClient(conn).Replicate(ctx, &pb.ReplicateRequest{
+		FollowerId: "stale",
+		Term:       term - 1,
+	})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition for a stale term, got %v", err)
+	}
+
+	// Another master takes over for a moment; the leader steps down without
+	// exiting and lets go of its slaves
+	forgeLease(t, dir, election.Lease{
+		Holder:  "master-elsewhere",
+		Address: "127.0.0.1:1",
+		Term:    term + 1,
+		Expiry:  time.Now().Add(time.Second),
+	})
+	waitFor(t, leader.id+" to step down", func() bool {
+		return !leader.master.isLeader()
+	})
+	leader.master.slavesMutex.RLock()
+	slaves := len(leader.master.slaves)
+	leader.master.slavesMutex.RUnlock()
+	if slaves != 0 {
+		t.Errorf("Deposed leader kept %d slaves", slaves)
+	}
+
+	// Once that lease lapses the cluster elects a leader for a newer term,
+	// possibly the same master again, and carries on
+	next := waitForLeader(t, masters)
+	if got := next.master.term.Load(); got <= term+1 {
+		t.Errorf("%s leads term %d, want a term after %d", next.id, got, term+1)
+	}
+	runEcho(t, addresses, "after stepping down")
+}
+
+// unloadableStore is a store whose state cannot be loaded
+type unloadableStore struct {
+	*store.MemoryStore
+}
+
+func (s unloadableStore) Load() (*store.State, error) {
+	return nil, errors.New("disk failure")
+}
+
+func TestFailedTakeoverKeepsFollowing(t *testing.T) {
+	dir := t.TempDir()
+	broken := startTestMasterWithStore(t, dir, "master-1", unloadableStore{store.NewMemoryStore()})
+
+	// The master that cannot load its state gives up every lease it takes
+	// instead of exiting, so another master takes over
+	healthy := startTestMaster(t, dir, "master-2")
+	masters := []*testMaster{broken, healthy}
+	if leader := waitForLeader(t, masters); leader != healthy {
+		t.Fatalf("Expected %s to lead, got %s", healthy.id, leader.id)
+	}
+
+	time.Sleep(testElectionTTL)
+	if broken.master.isLeader() || !healthy.master.isLeader() {
+		t.Errorf("Expected only %s to lead", healthy.id)
+	}
+}
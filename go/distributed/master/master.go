@@ -2,35 +2,151 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
+	"github.com/yourusername/distributed/pkg/auth"
+	"github.com/yourusername/distributed/pkg/election"
+	"github.com/yourusername/distributed/pkg/scheduler"
+	"github.com/yourusername/distributed/pkg/store"
 	"github.com/yourusername/distributed/pkg/utils"
 	pb "github.com/yourusername/distributed/proto"
 )
 
 const (
-	defaultPort = 50051
+	defaultPort            = 50051
+	defaultMaxRetries      = 3
+	defaultTaskTimeout     = 30 * time.Second
+	defaultLeaseTTL        = 15 * time.Second
+	defaultScheduler       = "least-loaded"
+	defaultResultRetention = 24 * time.Hour
+
+	// recoveryGracePeriod is how long a restarted master waits for slaves to
+	// re-register and claim the tasks they were running before it dispatches
+	// those tasks again
+	recoveryGracePeriod = 30 * time.Second
+
+	// resultPruneInterval is how often the master drops results older than
+	// the retention period
+	resultPruneInterval = time.Minute
+
+	// deadlineGracePeriod is how long past a task's deadline the master
+	// waits for the slave to report that it stopped the task before giving
+	// up on the slave
+	deadlineGracePeriod = 5 * time.Second
+
+	// assignCooldown is how long a slave that refused a task, or could not
+	// be reached to take it, is sent no new tasks
+	assignCooldown = 5 * time.Second
 )
 
 // Slave represents a connected slave server
 type Slave struct {
-	ID        int32
-	Address   string
-	Port      int32
-	Status    string
-	Load      float64
-	LastSeen  time.Time
-	Client    pb.DistributedSystemClient
-	Available bool
+	ID       int32
+	Address  string
+	Port     int32
+	Status   string
+	Load     float64
+	LastSeen time.Time
+	Client   slaveConn
+	// Slots is how many tasks the slave runs at once
+	Slots int
+	// ActiveTasks is the number of tasks the slave reported running in its
+	// last heartbeat
+	ActiveTasks int32
+	// LeaseExpiry is when the slave is evicted unless a heartbeat renews its
+	// lease
+	LeaseExpiry time.Time
+	// TaskTypes holds the task types the slave has handlers for. A slave
+	// that reports none is sent tasks of any type.
+	TaskTypes map[string]bool
+	// CooldownUntil is when the slave is sent tasks again after it failed
+	// to take one
+	CooldownUntil time.Time
+}
+
+// Supports reports whether the slave can run tasks of the given type
+func (s *Slave) Supports(taskType string) bool {
+	return len(s.TaskTypes) == 0 || s.TaskTypes[taskType]
+}
+
+// slaveConn is how the master sends work to a slave: over the slave's work
+// stream, or by calling the slave's own gRPC server if it registered with
+// RegisterSlave
+type slaveConn interface {
+	AssignTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error)
+	CancelTask(ctx context.Context, req *pb.CancelTaskRequest) (*pb.CancelTaskResponse, error)
+	Close() error
+}
+
+// unaryConn sends work to a slave by calling its gRPC server
+type unaryConn struct {
+	client pb.DistributedSystemClient
+	conn   *grpc.ClientConn
+}
+
+func (c *unaryConn) AssignTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
+	return c.client.AssignTask(ctx, req)
+}
+
+func (c *unaryConn) CancelTask(ctx context.Context, req *pb.CancelTaskRequest) (*pb.CancelTaskResponse, error) {
+	return c.client.CancelTask(ctx, req)
+}
+
+func (c *unaryConn) Close() error {
+	return c.conn.Close()
+}
+
+// Config holds the master's tunable settings
+type Config struct {
+	// MaxRetries is how many times a failed task is dispatched again before
+	// it moves to the dead-letter list
+	MaxRetries int
+	// TaskTimeout is how long a slave gets to finish one attempt at a task
+	TaskTimeout time.Duration
+	// LeaseTTL is how long a slave stays a member without sending a
+	// heartbeat
+	LeaseTTL time.Duration
+	// Scheduler names the policy that picks which slave runs a task, one
+	// of scheduler.Policies
+	Scheduler string
+	// ResultRetention is how long the master keeps the result and dead
+	// letter of a finished task, or 0 to keep them forever
+	ResultRetention time.Duration
+	// TLS, if set, encrypts the master's server. Slaves then have to present
+	// a client certificate issued for their ID.
+	TLS *tls.Config
+	// ClientTLS, if set, encrypts the connections the master opens to slaves
+	// that registered with RegisterSlave and to the leader it replicates
+	ClientTLS *tls.Config
+	// AuthSecret, if set, is the shared secret that slaves sign their tokens
+	// with
+	AuthSecret []byte
+	// MasterSecret, if set, is the secret that only masters know, which they
+	// sign their tokens to each other with
+	MasterSecret []byte
+	// ElectionDir, if set, makes the master one of several that elect a
+	// leader through a lease kept in this directory, which they all share
+	ElectionDir string
+	// NodeID tells the masters taking part in elections apart
+	NodeID string
+	// Advertise is the address slaves and other masters reach this master at
+	Advertise string
+	// ElectionTTL is how long the leader leads without renewing its lease
+	ElectionTTL time.Duration
 }
 
 // Master represents the master server
@@ -42,30 +158,430 @@ type Master struct {
 	tasksMutex   sync.RWMutex
 	results      map[string]*utils.TaskResult
 	resultsMutex sync.RWMutex
+	store        store.Store
+	config       Config
+	scheduler    scheduler.Scheduler
+	// authenticator checks that slave RPCs come from the slave they name
+	authenticator *auth.Authenticator
+	// recovered holds the assigned tasks reloaded from the store that no
+	// slave has claimed yet, guarded by tasksMutex
+	recovered map[string]bool
+	// recoveryTimer dispatches the recovered tasks again once the grace
+	// period is over, guarded by tasksMutex
+	recoveryTimer *time.Timer
+	// deadLetters holds the tasks that failed permanently, guarded by
+	// tasksMutex
+	deadLetters map[string]*utils.DeadLetter
+	// waiters holds the channels of WaitForResult calls, closed when their
+	// task finishes, guarded by resultsMutex
+	waiters map[string][]chan struct{}
+	// dispatchSignal wakes the dispatcher when there may be work for it
+	dispatchSignal chan struct{}
+	// replicated is store, which passes changes on to following masters
+	replicated *store.Replicated
+	// done is closed to stop the master's background work. A master that
+	// loses the leadership stops, and starts again with a new done if it
+	// wins it back. done and running are guarded by runMutex.
+	done     chan struct{}
+	running  bool
+	runMutex sync.Mutex
+	// elector runs the master for leader, or is nil if it runs alone
+	elector *election.Elector
+	// leading is set while the master leads and serves calls
+	leading atomic.Bool
+	// term is the leader term the master leads in, 0 if it runs alone. It
+	// is sent along with everything the master tells slaves and followers,
+	// so they can turn away a master that was deposed.
+	term atomic.Uint64
 }
 
-// RegisterSlave handles slave registration
-func (m *Master) RegisterSlave(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+// newMaster creates a master and reloads the state saved in st. A master
+// that takes part in elections reloads it once elected instead, after
+// catching up with the previous leader.
+func newMaster(st store.Store, config Config) (*Master, error) {
+	sched, err := scheduler.New(config.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator := &auth.Authenticator{
+		Secret:       config.AuthSecret,
+		MasterSecret: config.MasterSecret,
+		RequireCert:  config.TLS != nil,
+	}
+	replicated := store.NewReplicated(st)
+
+	m := &Master{
+		slaves:         make(map[int32]*Slave),
+		tasks:          make(map[string]*utils.Task),
+		results:        make(map[string]*utils.TaskResult),
+		store:          replicated,
+		replicated:     replicated,
+		config:         config,
+		scheduler:      sched,
+		authenticator:  authenticator,
+		recovered:      make(map[string]bool),
+		deadLetters:    make(map[string]*utils.DeadLetter),
+		waiters:        make(map[string][]chan struct{}),
+		dispatchSignal: make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+
+	if config.ElectionDir != "" {
+		m.elector = election.NewElector(config.ElectionDir, config.NodeID, config.Advertise, config.ElectionTTL)
+		return m, nil
+	}
+	if err := m.loadState(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadState reloads the tasks, results and dead letters saved in the store
+func (m *Master) loadState() error {
+	state, err := m.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %v", err)
+	}
+
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	m.tasks = state.Tasks
+	m.deadLetters = state.DeadLetters
+	m.recovered = make(map[string]bool)
+	m.resultsMutex.Lock()
+	m.results = state.Results
+	m.resultsMutex.Unlock()
+
+	for taskID, task := range m.tasks {
+		if task.AssignedTo != 0 {
+			m.recovered[taskID] = true
+		}
+	}
+	if len(m.tasks) > 0 || len(state.Results) > 0 {
+		log.Printf("Recovered %d pending tasks (%d assigned), %d results and %d dead letters",
+			len(m.tasks), len(m.recovered), len(state.Results), len(m.deadLetters))
+	}
+	if m.recoveryTimer != nil {
+		m.recoveryTimer.Stop()
+	}
+	if len(m.recovered) > 0 {
+		m.recoveryTimer = time.AfterFunc(recoveryGracePeriod, m.requeueUnclaimedTasks)
+	}
+	return nil
+}
+
+// start runs the master's background work: the lease and deadline checks
+// and the dispatcher
+func (m *Master) start() {
+	m.runMutex.Lock()
+	defer m.runMutex.Unlock()
+	if m.running {
+		return
+	}
+	m.running = true
+	m.done = make(chan struct{})
+
+	m.startLeaseCheck(m.done)
+	m.startDeadlineCheck(m.done)
+	if m.config.ResultRetention > 0 {
+		m.startResultPruning(m.done)
+	}
+	go m.dispatchTasks(m.done)
+}
+
+// stop ends the master's background work
+func (m *Master) stop() {
+	m.runMutex.Lock()
+	if m.running {
+		m.running = false
+		close(m.done)
+	}
+	m.runMutex.Unlock()
+
+	m.tasksMutex.Lock()
+	if m.recoveryTimer != nil {
+		m.recoveryTimer.Stop()
+	}
+	m.tasksMutex.Unlock()
+}
+
+// stopped returns a channel that is closed when the master stops its
+// current run
+func (m *Master) stopped() <-chan struct{} {
+	m.runMutex.Lock()
+	defer m.runMutex.Unlock()
+	return m.done
+}
+
+// saveTask persists a task, logging failures since the in-memory state stays
+// authoritative while the master runs
+func (m *Master) saveTask(task *utils.Task) {
+	if err := m.store.SaveTask(task); err != nil {
+		log.Printf("Failed to persist task %s: %v", task.ID, err)
+	}
+}
+
+// signalDispatch wakes the dispatcher without blocking
+func (m *Master) signalDispatch() {
+	select {
+	case m.dispatchSignal <- struct{}{}:
+	default:
+	}
+}
+
+// finishTask records the final result of a task, wakes the clients waiting
+// for it and removes the task from the unfinished ones. The caller must hold
+// tasksMutex.
+func (m *Master) finishTask(result *utils.TaskResult) {
+	// Save the result before deleting the task, so a crash in between
+	// cannot lose both
+	if err := m.store.SaveResult(result); err != nil {
+		log.Printf("Failed to persist result of task %s: %v", result.TaskID, err)
+	}
+
+	m.resultsMutex.Lock()
+	m.results[result.TaskID] = result
+	for _, waiter := range m.waiters[result.TaskID] {
+		close(waiter)
+	}
+	delete(m.waiters, result.TaskID)
+	m.resultsMutex.Unlock()
+
+	delete(m.tasks, result.TaskID)
+	delete(m.recovered, result.TaskID)
+	if err := m.store.DeleteTask(result.TaskID); err != nil {
+		log.Printf("Failed to delete task %s from the store: %v", result.TaskID, err)
+	}
+}
+
+// reconcileTasks matches the tasks a registering slave reports as running
+// with the tasks the master knows about. The slave takes back the tasks that
+// are still assigned to it or pending again, which happens after the master
+// restarted or the slave's lease expired. Tasks the master thought the slave
+// had, but which it no longer runs, are dispatched again.
+func (m *Master) reconcileTasks(slaveID int32, activeTasks []string) {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	active := make(map[string]bool, len(activeTasks))
+	for _, taskID := range activeTasks {
+		active[taskID] = true
+		task, exists := m.tasks[taskID]
+		if !exists || (task.AssignedTo != 0 && task.AssignedTo != slaveID) {
+			continue
+		}
+		delete(m.recovered, taskID)
+		if task.AssignedTo != slaveID || task.State != utils.TaskRunning {
+			task.AssignedTo = slaveID
+			task.State = utils.TaskRunning
+			m.saveTask(task)
+		}
+		log.Printf("Slave %d still runs task %s", slaveID, taskID)
+	}
+
+	for taskID, task := range m.tasks {
+		if task.AssignedTo == slaveID && !active[taskID] {
+			m.retryTask(task, "slave restarted")
+		}
+	}
+}
+
+// requeueUnclaimedTasks makes recovered tasks whose slave did not come back
+// within the grace period available for dispatch again
+func (m *Master) requeueUnclaimedTasks() {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	for taskID := range m.recovered {
+		m.retryTask(m.tasks[taskID], "slave did not re-register")
+	}
+}
+
+// retryTask takes a task away from its slave after a failed attempt and
+// makes it pending again, or moves it to the dead-letter list once it has
+// used up its retries. The caller must hold tasksMutex.
+func (m *Master) retryTask(task *utils.Task, reason string) {
+	delete(m.recovered, task.ID)
+
+	if task.Attempts > m.config.MaxRetries {
+		m.deadLetter(task, reason)
+		return
+	}
+
+	log.Printf("Attempt %d at task %s on slave %d failed: %s. Retrying",
+		task.Attempts, task.ID, task.AssignedTo, reason)
+	task.AssignedTo = 0
+	task.State = utils.TaskPending
+	m.saveTask(task)
+	m.signalDispatch()
+}
+
+// deadLetter gives up on a task and records a failed result for it. The
+// caller must hold tasksMutex.
+func (m *Master) deadLetter(task *utils.Task, reason string) {
+	log.Printf("Giving up on task %s after %d attempts: %s", task.ID, task.Attempts, reason)
+
+	task.AssignedTo = 0
+	letter := &utils.DeadLetter{
+		Task:   task,
+		Reason: reason,
+		Time:   time.Now(),
+	}
+	if err := m.store.SaveDeadLetter(letter); err != nil {
+		log.Printf("Failed to persist dead letter for task %s: %v", task.ID, err)
+	}
+	m.deadLetters[task.ID] = letter
+
+	m.finishTask(&utils.TaskResult{
+		TaskID:         task.ID,
+		Success:        false,
+		ErrorMessage:   fmt.Sprintf("gave up after %d attempts: %s", task.Attempts, reason),
+		CompletionTime: letter.Time,
+		State:          utils.TaskFailed,
+	})
+}
+
+// reassignSlaveTasks takes every task away from a slave that stopped
+// responding, so the dispatcher can hand them to healthy slaves
+func (m *Master) reassignSlaveTasks(slaveID int32, reason string) {
+	m.tasksMutex.Lock()
+	reassigned := 0
+	for _, task := range m.tasks {
+		if task.AssignedTo == slaveID {
+			m.retryTask(task, reason)
+			reassigned++
+		}
+	}
+	m.tasksMutex.Unlock()
+
+	if reassigned > 0 {
+		log.Printf("Took %d tasks away from slave %d", reassigned, slaveID)
+		m.releaseSlave(slaveID)
+	}
+}
+
+// releaseSlave records that a slave no longer runs a task and wakes the
+// dispatcher to fill the freed slot
+func (m *Master) releaseSlave(slaveID int32) {
 	m.slavesMutex.Lock()
-	defer m.slavesMutex.Unlock()
+	if slave, exists := m.slaves[slaveID]; exists {
+		slave.Load -= 0.1 // Decrease the load until the next heartbeat
+		if slave.Load < 0 {
+			slave.Load = 0
+		}
+	}
+	m.slavesMutex.Unlock()
 
-	slaveID := req.SlaveId
-	address := req.Address
-	port := req.Port
+	m.signalDispatch()
+}
 
-	log.Printf("Slave %d at %s:%d is registering", slaveID, address, port)
+// checkTaskDeadlines retries the tasks whose current attempt ran past its
+// deadline and whose slave did not report that it stopped them. Recovered
+// tasks wait for their slave to re-register instead.
+func (m *Master) checkTaskDeadlines() {
+	now := time.Now().Add(-deadlineGracePeriod)
+	var slaveIDs []int32
 
-	// Check if slave already exists
-	if _, exists := m.slaves[slaveID]; exists {
-		return &pb.RegisterResponse{
-			Success: false,
-			Message: fmt.Sprintf("Slave with ID %d already registered", slaveID),
-		}, nil
+	m.tasksMutex.Lock()
+	for taskID, task := range m.tasks {
+		if task.AssignedTo == 0 || m.recovered[taskID] || !now.After(task.Deadline) {
+			continue
+		}
+		slaveIDs = append(slaveIDs, task.AssignedTo)
+		m.retryTask(task, "deadline exceeded")
+	}
+	m.tasksMutex.Unlock()
+
+	for _, slaveID := range slaveIDs {
+		m.releaseSlave(slaveID)
+	}
+}
+
+// startDeadlineCheck periodically checks task deadlines
+func (m *Master) startDeadlineCheck(done <-chan struct{}) {
+	ticker := time.NewTicker(1 * time.Second)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.checkTaskDeadlines()
+			}
+		}
+	}()
+}
+
+// pruneResults forgets the finished tasks whose results are older than the
+// retention period. Clients asking about them are told they were not found
+// afterwards.
+func (m *Master) pruneResults() {
+	cutoff := time.Now().Add(-m.config.ResultRetention)
+	pruned := 0
+
+	m.tasksMutex.Lock()
+	m.resultsMutex.Lock()
+	for taskID, result := range m.results {
+		if !result.CompletionTime.Before(cutoff) {
+			continue
+		}
+		if err := m.store.DeleteResult(taskID); err != nil {
+			log.Printf("Failed to delete result of task %s from the store: %v", taskID, err)
+			continue
+		}
+		delete(m.results, taskID)
+		delete(m.deadLetters, taskID)
+		pruned++
+	}
+	m.resultsMutex.Unlock()
+	m.tasksMutex.Unlock()
+
+	if pruned > 0 {
+		log.Printf("Dropped %d results older than %v", pruned, m.config.ResultRetention)
+	}
+}
+
+// startResultPruning periodically drops old results
+func (m *Master) startResultPruning(done <-chan struct{}) {
+	ticker := time.NewTicker(resultPruneInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.pruneResults()
+			}
+		}
+	}()
+}
+
+// RegisterSlave handles slave registration. The master connects back to
+// the slave's gRPC server to send it tasks.
+func (m *Master) RegisterSlave(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	log.Printf("Slave %d at %s:%d is registering", req.SlaveId, req.Address, req.Port)
+
+	if err := m.authenticator.AuthorizeSlave(ctx, req.SlaveId); err != nil {
+		log.Printf("Rejecting registration of slave %d: %v", req.SlaveId, err)
+		return nil, err
 	}
 
 	// Create client connection to the slave
-	conn, err := grpc.Dial(fmt.Sprintf("%s:%d", address, port),
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	creds := insecure.NewCredentials()
+	if m.config.ClientTLS != nil {
+		creds = credentials.NewTLS(m.config.ClientTLS)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if len(m.config.AuthSecret) > 0 {
+		// Slaves only take tasks from callers that know the shared secret
+		opts = append(opts, grpc.WithPerRPCCredentials(
+			auth.NewTokenCredentials(m.config.AuthSecret, auth.MasterID, m.config.ClientTLS != nil)))
+	}
+	conn, err := grpc.Dial(fmt.Sprintf("%s:%d", req.Address, req.Port), opts...)
 	if err != nil {
 		return &pb.RegisterResponse{
 			Success: false,
@@ -73,36 +589,118 @@ func (m *Master) RegisterSlave(ctx context.Context, req *pb.RegisterRequest) (*p
 		}, nil
 	}
 
-	client := pb.NewDistributedSystemClient(conn)
+	client := &unaryConn{
+		client: pb.NewDistributedSystemClient(conn),
+		conn:   conn,
+	}
+	resp, slave := m.registerSlave(req, client)
+	if slave == nil {
+		client.Close()
+	}
+	return resp, nil
+}
+
+// registerSlave adds a slave that the master reaches through client and
+// returns the new entry, or nil if the slave was rejected
+func (m *Master) registerSlave(req *pb.RegisterRequest, client slaveConn) (*pb.RegisterResponse, *Slave) {
+	slaveID := req.SlaveId
+
+	// 0 marks unassigned tasks and negative IDs belong to masters, so a
+	// slave with such an ID could complete tasks that are not its own
+	if slaveID <= 0 {
+		log.Printf("Rejecting registration of slave %d: slave IDs must be positive", slaveID)
+		return &pb.RegisterResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid slave ID %d: slave IDs must be positive", slaveID),
+		}, nil
+	}
+
+	m.slavesMutex.Lock()
+	defer m.slavesMutex.Unlock()
+
+	// A slave that comes back under the same ID, after a restart or after
+	// its lease expired, replaces its old entry
+	if old, exists := m.slaves[slaveID]; exists {
+		log.Printf("Slave %d is already registered, replacing it", slaveID)
+		old.Client.Close()
+	}
+
+	// Slaves that do not declare their slots run one task at a time
+	slots := int(req.Slots)
+	if slots < 1 {
+		slots = 1
+	}
+
+	taskTypes := make(map[string]bool, len(req.TaskTypes))
+	for _, taskType := range req.TaskTypes {
+		taskTypes[taskType] = true
+	}
 
 	// Add the new slave
-	m.slaves[slaveID] = &Slave{
-		ID:        slaveID,
-		Address:   address,
-		Port:      port,
-		Status:    "active",
-		Load:      0.0,
-		LastSeen:  time.Now(),
-		Client:    client,
-		Available: true,
-	}
-
-	log.Printf("Slave %d successfully registered", slaveID)
+	now := time.Now()
+	slave := &Slave{
+		ID:          slaveID,
+		Address:     req.Address,
+		Port:        req.Port,
+		Status:      "active",
+		Load:        0.0,
+		LastSeen:    now,
+		Client:      client,
+		Slots:       slots,
+		LeaseExpiry: now.Add(m.config.LeaseTTL),
+		TaskTypes:   taskTypes,
+	}
+	m.slaves[slaveID] = slave
+
+	log.Printf("Slave %d successfully registered, %d slots, task types: %v", slaveID, slots, req.TaskTypes)
+
+	// Pick up the tasks the slave kept running while the master was down or
+	// while it was evicted. They take up slots like dispatched tasks.
+	m.reconcileTasks(slaveID, req.ActiveTasks)
+	m.signalDispatch()
+
 	return &pb.RegisterResponse{
-		Success: true,
-		Message: "Successfully registered",
-	}, nil
+		Success:    true,
+		Message:    "Successfully registered",
+		LeaseTtlMs: m.config.LeaseTTL.Milliseconds(),
+		Term:       m.term.Load(),
+	}, slave
 }
 
-// Heartbeat handles heartbeat requests
+// Heartbeat renews the lease of the slave sending it. A slave the master
+// does not know, because it was evicted or the master restarted, is told to
+// register again.
 func (m *Master) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
-	// In a real implementation, this would be called by slaves
-	// For this example, we'll just return a dummy response
+	if err := m.authenticator.AuthorizeSlave(ctx, req.SlaveId); err != nil {
+		return nil, err
+	}
+	return m.heartbeat(req), nil
+}
+
+// heartbeat renews the lease of an authorized slave
+func (m *Master) heartbeat(req *pb.HeartbeatRequest) *pb.HeartbeatResponse {
+	m.slavesMutex.Lock()
+	slave, exists := m.slaves[req.SlaveId]
+	if exists {
+		now := time.Now()
+		slave.LastSeen = now
+		slave.LeaseExpiry = now.Add(m.config.LeaseTTL)
+		slave.Load = req.Load
+		slave.ActiveTasks = req.ActiveTasks
+		if req.Status != "" {
+			slave.Status = req.Status
+		}
+	}
+	m.slavesMutex.Unlock()
+
 	return &pb.HeartbeatResponse{
-		SlaveId: -1, // Master's ID
-		Status:  "active",
-		Load:    0.0,
-	}, nil
+		SlaveId:    -1, // Master's ID
+		Status:     "active",
+		Load:       0.0,
+		Registered: exists,
+		LeaseTtlMs: m.config.LeaseTTL.Milliseconds(),
+		Term:       m.term.Load(),
+	}
 }
 
 // AssignTask handles task assignments
@@ -118,206 +716,363 @@ func (m *Master) AssignTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskR
 
 // CompleteTask handles task completion reports
 func (m *Master) CompleteTask(ctx context.Context, req *pb.TaskResult) (*pb.TaskAck, error) {
+	// The result counts for the slave the caller authenticated as, which
+	// must be the slave it names
+	if m.authenticator.Enabled() {
+		slaveID, err := m.authenticator.SlaveIdentity(ctx)
+		if err == nil && slaveID != req.SlaveId {
+			err = status.Errorf(codes.PermissionDenied, "slave %d cannot report results of slave %d", slaveID, req.SlaveId)
+		}
+		if err != nil {
+			log.Printf("Rejecting result for task %s from slave %d: %v", req.TaskId, req.SlaveId, err)
+			return nil, err
+		}
+	}
+	return m.completeTask(req), nil
+}
+
+// completeTask records the result an authorized slave reported
+func (m *Master) completeTask(req *pb.TaskResult) *pb.TaskAck {
 	taskID := req.TaskId
 
-	log.Printf("Received task completion for task %s. Success: %v", taskID, req.Success)
+	log.Printf("Received task completion for task %s from slave %d. Success: %v", taskID, req.SlaveId, req.Success)
 
+	// Only the slave that owns the task may complete it. Results of attempts
+	// that were already given up on, because of a deadline or because the
+	// slave's lease expired, are dropped.
 	m.tasksMutex.Lock()
-	delete(m.tasks, taskID)
-	m.tasksMutex.Unlock()
+	task, exists := m.tasks[taskID]
+	if !exists || task.AssignedTo == 0 || task.AssignedTo != req.SlaveId {
+		m.tasksMutex.Unlock()
+		log.Printf("Ignoring result for task %s: it is not assigned to slave %d", taskID, req.SlaveId)
+		return &pb.TaskAck{
+			TaskId:   taskID,
+			Received: false,
+		}
+	}
+	slaveID := task.AssignedTo
 
-	m.resultsMutex.Lock()
-	m.results[taskID] = &utils.TaskResult{
+	// Failed attempts and attempts stopped at their deadline are retried.
+	// Cancelled ones are not; the master normally finishes a task when it
+	// cancels it, so this only happens if it forgot the cancellation.
+	if !req.Success {
+		switch req.Status {
+		case pb.ResultStatus_RESULT_STATUS_CANCELLED:
+			m.finishTask(&utils.TaskResult{
+				TaskID:         taskID,
+				Success:        false,
+				ErrorMessage:   req.ErrorMessage,
+				CompletionTime: time.Now(),
+				State:          utils.TaskCancelled,
+			})
+		case pb.ResultStatus_RESULT_STATUS_DEADLINE_EXCEEDED:
+			m.retryTask(task, "deadline exceeded")
+		default:
+			m.retryTask(task, req.ErrorMessage)
+		}
+		m.tasksMutex.Unlock()
+		m.releaseSlave(slaveID)
+		return &pb.TaskAck{
+			TaskId:   taskID,
+			Received: true,
+		}
+	}
+
+	m.finishTask(&utils.TaskResult{
 		TaskID:         taskID,
 		Success:        req.Success,
 		Result:         req.Result,
 		ErrorMessage:   req.ErrorMessage,
 		CompletionTime: time.Now(),
-	}
-	m.resultsMutex.Unlock()
+		State:          utils.TaskSucceeded,
+	})
+	m.tasksMutex.Unlock()
 
 	// Mark the slave as available again
-	if slaveID := findSlaveForTask(taskID); slaveID > 0 {
-		m.slavesMutex.Lock()
-		if slave, exists := m.slaves[slaveID]; exists {
-			slave.Available = true
-			slave.Load -= 0.1 // Decrease the load
-			if slave.Load < 0 {
-				slave.Load = 0
-			}
-		}
-		m.slavesMutex.Unlock()
-	}
+	m.releaseSlave(slaveID)
 
 	return &pb.TaskAck{
 		TaskId:   taskID,
 		Received: true,
-	}, nil
-}
-
-// findSlaveForTask is a helper to find which slave was assigned a task
-// In a real system, you'd have proper bookkeeping
-func findSlaveForTask(taskID string) int32 {
-	// This is a placeholder - in a real system, you'd track which slave has which task
-	return -1
+	}
 }
 
-// startHeartbeatCheck periodically checks slave heartbeats
-func (m *Master) startHeartbeatCheck() {
-	ticker := time.NewTicker(5 * time.Second)
+// startLeaseCheck periodically evicts slaves whose lease expired
+func (m *Master) startLeaseCheck(done <-chan struct{}) {
+	ticker := time.NewTicker(1 * time.Second)
 	go func() {
-		for range ticker.C {
-			m.checkSlaveHeartbeats()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.expireLeases()
+			}
 		}
 	}()
 }
 
-// checkSlaveHeartbeats checks all slaves are still alive
-func (m *Master) checkSlaveHeartbeats() {
+// expireLeases evicts the slaves that stopped sending heartbeats
+func (m *Master) expireLeases() {
+	now := time.Now()
+	var expired []*Slave
+
 	m.slavesMutex.RLock()
-	slaves := make([]*Slave, 0, len(m.slaves))
 	for _, slave := range m.slaves {
-		slaves = append(slaves, slave)
+		if now.After(slave.LeaseExpiry) {
+			expired = append(expired, slave)
+		}
 	}
 	m.slavesMutex.RUnlock()
 
-	for _, slave := range slaves {
-		go func(s *Slave) {
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-			defer cancel()
-
-			resp, err := s.Client.Heartbeat(ctx, &pb.HeartbeatRequest{
-				Timestamp: time.Now().Unix(),
-			})
+	for _, slave := range expired {
+		log.Printf("Lease of slave %d expired, last seen %v ago",
+			slave.ID, now.Sub(slave.LastSeen).Round(time.Second))
+		m.evictSlave(slave, "slave lease expired")
+	}
+}
 
-			m.slavesMutex.Lock()
-			defer m.slavesMutex.Unlock()
+// evictSlave removes a slave, closes the master's connection to it and
+// dispatches its tasks to other slaves. It does nothing if the slave
+// registered again in the meantime.
+func (m *Master) evictSlave(slave *Slave, reason string) {
+	m.slavesMutex.Lock()
+	current := m.slaves[slave.ID] == slave
+	if current {
+		delete(m.slaves, slave.ID)
+	}
+	m.slavesMutex.Unlock()
 
-			if err != nil {
-				log.Printf("Failed to get heartbeat from slave %d: %v", s.ID, err)
-				s.Status = "unreachable"
-			} else {
-				s.Status = resp.Status
-				s.Load = resp.Load
-				s.LastSeen = time.Now()
-			}
-		}(slave)
+	if !current {
+		return
 	}
+	slave.Client.Close()
+	if f, ok := m.scheduler.(scheduler.Forgetter); ok {
+		f.Forget(slave.ID)
+	}
+	m.reassignSlaveTasks(slave.ID, reason)
 }
 
-// dispatchTasks sends tasks to available slaves
-func (m *Master) dispatchTasks() {
-	for {
-		time.Sleep(1 * time.Second)
+// dispatchTasks sends pending tasks to available slaves. It wakes up when a
+// task is submitted or a slave frees up, and at least once a second, until
+// done is closed.
+func (m *Master) dispatchTasks(done <-chan struct{}) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
 
-		m.slavesMutex.RLock()
-		if len(m.slaves) == 0 {
-			m.slavesMutex.RUnlock()
-			continue
+	for {
+		select {
+		case <-done:
+			return
+		case <-m.dispatchSignal:
+		case <-ticker.C:
 		}
 
-		// Find available slaves
-		availableSlaves := make([]*Slave, 0)
-		for _, slave := range m.slaves {
-			if slave.Available && slave.Status == "active" {
-				availableSlaves = append(availableSlaves, slave)
-			}
+		for m.dispatchNext() {
 		}
-		m.slavesMutex.RUnlock()
+	}
+}
 
-		if len(availableSlaves) == 0 {
-			continue
+// dispatchNext assigns the oldest pending task that a slave with a free slot
+// can run to the slave the scheduler picks. It returns false if there is no
+// such task.
+func (m *Master) dispatchNext() bool {
+	// Take a snapshot of the active slaves for the scheduler, leaving out
+	// those cooling down after a failed assignment
+	now := time.Now()
+	m.slavesMutex.RLock()
+	slaves := make(map[int32]*Slave, len(m.slaves))
+	views := make([]*scheduler.Slave, 0, len(m.slaves))
+	for _, slave := range m.slaves {
+		if slave.Status == "active" && !now.Before(slave.CooldownUntil) {
+			slaves[slave.ID] = slave
+			views = append(views, &scheduler.Slave{
+				ID:    slave.ID,
+				Load:  slave.Load,
+				Slots: slave.Slots,
+			})
 		}
+	}
+	m.slavesMutex.RUnlock()
 
-		// Create a new task
-		taskID := utils.GenerateRandomID("task")
-		taskTypes := []string{"fast", "medium", "slow"}
-		taskType := taskTypes[rand.Intn(len(taskTypes))]
+	if len(views) == 0 {
+		return false
+	}
 
-		task := &utils.Task{
-			ID:       taskID,
-			Type:     taskType,
-			Payload:  []byte(fmt.Sprintf("Task data for %s", taskID)),
-			Deadline: time.Now().Add(30 * time.Second),
+	m.tasksMutex.Lock()
+	task, slave := m.nextAssignment(slaves, views)
+	if task == nil {
+		m.tasksMutex.Unlock()
+		return false
+	}
+	task.AssignedTo = slave.ID
+	task.State = utils.TaskAssigned
+	task.Attempts++
+	task.Deadline = time.Now().Add(m.config.TaskTimeout)
+	m.saveTask(task)
+	req := &pb.TaskRequest{
+		TaskId:   task.ID,
+		TaskType: task.Type,
+		Payload:  task.Payload,
+		Deadline: task.Deadline.UnixMilli(),
+		Term:     m.term.Load(),
+	}
+	m.tasksMutex.Unlock()
+
+	m.slavesMutex.Lock()
+	slave.Load += 0.1 // Increase the load until the next heartbeat
+	m.slavesMutex.Unlock()
+
+	// Assign the task
+	go func(s *Slave, t *utils.Task, req *pb.TaskRequest) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		resp, err := s.Client.AssignTask(ctx, req)
+
+		if err != nil {
+			log.Printf("Failed to assign task %s to slave %d: %v", t.ID, s.ID, err)
+			m.requeueTask(t, s, err)
+			return
 		}
 
-		m.tasksMutex.Lock()
-		m.tasks[taskID] = task
-		m.tasksMutex.Unlock()
+		if !resp.Accepted {
+			log.Printf("Slave %d rejected task %s: %s", s.ID, t.ID, resp.Message)
+			m.requeueTask(t, s, nil)
+			return
+		}
 
-		// Pick a random available slave
-		slave := availableSlaves[rand.Intn(len(availableSlaves))]
-
-		m.slavesMutex.Lock()
-		slave.Available = false
-		slave.Load += 0.1 // Increase the load
-		m.slavesMutex.Unlock()
-
-		// Assign the task
-		go func(s *Slave, t *utils.Task) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-
-			deadline := t.Deadline.Unix()
-			resp, err := s.Client.AssignTask(ctx, &pb.TaskRequest{
-				TaskId:   t.ID,
-				TaskType: t.Type,
-				Payload:  t.Payload,
-				Deadline: deadline,
-			})
+		m.markRunning(t, s.ID)
+		log.Printf("Task %s assigned to slave %d", t.ID, s.ID)
+	}(slave, task, req)
 
-			if err != nil {
-				log.Printf("Failed to assign task %s to slave %d: %v", t.ID, s.ID, err)
+	return true
+}
 
-				m.slavesMutex.Lock()
-				s.Available = true
-				m.slavesMutex.Unlock()
+// requeueTask makes a task that the slave did not take pending again and
+// undoes the load dispatchNext added to the slave. The slave cools down
+// before it is sent another task, so the dispatcher does not keep handing
+// tasks to a full or unreachable slave. A rejected assignment does not count
+// as an attempt, but one that failed with err does, so a task that no slave
+// can be reached for ends up dead-lettered.
+func (m *Master) requeueTask(task *utils.Task, slave *Slave, err error) {
+	m.slavesMutex.Lock()
+	slave.Load -= 0.1
+	if slave.Load < 0 {
+		slave.Load = 0
+	}
+	slave.CooldownUntil = time.Now().Add(assignCooldown)
+	m.slavesMutex.Unlock()
+	time.AfterFunc(assignCooldown, m.signalDispatch)
 
-				m.tasksMutex.Lock()
-				delete(m.tasks, t.ID)
-				m.tasksMutex.Unlock()
-				return
-			}
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	if _, exists := m.tasks[task.ID]; !exists || task.AssignedTo != slave.ID {
+		return
+	}
+	if err != nil {
+		m.retryTask(task, fmt.Sprintf("assignment failed: %v", err))
+		return
+	}
+	task.AssignedTo = 0
+	task.State = utils.TaskPending
+	task.Attempts--
+	m.saveTask(task)
+	m.signalDispatch()
+}
 
-			if !resp.Accepted {
-				log.Printf("Slave %d rejected task %s: %s", s.ID, t.ID, resp.Message)
+// markRunning records that a slave accepted a task
+func (m *Master) markRunning(task *utils.Task, slaveID int32) {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
 
-				m.slavesMutex.Lock()
-				s.Available = true
-				m.slavesMutex.Unlock()
+	if _, exists := m.tasks[task.ID]; exists && task.AssignedTo == slaveID {
+		task.State = utils.TaskRunning
+		m.saveTask(task)
+	}
+}
 
-				m.tasksMutex.Lock()
-				delete(m.tasks, t.ID)
-				m.tasksMutex.Unlock()
-				return
+// nextAssignment returns the oldest unassigned task that one of the given
+// slaves supports and has a free slot for, together with the slave the
+// scheduler picks for it. views are the scheduler's view of slaves. It
+// returns nil if there is no such task. The caller must hold tasksMutex.
+func (m *Master) nextAssignment(slaves map[int32]*Slave, views []*scheduler.Slave) (*utils.Task, *Slave) {
+	byID := make(map[int32]*scheduler.Slave, len(views))
+	for _, view := range views {
+		byID[view.ID] = view
+	}
+
+	pending := make([]*utils.Task, 0)
+	for _, task := range m.tasks {
+		if task.AssignedTo == 0 {
+			pending = append(pending, task)
+		} else if view, exists := byID[task.AssignedTo]; exists {
+			view.Running++
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	for _, task := range pending {
+		candidates := make([]*scheduler.Slave, 0, len(views))
+		for _, view := range views {
+			if view.FreeSlots() > 0 && slaves[view.ID].Supports(task.Type) {
+				candidates = append(candidates, view)
 			}
+		}
+		if len(candidates) > 0 {
+			return task, slaves[m.scheduler.Pick(task.Type, candidates).ID]
+		}
+	}
+	return nil, nil
+}
 
-			log.Printf("Task %s assigned to slave %d", t.ID, s.ID)
-		}(slave, task)
+// newServer creates the master's gRPC server
+func (m *Master) newServer() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(m.leaderUnaryInterceptor),
+		grpc.StreamInterceptor(m.leaderStreamInterceptor),
 	}
+	if m.config.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(m.config.TLS)))
+	}
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterDistributedSystemServer(grpcServer, m)
+	return grpcServer
 }
 
 // startServer starts the gRPC server
-func startServer(port int) {
+func startServer(port int, statePath string, config Config) {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	master := &Master{
-		slaves:  make(map[int32]*Slave),
-		tasks:   make(map[string]*utils.Task),
-		results: make(map[string]*utils.TaskResult),
+	var st store.Store = store.NewMemoryStore()
+	if statePath != "" {
+		fileStore, err := store.OpenFileStore(statePath)
+		if err != nil {
+			log.Fatalf("Failed to open state store: %v", err)
+		}
+		defer fileStore.Close()
+		st = fileStore
 	}
 
-	// Start the heartbeat checker
-	master.startHeartbeatCheck()
-
-	// Start task dispatcher
-	go master.dispatchTasks()
+	master, err := newMaster(st, config)
+	if err != nil {
+		log.Fatalf("Failed to start master: %v", err)
+	}
+	grpcServer := master.newServer()
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterDistributedSystemServer(grpcServer, master)
+	if master.elector != nil {
+		log.Printf("Master %s is running for leader", config.NodeID)
+		go master.runElection(context.Background())
+	} else {
+		master.start()
+	}
 
 	log.Printf("Master server started on port %d", port)
 	if err := grpcServer.Serve(lis); err != nil {
@@ -326,11 +1081,63 @@ func startServer(port int) {
 }
 
 func main() {
-	// Initialize random seed
-	rand.Seed(time.Now().UnixNano())
-
 	port := flag.Int("port", defaultPort, "The server port")
+	statePath := flag.String("state", "", "File to persist tasks and results in (in-memory only if empty)")
+	maxRetries := flag.Int("max-retries", defaultMaxRetries, "How often a failed task is retried before it is dead-lettered")
+	taskTimeout := flag.Duration("task-timeout", defaultTaskTimeout, "How long a slave gets to finish a task")
+	leaseTTL := flag.Duration("lease-ttl", defaultLeaseTTL, "How long a slave stays registered without sending a heartbeat")
+	resultRetention := flag.Duration("result-retention", defaultResultRetention, "How long results of finished tasks are kept (forever if 0)")
+	policy := flag.String("scheduler", defaultScheduler,
+		fmt.Sprintf("The policy that picks which slave runs a task, one of %v", scheduler.Policies))
+	tlsCA := flag.String("tls-ca", "", "CA certificate that slave certificates must be signed by (TLS is off if empty)")
+	tlsCert := flag.String("tls-cert", "", "Certificate the master presents to clients and slaves")
+	tlsKey := flag.String("tls-key", "", "Private key of --tls-cert")
+	secretFile := flag.String("auth-secret-file", "", "File with the shared secret slave tokens are signed with")
+	masterSecretFile := flag.String("master-secret-file", "", "File with the secret only masters know, which they sign their tokens to each other with")
+	electionDir := flag.String("election-dir", "", "Directory shared by several masters to elect a leader in (runs alone if empty)")
+	nodeID := flag.String("id", "", "The ID of this master among those taking part in elections (master-<port> if empty)")
+	advertise := flag.String("advertise", "", "The address slaves and other masters reach this master at (localhost:<port> if empty)")
+	electionTTL := flag.Duration("election-ttl", defaultElectionTTL, "How long the leader leads without renewing its lease")
 	flag.Parse()
 
-	startServer(*port)
+	config := Config{
+		MaxRetries:      *maxRetries,
+		TaskTimeout:     *taskTimeout,
+		LeaseTTL:        *leaseTTL,
+		Scheduler:       *policy,
+		ResultRetention: *resultRetention,
+		ElectionDir:     *electionDir,
+		NodeID:          *nodeID,
+		Advertise:       *advertise,
+		ElectionTTL:     *electionTTL,
+	}
+	if config.NodeID == "" {
+		config.NodeID = fmt.Sprintf("master-%d", *port)
+	}
+	if config.Advertise == "" {
+		config.Advertise = fmt.Sprintf("localhost:%d", *port)
+	}
+	if *tlsCA != "" || *tlsCert != "" || *tlsKey != "" {
+		var err error
+		if config.TLS, err = auth.ServerTLSConfig(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		if config.ClientTLS, err = auth.ClientTLSConfig(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+	}
+	if *secretFile != "" {
+		var err error
+		if config.AuthSecret, err = auth.LoadSecret(*secretFile); err != nil {
+			log.Fatalf("Failed to load auth secret: %v", err)
+		}
+	}
+	if *masterSecretFile != "" {
+		var err error
+		if config.MasterSecret, err = auth.LoadSecret(*masterSecretFile); err != nil {
+			log.Fatalf("Failed to load master secret: %v", err)
+		}
+	}
+
+	startServer(*port, *statePath, config)
 }
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/yourusername/distributed/pkg/auth"
+	"github.com/yourusername/distributed/pkg/store"
+	"github.com/yourusername/distributed/pkg/utils"
+	pb "github.com/yourusername/distributed/proto"
+)
+
+// newTestMaster creates a master on an in-memory store without starting its
+// background work, so tests drive it by calling its methods
+func newTestMaster(t *testing.T) (*Master, *store.MemoryStore) {
+	t.Helper()
+	st := store.NewMemoryStore()
+	m, err := newMaster(st, Config{
+		MaxRetries:      defaultMaxRetries,
+		TaskTimeout:     10 * time.Second,
+		LeaseTTL:        time.Minute,
+		Scheduler:       defaultScheduler,
+		ResultRetention: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.stop)
+	return m, st
+}
+
+// fakeConn is a slaveConn that records the work the master sends and
+// accepts every task, unless it is set to refuse or fail assignments
+type fakeConn struct {
+	assigned  chan *pb.TaskRequest
+	cancelled chan string
+	refuse    string
+	fail      error
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		assigned:  make(chan *pb.TaskRequest, 16),
+		cancelled: make(chan string, 16),
+	}
+}
+
+func (c *fakeConn) AssignTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
+	c.assigned <- req
+	if c.fail != nil {
+		return nil, c.fail
+	}
+	if c.refuse != "" {
+		return &pb.TaskResponse{TaskId: req.TaskId, Accepted: false, Message: c.refuse}, nil
+	}
+	return &pb.TaskResponse{TaskId: req.TaskId, Accepted: true}, nil
+}
+
+func (c *fakeConn) CancelTask(ctx context.Context, req *pb.CancelTaskRequest) (*pb.CancelTaskResponse, error) {
+	c.cancelled <- req.TaskId
+	return &pb.CancelTaskResponse{TaskId: req.TaskId, Success: true}, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// registerTestSlave registers a slave that the master reaches through conn
+func registerTestSlave(t *testing.T, m *Master, slaveID int32, conn slaveConn, taskTypes ...string) *Slave {
+	t.Helper()
+	resp, slave := m.registerSlave(&pb.RegisterRequest{
+		SlaveId:   slaveID,
+		Address:   "localhost",
+		Slots:     1,
+		TaskTypes: taskTypes,
+	}, conn)
+	if !resp.Success || slave == nil {
+		t.Fatalf("Registering slave %d failed: %s", slaveID, resp.Message)
+	}
+	return slave
+}
+
+// submitTestTask submits a task and returns its ID
+func submitTestTask(t *testing.T, m *Master, taskType string) string {
+	t.Helper()
+	resp, err := m.SubmitTask(context.Background(), &pb.SubmitTaskRequest{TaskType: taskType, Payload: []byte("payload")})
+	if err != nil || !resp.Success {
+		t.Fatalf("SubmitTask failed: %v %v", resp, err)
+	}
+	return resp.TaskId
+}
+
+// dispatch runs the dispatcher once, expects it to send a task over conn
+// and waits until the master records that the slave accepted it
+func dispatch(t *testing.T, m *Master, conn *fakeConn) *pb.TaskRequest {
+	t.Helper()
+	if !m.dispatchNext() {
+		t.Fatal("Nothing was dispatched")
+	}
+	var req *pb.TaskRequest
+	select {
+	case req = <-conn.assigned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The task was not sent to the slave")
+	}
+	waitFor(t, "the task to run", func() bool {
+		return m.taskStatus(req.TaskId).State == pb.TaskState_TASK_STATE_RUNNING
+	})
+	return req
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// completeTask reports a result to the master as the slave in req would
+func completeTask(m *Master, req *pb.TaskResult) *pb.TaskAck {
+	ack, _ := m.CompleteTask(context.Background(), req)
+	return ack
+}
+
+func TestRegisterSlaveRejectsInvalidIDs(t *testing.T) {
+	m, _ := newTestMaster(t)
+
+	for _, slaveID := range []int32{0, -1} {
+		conn := newFakeConn()
+		resp, slave := m.registerSlave(&pb.RegisterRequest{SlaveId: slaveID}, conn)
+		if resp.Success || slave != nil {
+			t.Errorf("Slave %d was registered", slaveID)
+		}
+	}
+	if len(m.slaves) != 0 {
+		t.Errorf("Expected no slaves, got %d", len(m.slaves))
+	}
+}
+
+func TestCompleteTaskRequiresOwner(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	registerTestSlave(t, m, 2, newFakeConn(), "other")
+
+	taskID := submitTestTask(t, m, "echo")
+	dispatch(t, m, conn)
+
+	for _, slaveID := range []int32{2, 0} {
+		ack := completeTask(m, &pb.TaskResult{TaskId: taskID, SlaveId: slaveID, Success: true})
+		if ack.Received {
+			t.Errorf("Result from slave %d for a task it does not own was accepted", slaveID)
+		}
+	}
+	if state := m.taskStatus(taskID).State; state != pb.TaskState_TASK_STATE_RUNNING {
+		t.Fatalf("Task should still run, got %v", state)
+	}
+
+	ack := completeTask(m, &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true, Result: []byte("done")})
+	if !ack.Received {
+		t.Fatal("Result from the owner was rejected")
+	}
+	status := m.taskStatus(taskID)
+	if status.State != pb.TaskState_TASK_STATE_SUCCEEDED || string(status.Result) != "done" {
+		t.Errorf("Expected the owner's result, got %v", status)
+	}
+
+	// A second report of the same task is a duplicate
+	if ack := completeTask(m, &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true}); ack.Received {
+		t.Error("Result for a finished task was accepted")
+	}
+}
+
+func TestCompleteTaskChecksIdentity(t *testing.T) {
+	m, _ := newTestMaster(t)
+	secret := []byte("secret")
+	m.authenticator = &auth.Authenticator{Secret: secret}
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+	dispatch(t, m, conn)
+
+	// as returns the context of a call made with slave slaveID's token
+	as := func(slaveID int32) context.Context {
+		token := auth.NewToken(secret, slaveID, time.Now().Add(time.Minute))
+		return metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	// Slave 2 cannot pass its result off as slave 1's
+	if _, err := m.CompleteTask(as(2), &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+	if _, err := m.CompleteTask(context.Background(), &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected Unauthenticated, got %v", err)
+	}
+	if state := m.taskStatus(taskID).State; state != pb.TaskState_TASK_STATE_RUNNING {
+		t.Fatalf("Task should still run, got %v", state)
+	}
+
+	ack, err := m.CompleteTask(as(1), &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true})
+	if err != nil || !ack.Received {
+		t.Fatalf("Result from the owner was rejected: %v %v", ack, err)
+	}
+}
+
+func TestRetriesThenDeadLetter(t *testing.T) {
+	m, st := newTestMaster(t)
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+
+	// The first attempt and MaxRetries retries fail
+	for attempt := 1; attempt <= m.config.MaxRetries+1; attempt++ {
+		dispatch(t, m, conn)
+		status := m.taskStatus(taskID)
+		if status.Attempts != int32(attempt) {
+			t.Fatalf("Expected attempt %d, got %d", attempt, status.Attempts)
+		}
+
+		resultStatus := pb.ResultStatus_RESULT_STATUS_FAILED
+		if attempt == 2 {
+			resultStatus = pb.ResultStatus_RESULT_STATUS_DEADLINE_EXCEEDED
+		}
+		ack := completeTask(m, &pb.TaskResult{
+			TaskId:       taskID,
+			SlaveId:      1,
+			Success:      false,
+			Status:       resultStatus,
+			ErrorMessage: "boom",
+		})
+		if !ack.Received {
+			t.Fatalf("Failure of attempt %d was rejected", attempt)
+		}
+
+		if attempt <= m.config.MaxRetries {
+			status := m.taskStatus(taskID)
+			if status.State != pb.TaskState_TASK_STATE_PENDING || status.SlaveId != 0 {
+				t.Fatalf("After attempt %d the task should be pending again, got %v", attempt, status)
+			}
+		}
+	}
+
+	status := m.taskStatus(taskID)
+	if status.State != pb.TaskState_TASK_STATE_FAILED {
+		t.Fatalf("Expected the task to fail for good, got %v", status)
+	}
+	letter, exists := m.deadLetters[taskID]
+	if !exists || letter.Task.Attempts != m.config.MaxRetries+1 || letter.Reason != "boom" {
+		t.Errorf("Expected a dead letter after %d attempts, got %+v", m.config.MaxRetries+1, letter)
+	}
+	if m.dispatchNext() {
+		t.Error("A dead-lettered task was dispatched again")
+	}
+
+	state, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.DeadLetters[taskID] == nil || state.Results[taskID] == nil || state.Tasks[taskID] != nil {
+		t.Error("The store does not hold the dead letter and result in place of the task")
+	}
+}
+
+func TestRejectedAssignment(t *testing.T) {
+	m, _ := newTestMaster(t)
+	full := newFakeConn()
+	full.refuse = "No free slots"
+	fullSlave := registerTestSlave(t, m, 1, full)
+	taskID := submitTestTask(t, m, "echo")
+
+	if !m.dispatchNext() {
+		t.Fatal("Nothing was dispatched")
+	}
+	<-full.assigned
+	waitFor(t, "the task to be pending again", func() bool {
+		return m.taskStatus(taskID).State == pb.TaskState_TASK_STATE_PENDING
+	})
+	if status := m.taskStatus(taskID); status.Attempts != 0 || status.SlaveId != 0 {
+		t.Errorf("A rejected assignment should not count as an attempt, got %v", status)
+	}
+
+	m.slavesMutex.RLock()
+	load := fullSlave.Load
+	m.slavesMutex.RUnlock()
+	if load != 0 {
+		t.Errorf("Load of the rejected assignment was kept: %v", load)
+	}
+
+	// The slave that refused the task cools down, another one takes it
+	if m.dispatchNext() {
+		t.Fatal("A task was sent to a slave that just refused one")
+	}
+	conn := newFakeConn()
+	registerTestSlave(t, m, 2, conn)
+	if req := dispatch(t, m, conn); req.TaskId != taskID {
+		t.Errorf("Expected %s on slave 2, got %v", taskID, req)
+	}
+}
+
+func TestFailedAssignmentsDeadLetter(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	conn.fail = fmt.Errorf("connection refused")
+	slave := registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+
+	// Every failed assignment counts as an attempt
+	for attempt := 1; attempt <= defaultMaxRetries+1; attempt++ {
+		m.slavesMutex.Lock()
+		slave.CooldownUntil = time.Time{}
+		m.slavesMutex.Unlock()
+
+		if !m.dispatchNext() {
+			t.Fatalf("Attempt %d was not dispatched", attempt)
+		}
+		<-conn.assigned
+		waitFor(t, "the assignment to fail", func() bool {
+			status := m.taskStatus(taskID)
+			return status.SlaveId == 0 && status.State != pb.TaskState_TASK_STATE_ASSIGNED
+		})
+	}
+
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_FAILED {
+		t.Errorf("Expected the task to be dead-lettered, got %v", status)
+	}
+	m.tasksMutex.RLock()
+	_, dead := m.deadLetters[taskID]
+	m.tasksMutex.RUnlock()
+	if !dead {
+		t.Error("Task is missing from the dead letters")
+	}
+}
+
+func TestDispatchRoutesByTaskType(t *testing.T) {
+	m, _ := newTestMaster(t)
+	resizer := newFakeConn()
+	echoer := newFakeConn()
+	registerTestSlave(t, m, 1, resizer, "resize")
+	registerTestSlave(t, m, 2, echoer, "echo")
+
+	echoTask := submitTestTask(t, m, "echo")
+	if req := dispatch(t, m, echoer); req.TaskId != echoTask || req.TaskType != "echo" {
+		t.Errorf("Expected the echo task on slave 2, got %v", req)
+	}
+	resizeTask := submitTestTask(t, m, "resize")
+	if req := dispatch(t, m, resizer); req.TaskId != resizeTask {
+		t.Errorf("Expected the resize task on slave 1, got %v", req)
+	}
+
+	// Nobody can run an unknown type until a slave that takes any type
+	// joins
+	otherTask := submitTestTask(t, m, "other")
+	completeTask(m, &pb.TaskResult{TaskId: echoTask, SlaveId: 2, Success: true})
+	if m.dispatchNext() {
+		t.Fatal("A task was sent to a slave without a handler for it")
+	}
+	anything := newFakeConn()
+	registerTestSlave(t, m, 3, anything)
+	if req := dispatch(t, m, anything); req.TaskId != otherTask {
+		t.Errorf("Expected the other task on slave 3, got %v", req)
+	}
+}
+
+func TestCheckTaskDeadlines(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+	dispatch(t, m, conn)
+
+	// The slave gets a grace period past the deadline to report the task
+	m.tasksMutex.Lock()
+	m.tasks[taskID].Deadline = time.Now().Add(-deadlineGracePeriod / 2)
+	m.tasksMutex.Unlock()
+	m.checkTaskDeadlines()
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_RUNNING {
+		t.Fatalf("Task was taken away within the grace period: %v", status)
+	}
+
+	m.tasksMutex.Lock()
+	m.tasks[taskID].Deadline = time.Now().Add(-2 * deadlineGracePeriod)
+	m.tasksMutex.Unlock()
+	m.checkTaskDeadlines()
+	status := m.taskStatus(taskID)
+	if status.State != pb.TaskState_TASK_STATE_PENDING || status.SlaveId != 0 || status.Attempts != 1 {
+		t.Errorf("Expected the overdue task to be pending again, got %v", status)
+	}
+	if ack := completeTask(m, &pb.TaskResult{TaskId: taskID, SlaveId: 1, Success: true}); ack.Received {
+		t.Error("Result of an attempt the master gave up on was accepted")
+	}
+}
+
+func TestLeaseExpiryEvictsSlave(t *testing.T) {
+	m, _ := newTestMaster(t)
+	conn := newFakeConn()
+	slave := registerTestSlave(t, m, 1, conn)
+	taskID := submitTestTask(t, m, "echo")
+	dispatch(t, m, conn)
+
+	// A heartbeat renews the lease
+	m.slavesMutex.Lock()
+	slave.LeaseExpiry = time.Now().Add(time.Second)
+	m.slavesMutex.Unlock()
+	if resp, _ := m.Heartbeat(context.Background(), &pb.HeartbeatRequest{SlaveId: 1, ActiveTasks: 1}); !resp.Registered {
+		t.Fatal("Heartbeat of a registered slave was not recognized")
+	}
+	m.expireLeases()
+	m.slavesMutex.RLock()
+	renewed := m.slaves[1] == slave && slave.LeaseExpiry.After(time.Now().Add(m.config.LeaseTTL/2))
+	m.slavesMutex.RUnlock()
+	if !renewed {
+		t.Fatal("Heartbeat did not renew the lease")
+	}
+
+	m.slavesMutex.Lock()
+	slave.LeaseExpiry = time.Now().Add(-time.Second)
+	m.slavesMutex.Unlock()
+	m.expireLeases()
+
+	m.slavesMutex.RLock()
+	_, registered := m.slaves[1]
+	m.slavesMutex.RUnlock()
+	if registered || !conn.isClosed() {
+		t.Fatal("Slave whose lease expired was not evicted")
+	}
+	status := m.taskStatus(taskID)
+	if status.State != pb.TaskState_TASK_STATE_PENDING || status.SlaveId != 0 {
+		t.Errorf("Task of the evicted slave should be pending again, got %v", status)
+	}
+	if resp, _ := m.Heartbeat(context.Background(), &pb.HeartbeatRequest{SlaveId: 1}); resp.Registered {
+		t.Error("Evicted slave was not told to register again")
+	}
+
+	// The slave comes back still running the task and takes it back
+	conn = newFakeConn()
+	resp, _ := m.registerSlave(&pb.RegisterRequest{SlaveId: 1, ActiveTasks: []string{taskID}}, conn)
+	if !resp.Success {
+		t.Fatalf("Registering again failed: %s", resp.Message)
+	}
+	status = m.taskStatus(taskID)
+	if status.State != pb.TaskState_TASK_STATE_RUNNING || status.SlaveId != 1 {
+		t.Errorf("Returning slave did not take its task back: %v", status)
+	}
+	if m.dispatchNext() {
+		t.Error("The task was dispatched again although its slave still runs it")
+	}
+}
+
+func TestRecoveredTasks(t *testing.T) {
+	st := store.NewMemoryStore()
+	for i, slaveID := range []int32{1, 2} {
+		st.SaveTask(&utils.Task{
+			ID:         fmt.Sprintf("task-%d", i+1),
+			Type:       "echo",
+			State:      utils.TaskRunning,
+			AssignedTo: slaveID,
+			Attempts:   1,
+		})
+	}
+	m, err := newMaster(st, Config{MaxRetries: defaultMaxRetries, LeaseTTL: time.Minute, Scheduler: defaultScheduler})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Slave 1 re-registers still running its task and with a free slot;
+	// slave 2 never comes back
+	m.registerSlave(&pb.RegisterRequest{SlaveId: 1, Slots: 2, ActiveTasks: []string{"task-1"}}, newFakeConn())
+	if m.dispatchNext() {
+		t.Fatal("A recovered task was dispatched within the grace period")
+	}
+
+	m.requeueUnclaimedTasks()
+	if status := m.taskStatus("task-1"); status.State != pb.TaskState_TASK_STATE_RUNNING || status.SlaveId != 1 {
+		t.Errorf("Claimed task should stay with slave 1, got %v", status)
+	}
+	if status := m.taskStatus("task-2"); status.State != pb.TaskState_TASK_STATE_PENDING {
+		t.Errorf("Unclaimed task should be pending again, got %v", status)
+	}
+
+	m.stop()
+	if m.recoveryTimer.Stop() {
+		t.Error("stop left the recovery timer running")
+	}
+}
+
+func TestCompleteTaskPersistsResult(t *testing.T) {
+	st := store.NewMemoryStore()
+	st.SaveTask(&utils.Task{ID: "task-1", Type: "echo", State: utils.TaskRunning, AssignedTo: 1, Attempts: 1})
+	m, err := newMaster(st, Config{MaxRetries: defaultMaxRetries, LeaseTTL: time.Minute, Scheduler: defaultScheduler})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ack := completeTask(m, &pb.TaskResult{TaskId: "task-1", SlaveId: 1, Success: true, Result: []byte("done")}); !ack.Received {
+		t.Fatal("Result was rejected")
+	}
+
+	// A master started on the same store knows the result and does not
+	// run the task again
+	m, err = newMaster(st, Config{MaxRetries: defaultMaxRetries, Scheduler: defaultScheduler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := m.taskStatus("task-1")
+	if status.State != pb.TaskState_TASK_STATE_SUCCEEDED || string(status.Result) != "done" {
+		t.Errorf("Result was not reloaded: %v", status)
+	}
+	if m.dispatchNext() {
+		t.Error("Finished task was dispatched again")
+	}
+}
+
+func TestPruneResults(t *testing.T) {
+	m, st := newTestMaster(t)
+
+	now := time.Now()
+	m.tasksMutex.Lock()
+	for taskID, age := range map[string]time.Duration{"old": 2 * time.Hour, "new": 30 * time.Minute} {
+		task := &utils.Task{ID: taskID, Type: "echo", Attempts: 4}
+		m.tasks[taskID] = task
+		m.deadLetter(task, "failed")
+		m.results[taskID].CompletionTime = now.Add(-age)
+	}
+	m.tasksMutex.Unlock()
+
+	m.pruneResults()
+
+	if status := m.taskStatus("old"); status.Found {
+		t.Errorf("Result older than the retention period was kept: %v", status)
+	}
+	if status := m.taskStatus("new"); !status.Found {
+		t.Error("Result within the retention period was dropped")
+	}
+	if _, exists := m.deadLetters["old"]; exists {
+		t.Error("Dead letter of the dropped task was kept")
+	}
+
+	state, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Results["old"] != nil || state.DeadLetters["old"] != nil {
+		t.Error("Dropped task is still in the store")
+	}
+	if state.Results["new"] == nil || state.DeadLetters["new"] == nil {
+		t.Error("Kept task is missing from the store")
+	}
+}
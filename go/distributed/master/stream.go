@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/yourusername/distributed/proto"
+)
+
+// errStreamClosed is returned for work sent to a slave whose work stream
+// has closed
+var errStreamClosed = errors.New("work stream closed")
+
+// streamConn sends work to a slave over the work stream the slave opened
+type streamConn struct {
+	stream    pb.DistributedSystem_WorkStreamServer
+	sendMutex sync.Mutex // gRPC streams do not allow concurrent sends
+
+	// replies holds the channels of AssignTask calls waiting for the
+	// slave's answer, by task ID
+	replies      map[string]chan *pb.TaskResponse
+	repliesMutex sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newStreamConn(stream pb.DistributedSystem_WorkStreamServer) *streamConn {
+	return &streamConn{
+		stream:  stream,
+		replies: make(map[string]chan *pb.TaskResponse),
+		done:    make(chan struct{}),
+	}
+}
+
+// send sends a message to the slave
+func (c *streamConn) send(msg *pb.MasterMessage) error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	select {
+	case <-c.done:
+		return errStreamClosed
+	default:
+	}
+	return c.stream.Send(msg)
+}
+
+// AssignTask sends a task to the slave and waits for it to accept or
+// reject the task
+func (c *streamConn) AssignTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
+	reply := make(chan *pb.TaskResponse, 1)
+	c.repliesMutex.Lock()
+	c.replies[req.TaskId] = reply
+	c.repliesMutex.Unlock()
+
+	defer func() {
+		c.repliesMutex.Lock()
+		delete(c.replies, req.TaskId)
+		c.repliesMutex.Unlock()
+	}()
+
+	if err := c.send(&pb.MasterMessage{Message: &pb.MasterMessage_Task{Task: req}}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-reply:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, errStreamClosed
+	}
+}
+
+// CancelTask asks the slave to stop a task. The slave does not answer
+// cancellations on the stream, so it only reports whether the request was
+// sent.
+func (c *streamConn) CancelTask(ctx context.Context, req *pb.CancelTaskRequest) (*pb.CancelTaskResponse, error) {
+	if err := c.send(&pb.MasterMessage{Message: &pb.MasterMessage_Cancel{Cancel: req}}); err != nil {
+		return nil, err
+	}
+	return &pb.CancelTaskResponse{
+		TaskId:  req.TaskId,
+		Success: true,
+		Message: "Cancellation sent",
+	}, nil
+}
+
+// Close ends the work stream
+func (c *streamConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// deliver hands the slave's answer to a task to the AssignTask call
+// waiting for it
+func (c *streamConn) deliver(resp *pb.TaskResponse) {
+	c.repliesMutex.Lock()
+	reply, exists := c.replies[resp.TaskId]
+	c.repliesMutex.Unlock()
+
+	if exists {
+		reply <- resp
+	}
+}
+
+// WorkStream serves a slave connected over a work stream. The slave is
+// registered with its first message and evicted when the stream ends.
+func (m *Master) WorkStream(stream pb.DistributedSystem_WorkStreamServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	req := msg.GetRegister()
+	if req == nil {
+		return status.Error(codes.InvalidArgument, "the first message on a work stream must register the slave")
+	}
+
+	log.Printf("Slave %d is registering over a work stream", req.SlaveId)
+
+	// The stream is authorized once; its messages count as the registered
+	// slave's, so they need no further checks
+	if err := m.authenticator.AuthorizeSlave(stream.Context(), req.SlaveId); err != nil {
+		log.Printf("Rejecting registration of slave %d: %v", req.SlaveId, err)
+		return err
+	}
+
+	conn := newStreamConn(stream)
+	defer conn.Close()
+
+	resp, slave := m.registerSlave(req, conn)
+	if err := conn.send(&pb.MasterMessage{
+		Message: &pb.MasterMessage_RegisterResponse{RegisterResponse: resp},
+	}); err != nil || slave == nil {
+		if slave != nil {
+			m.evictSlave(slave, "work stream closed")
+		}
+		return err
+	}
+	defer m.evictSlave(slave, "work stream closed")
+
+	// Receive on another goroutine, so closing the connection, for example
+	// when the slave's lease expires, ends the stream right away
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.receiveWork(slave.ID, conn)
+	}()
+
+	select {
+	case err := <-errc:
+		log.Printf("Work stream of slave %d ended: %v", slave.ID, err)
+		return nil
+	case <-conn.done:
+		return status.Error(codes.Unavailable, "slave evicted")
+	}
+}
+
+// receiveWork handles the messages a slave sends on its work stream until
+// the stream breaks. Messages always count as the registered slave's.
+func (m *Master) receiveWork(slaveID int32, conn *streamConn) error {
+	for {
+		msg, err := conn.stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch msg := msg.Message.(type) {
+		case *pb.SlaveMessage_Heartbeat:
+			msg.Heartbeat.SlaveId = slaveID
+			err = conn.send(&pb.MasterMessage{
+				Message: &pb.MasterMessage_HeartbeatResponse{HeartbeatResponse: m.heartbeat(msg.Heartbeat)},
+			})
+		case *pb.SlaveMessage_TaskResponse:
+			conn.deliver(msg.TaskResponse)
+		case *pb.SlaveMessage_Result:
+			msg.Result.SlaveId = slaveID
+			err = conn.send(&pb.MasterMessage{
+				Message: &pb.MasterMessage_Ack{Ack: m.completeTask(msg.Result)},
+			})
+		default:
+			log.Printf("Ignoring unexpected message from slave %d on its work stream", slaveID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/yourusername/distributed/proto"
+)
+
+// serveTestMaster starts a master that runs alone and serves it on a
+// loopback port, and returns it with a client of it
+func serveTestMaster(t *testing.T) (*Master, pb.DistributedSystemClient) {
+	t.Helper()
+	m, _ := newTestMaster(t)
+	m.start()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := m.newServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return m, pb.NewDistributedSystemClient(conn)
+}
+
+// openWorkStream opens a work stream as the given slave and registers it,
+// claiming activeTasks
+func openWorkStream(t *testing.T, ctx context.Context, c pb.DistributedSystemClient, slaveID int32, activeTasks ...string) pb.DistributedSystem_WorkStreamClient {
+	t.Helper()
+	stream, err := c.WorkStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, stream, &pb.SlaveMessage{Message: &pb.SlaveMessage_Register{Register: &pb.RegisterRequest{
+		SlaveId:     slaveID,
+		TaskTypes:   []string{"echo"},
+		Slots:       2,
+		ActiveTasks: activeTasks,
+	}}})
+	if resp := recv(t, stream).GetRegisterResponse(); resp == nil || !resp.Success {
+		t.Fatalf("Registration over the work stream failed: %v", resp)
+	}
+	return stream
+}
+
+func send(t *testing.T, stream pb.DistributedSystem_WorkStreamClient, msg *pb.SlaveMessage) {
+	t.Helper()
+	if err := stream.Send(msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+func recv(t *testing.T, stream pb.DistributedSystem_WorkStreamClient) *pb.MasterMessage {
+	t.Helper()
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	return msg
+}
+
+func TestWorkStream(t *testing.T) {
+	m, c := serveTestMaster(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	streamCtx, closeStream := context.WithCancel(ctx)
+	stream := openWorkStream(t, streamCtx, c, 1)
+
+	// The master pushes the task and waits for the slave to accept it
+	taskID := submitTestTask(t, m, "echo")
+	task := recv(t, stream).GetTask()
+	if task == nil || task.TaskId != taskID || string(task.Payload) != "payload" {
+		t.Fatalf("Expected task %s on the stream, got %v", taskID, task)
+	}
+	send(t, stream, &pb.SlaveMessage{Message: &pb.SlaveMessage_TaskResponse{TaskResponse: &pb.TaskResponse{
+		TaskId:   taskID,
+		Accepted: true,
+	}}})
+	waitFor(t, "the task to run", func() bool {
+		return m.taskStatus(taskID).State == pb.TaskState_TASK_STATE_RUNNING
+	})
+
+	// Heartbeats are answered on the stream and count as the stream's
+	// slave, whatever ID they carry
+	send(t, stream, &pb.SlaveMessage{Message: &pb.SlaveMessage_Heartbeat{Heartbeat: &pb.HeartbeatRequest{SlaveId: 7}}})
+	if resp := recv(t, stream).GetHeartbeatResponse(); resp == nil || !resp.Registered {
+		t.Fatalf("Expected a heartbeat response for a registered slave, got %v", resp)
+	}
+
+	// The slave loses its stream; the master evicts it and takes its task
+	// back
+	closeStream()
+	waitFor(t, "the slave to be evicted", func() bool {
+		m.slavesMutex.RLock()
+		defer m.slavesMutex.RUnlock()
+		return len(m.slaves) == 0
+	})
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_PENDING {
+		t.Fatalf("Task of the disconnected slave should be pending, got %v", status)
+	}
+
+	// It reconnects still running the task, takes it back and reports it
+	stream = openWorkStream(t, ctx, c, 1, taskID)
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_RUNNING || status.SlaveId != 1 {
+		t.Fatalf("Reconnected slave did not take its task back: %v", status)
+	}
+	send(t, stream, &pb.SlaveMessage{Message: &pb.SlaveMessage_Result{Result: &pb.TaskResult{
+		TaskId:  taskID,
+		Success: true,
+		Result:  []byte("done"),
+		Status:  pb.ResultStatus_RESULT_STATUS_SUCCEEDED,
+	}}})
+	if ack := recv(t, stream).GetAck(); ack == nil || !ack.Received {
+		t.Fatalf("Expected the result to be acknowledged, got %v", ack)
+	}
+	if status := m.taskStatus(taskID); status.State != pb.TaskState_TASK_STATE_SUCCEEDED || string(status.Result) != "done" {
+		t.Errorf("Expected the reported result, got %v", status)
+	}
+}
+
+func TestWorkStreamRejectsBadRegistration(t *testing.T) {
+	m, c := serveTestMaster(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The first message must register the slave
+	stream, err := c.WorkStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, stream, &pb.SlaveMessage{Message: &pb.SlaveMessage_Heartbeat{Heartbeat: &pb.HeartbeatRequest{SlaveId: 1}}})
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+
+	// So must a valid slave ID
+	stream, err = c.WorkStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, stream, &pb.SlaveMessage{Message: &pb.SlaveMessage_Register{Register: &pb.RegisterRequest{SlaveId: 0}}})
+	if resp := recv(t, stream).GetRegisterResponse(); resp == nil || resp.Success {
+		t.Errorf("Slave 0 was registered: %v", resp)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Error("Stream of a rejected slave stayed open")
+	}
+
+	m.slavesMutex.RLock()
+	defer m.slavesMutex.RUnlock()
+	if len(m.slaves) != 0 {
+		t.Errorf("Expected no slaves, got %d", len(m.slaves))
+	}
+}
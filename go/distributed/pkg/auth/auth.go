@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// TokenLifetime is how long a token signed by TokenCredentials is valid
+const TokenLifetime = 5 * time.Minute
+
+const (
+	metadataKey  = "authorization"
+	bearerPrefix = "Bearer "
+)
+
+var (
+	// ErrInvalidToken is returned for a token that is malformed, signed
+	// with another secret or issued to another slave
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrTokenExpired is returned for a token past its expiry
+	ErrTokenExpired = errors.New("token expired")
+)
+
+const (
+	// MasterID is the ID masters sign their tokens for when they call each
+	// other. It matches the ID masters report in heartbeat responses.
+	MasterID int32 = -1
+
+	// MasterName is the common name a master's certificate must carry for
+	// other masters to accept its calls
+	MasterName = "master"
+)
+
+// SlaveName is the common name a slave's certificate must carry
+func SlaveName(slaveID int32) string {
+	return fmt.Sprintf("slave-%d", slaveID)
+}
+
+// NewToken signs a token that identifies a slave until expiry. The token
+// has the form "<slave ID>.<expiry>.<signature>", where the signature is
+// an HMAC-SHA256 of the first two parts keyed with the shared secret.
+func NewToken(secret []byte, slaveID int32, expiry time.Time) string {
+	claims := fmt.Sprintf("%d.%d", slaveID, expiry.Unix())
+	return claims + "." + sign(secret, claims)
+}
+
+// VerifyToken checks that a token was signed with secret for the slave and
+// has not expired at now
+func VerifyToken(secret []byte, slaveID int32, token string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+	claims := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(secret, claims))) {
+		return ErrInvalidToken
+	}
+
+	id, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil || int32(id) != slaveID {
+		return ErrInvalidToken
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if now.After(time.Unix(expiry, 0)) {
+		return ErrTokenExpired
+	}
+	return nil
+}
+
+// tokenSlaveID returns the slave ID a token claims, without verifying it
+func tokenSlaveID(token string) (int32, error) {
+	claim, _, _ := strings.Cut(token, ".")
+	id, err := strconv.ParseInt(claim, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return int32(id), nil
+}
+
+func sign(secret []byte, claims string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(claims))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// tokenCredentials attaches a freshly signed token to every call
+type tokenCredentials struct {
+	secret     []byte
+	slaveID    int32
+	requireTLS bool
+}
+
+// NewTokenCredentials returns per-call credentials that authenticate a
+// slave with tokens signed with the shared secret. With requireTLS set,
+// gRPC refuses to send them over an unencrypted connection.
+func NewTokenCredentials(secret []byte, slaveID int32, requireTLS bool) credentials.PerRPCCredentials {
+	return &tokenCredentials{secret: secret, slaveID: slaveID, requireTLS: requireTLS}
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token := NewToken(c.secret, c.slaveID, time.Now().Add(TokenLifetime))
+	return map[string]string{metadataKey: bearerPrefix + token}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// Authenticator checks that the caller of a slave RPC is the slave it
+// claims to be
+type Authenticator struct {
+	// Secret, if set, is the shared secret slave tokens must be signed with
+	Secret []byte
+	// MasterSecret, if set, is the secret only masters know, which the
+	// tokens of masters calling each other must be signed with
+	MasterSecret []byte
+	// RequireCert makes callers present a verified client certificate
+	// whose common name is SlaveName of their ID
+	RequireCert bool
+}
+
+// Enabled reports whether the authenticator checks anything
+func (a *Authenticator) Enabled() bool {
+	return len(a.Secret) > 0 || a.RequireCert
+}
+
+// AuthorizeSlave checks the token and certificate of an incoming call made
+// on behalf of a slave. The error is a gRPC status error.
+func (a *Authenticator) AuthorizeSlave(ctx context.Context, slaveID int32) error {
+	return a.authorize(ctx, slaveID, SlaveName(slaveID), fmt.Sprintf("slave %d", slaveID))
+}
+
+// SlaveIdentity returns the ID of the slave an incoming call authenticated
+// as: the slave its token was issued to or, without a secret, the slave its
+// certificate names. All configured credentials must agree on it. The error
+// is a gRPC status error.
+func (a *Authenticator) SlaveIdentity(ctx context.Context) (int32, error) {
+	var slaveID int32
+	switch {
+	case len(a.Secret) > 0:
+		token, ok := tokenFromContext(ctx)
+		if !ok {
+			return 0, status.Error(codes.Unauthenticated, "missing token")
+		}
+		id, err := tokenSlaveID(token)
+		if err != nil {
+			return 0, status.Error(codes.Unauthenticated, err.Error())
+		}
+		slaveID = id
+	case a.RequireCert:
+		commonName, ok := peerCommonName(ctx)
+		if !ok {
+			return 0, status.Error(codes.Unauthenticated, "missing client certificate")
+		}
+		if _, err := fmt.Sscanf(commonName, "slave-%d", &slaveID); err != nil || SlaveName(slaveID) != commonName {
+			return 0, status.Errorf(codes.PermissionDenied, "certificate of %q is not a slave's", commonName)
+		}
+	default:
+		return 0, status.Error(codes.Unauthenticated, "authentication is disabled")
+	}
+
+	if slaveID < 1 {
+		return 0, status.Errorf(codes.PermissionDenied, "%d is not a slave ID", slaveID)
+	}
+	if err := a.AuthorizeSlave(ctx, slaveID); err != nil {
+		return 0, err
+	}
+	return slaveID, nil
+}
+
+// AuthorizeMaster checks the token and certificate of an incoming call made
+// by another master. Slaves know the shared secret too, so a token signed
+// with it does not prove the caller is a master: a master must present a
+// certificate for MasterName or a token signed with MasterSecret. The error
+// is a gRPC status error.
+func (a *Authenticator) AuthorizeMaster(ctx context.Context) error {
+	if len(a.MasterSecret) == 0 {
+		if len(a.Secret) > 0 && !a.RequireCert {
+			return status.Error(codes.PermissionDenied,
+				"masters can only be told from slaves by a certificate or a master secret")
+		}
+		return a.authorize(ctx, MasterID, MasterName, "a master")
+	}
+
+	masters := *a
+	masters.Secret = a.MasterSecret
+	return masters.authorize(ctx, MasterID, MasterName, "a master")
+}
+
+// AuthorizeMasterToSlave checks the token and certificate of an incoming
+// call that a master makes to a slave, such as AssignTask. Masters sign
+// these tokens with the shared secret, which slaves know too, so unlike
+// AuthorizeMaster this only keeps out callers without the secret. The
+// error is a gRPC status error.
+func (a *Authenticator) AuthorizeMasterToSlave(ctx context.Context) error {
+	return a.authorize(ctx, MasterID, MasterName, "a master")
+}
+
+// authorize checks that the caller holds a token for id and a certificate
+// for name, as configured. who describes the caller in errors.
+func (a *Authenticator) authorize(ctx context.Context, id int32, name, who string) error {
+	if len(a.Secret) > 0 {
+		token, ok := tokenFromContext(ctx)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "missing token")
+		}
+		if err := VerifyToken(a.Secret, id, token, time.Now()); err != nil {
+			return status.Errorf(codes.Unauthenticated, "%s: %v", who, err)
+		}
+	}
+
+	if a.RequireCert {
+		commonName, ok := peerCommonName(ctx)
+		if !ok {
+			return status.Error(codes.Unauthenticated, "missing client certificate")
+		}
+		if commonName != name {
+			return status.Errorf(codes.PermissionDenied,
+				"certificate of %q cannot act as %s", commonName, who)
+		}
+	}
+	return nil
+}
+
+// tokenFromContext returns the bearer token of an incoming call
+func tokenFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, value := range md.Get(metadataKey) {
+		if strings.HasPrefix(value, bearerPrefix) {
+			return strings.TrimPrefix(value, bearerPrefix), true
+		}
+	}
+	return "", false
+}
+
+// peerCommonName returns the common name of the verified client
+// certificate of an incoming call
+func peerCommonName(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName, true
+}
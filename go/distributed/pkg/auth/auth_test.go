@@ -0,0 +1,406 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/yourusername/distributed/proto"
+)
+
+func TestToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	token := NewToken(secret, 7, now.Add(time.Minute))
+
+	if err := VerifyToken(secret, 7, token, now); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		slaveID int32
+		token   string
+		now     time.Time
+		want    error
+	}{
+		{"other slave", secret, 8, token, now, ErrInvalidToken},
+		{"other secret", []byte("other"), 7, token, now, ErrInvalidToken},
+		{"expired", secret, 7, token, now.Add(2 * time.Minute), ErrTokenExpired},
+		{"empty", secret, 7, "", now, ErrInvalidToken},
+		{"too few parts", secret, 7, "7.123", now, ErrInvalidToken},
+		{"forged claims", secret, 8, "8" + token[1:], now, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		if err := VerifyToken(tt.secret, tt.slaveID, tt.token, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	serial  int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial:  1,
+	}
+}
+
+// issue writes a certificate for commonName, valid for localhost, and its
+// key to dir and returns their paths
+func (ca *testCA) issue(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, commonName+".crt")
+	keyFile = filepath.Join(dir, commonName+".key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeMaster accepts registrations that pass its authenticator
+type fakeMaster struct {
+	pb.UnimplementedDistributedSystemServer
+	authenticator *Authenticator
+}
+
+func (m *fakeMaster) RegisterSlave(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	if err := m.authenticator.AuthorizeSlave(ctx, req.SlaveId); err != nil {
+		return nil, err
+	}
+	return &pb.RegisterResponse{Success: true}, nil
+}
+
+func TestAuthorizeSlaveOverTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.certPEM)
+	secret := []byte("secret")
+
+	masterCert, masterKey := ca.issue(t, dir, "master")
+	serverConfig, err := ServerTLSConfig(masterCert, masterKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverConfig)))
+	pb.RegisterDistributedSystemServer(server, &fakeMaster{
+		authenticator: &Authenticator{Secret: secret, RequireCert: true},
+	})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	slaveCert, slaveKey := ca.issue(t, dir, SlaveName(1))
+	otherCert, otherKey := ca.issue(t, dir, SlaveName(2))
+	rogueCert, rogueKey := newTestCA(t).issue(t, t.TempDir(), SlaveName(1))
+
+	tests := []struct {
+		name      string
+		certFile  string
+		keyFile   string
+		secret    []byte
+		wantCode  codes.Code
+		handshake bool // the TLS handshake itself fails
+	}{
+		{name: "certificate and token", certFile: slaveCert, keyFile: slaveKey, secret: secret, wantCode: codes.OK},
+		{name: "certificate of another slave", certFile: otherCert, keyFile: otherKey, secret: secret, wantCode: codes.PermissionDenied},
+		{name: "no certificate", secret: secret, wantCode: codes.Unauthenticated},
+		{name: "no token", certFile: slaveCert, keyFile: slaveKey, wantCode: codes.Unauthenticated},
+		{name: "token signed with another secret", certFile: slaveCert, keyFile: slaveKey, secret: []byte("other"), wantCode: codes.Unauthenticated},
+		{name: "certificate from another CA", certFile: rogueCert, keyFile: rogueKey, secret: secret, handshake: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := ClientTLSConfig(tt.certFile, tt.keyFile, caFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(clientConfig))}
+			if tt.secret != nil {
+				opts = append(opts, grpc.WithPerRPCCredentials(NewTokenCredentials(tt.secret, 1, true)))
+			}
+			conn, err := grpc.Dial(lis.Addr().String(), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			resp, err := pb.NewDistributedSystemClient(conn).RegisterSlave(ctx, &pb.RegisterRequest{SlaveId: 1})
+
+			if tt.handshake {
+				if err == nil {
+					t.Fatal("registered with a certificate from another CA")
+				}
+				return
+			}
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("got %v (%v), want %v", got, err, tt.wantCode)
+			}
+			if tt.wantCode == codes.OK && !resp.Success {
+				t.Fatal("registration failed")
+			}
+		})
+	}
+}
+
+func TestAuthorizeMaster(t *testing.T) {
+	secret := []byte("secret")
+	masterSecret := []byte("master secret")
+	withToken := func(secret []byte, id int32) context.Context {
+		token := NewToken(secret, id, time.Now().Add(time.Minute))
+		return metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(metadataKey, bearerPrefix+token))
+	}
+
+	authenticator := &Authenticator{Secret: secret, MasterSecret: masterSecret}
+	if err := authenticator.AuthorizeMaster(withToken(masterSecret, MasterID)); err != nil {
+		t.Fatalf("master token rejected: %v", err)
+	}
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		// Slaves know the shared secret, so they could sign this one
+		{"master token signed with the shared secret", withToken(secret, MasterID), codes.Unauthenticated},
+		{"slave token", withToken(masterSecret, 1), codes.Unauthenticated},
+		{"no token", context.Background(), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		if got := status.Code(authenticator.AuthorizeMaster(tt.ctx)); got != tt.wantCode {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.wantCode)
+		}
+	}
+
+	// Without a certificate or a master secret a master cannot be told
+	// from a slave
+	sharedOnly := &Authenticator{Secret: secret}
+	if got := status.Code(sharedOnly.AuthorizeMaster(withToken(secret, MasterID))); got != codes.PermissionDenied {
+		t.Errorf("shared secret only: got %v, want %v", got, codes.PermissionDenied)
+	}
+}
+
+func TestSlaveIdentity(t *testing.T) {
+	secret := []byte("secret")
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(metadataKey, bearerPrefix+token))
+	}
+	authenticator := &Authenticator{Secret: secret}
+
+	slaveID, err := authenticator.SlaveIdentity(withToken(NewToken(secret, 3, time.Now().Add(time.Minute))))
+	if err != nil || slaveID != 3 {
+		t.Fatalf("SlaveIdentity() = %d, %v, want 3", slaveID, err)
+	}
+
+	tests := []struct {
+		name          string
+		authenticator *Authenticator
+		ctx           context.Context
+		wantCode      codes.Code
+	}{
+		{"no token", authenticator, context.Background(), codes.Unauthenticated},
+		{"malformed token", authenticator, withToken("slave.1.x"), codes.Unauthenticated},
+		{"forged token", authenticator, withToken(NewToken([]byte("other"), 3, time.Now().Add(time.Minute))), codes.Unauthenticated},
+		{"master token", authenticator, withToken(NewToken(secret, MasterID, time.Now().Add(time.Minute))), codes.PermissionDenied},
+		{"no certificate", &Authenticator{RequireCert: true}, context.Background(), codes.Unauthenticated},
+		{"disabled", &Authenticator{}, context.Background(), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		if _, err := tt.authenticator.SlaveIdentity(tt.ctx); status.Code(err) != tt.wantCode {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantCode)
+		}
+	}
+}
+
+func TestRequireClientName(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.certPEM)
+
+	slaveCert, slaveKey := ca.issue(t, dir, SlaveName(1))
+	serverConfig, err := ServerTLSConfig(slaveCert, slaveKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RequireClientName(serverConfig, MasterName)
+
+	masterCert, masterKey := ca.issue(t, dir, MasterName)
+	otherCert, otherKey := ca.issue(t, dir, SlaveName(2))
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		wantOK   bool
+	}{
+		{"master", masterCert, masterKey, true},
+		{"another slave", otherCert, otherKey, false},
+		{"no certificate", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := ClientTLSConfig(tt.certFile, tt.keyFile, caFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientConfig.ServerName = "localhost"
+
+			// A pipe would block the server on the alert it sends
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			serverErr := make(chan error, 1)
+			go func() {
+				conn, err := lis.Accept()
+				if err != nil {
+					serverErr <- err
+					return
+				}
+				defer conn.Close()
+				serverErr <- tls.Server(conn, serverConfig).Handshake()
+			}()
+
+			client, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+			if err == nil {
+				defer client.Close()
+			}
+			if err := <-serverErr; (err == nil) != tt.wantOK {
+				t.Fatalf("server handshake: %v, want success %v", err, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClientRejectsUnknownServer(t *testing.T) {
+	dir := t.TempDir()
+	trusted := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, trusted.certPEM)
+
+	serverCert, serverKey := newTestCA(t).issue(t, dir, "impostor")
+	serverConfig, err := ServerTLSConfig(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig, err := ClientTLSConfig("", "", caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go tls.Server(server, serverConfig).Handshake()
+
+	clientConfig.ServerName = "localhost"
+	if err := tls.Client(client, clientConfig).Handshake(); err == nil {
+		t.Fatal("client accepted a server certificate from an unknown CA")
+	}
+}
+
+func TestLoadSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	writeFile(t, path, []byte("  s3cret\n"))
+	secret, err := LoadSecret(path)
+	if err != nil || string(secret) != "s3cret" {
+		t.Fatalf("LoadSecret() = %q, %v", secret, err)
+	}
+
+	writeFile(t, path, []byte("\n"))
+	if _, err := LoadSecret(path); err == nil {
+		t.Fatal("LoadSecret accepted an empty secret")
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ServerTLSConfig loads the certificate a server presents and the CA that
+// client certificates must be signed by. Clients without a certificate are
+// accepted, so tools like the submit command can connect; RPCs that need a
+// certificate check for one with an Authenticator.
+func ServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" || caFile == "" {
+		return nil, errors.New("TLS needs a certificate, a key and a CA")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %v", err)
+	}
+	pool, err := loadCA(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// RequireClientName makes a server config accept only callers with a
+// certificate from the CA whose common name is name, so that a certificate
+// the CA issued to someone else, like a slave, is turned away
+func RequireClientName(config *tls.Config, name string) {
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+			return errors.New("missing client certificate")
+		}
+		if commonName := state.VerifiedChains[0][0].Subject.CommonName; commonName != name {
+			return fmt.Errorf("certificate of %q is not %q", commonName, name)
+		}
+		return nil
+	}
+}
+
+// ClientTLSConfig loads the CA that a server's certificate must be signed by
+// and, if certFile is not empty, the certificate the client presents
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, errors.New("TLS needs a CA")
+	}
+
+	pool, err := loadCA(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// LoadSecret reads a shared secret from a file, ignoring surrounding
+// whitespace
+func LoadSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %v", err)
+	}
+	secret := bytes.TrimSpace(data)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+func loadCA(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
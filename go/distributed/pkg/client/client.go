@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github.com/yourusername/distributed/proto"
+)
+
+// askLeaderTimeout bounds how long FindLeader waits for one master, so an
+// unresponsive master does not keep it from asking the others
+const askLeaderTimeout = 2 * time.Second
+
+// ErrTaskNotFound is returned for a task ID the master does not know
+var ErrTaskNotFound = errors.New("task not found")
+
+// Client submits tasks to a master and follows them until they finish
+type Client struct {
+	conn   *grpc.ClientConn
+	client pb.DistributedSystemClient
+}
+
+// Dial connects to the master at address. Without options the connection
+// is not encrypted.
+func Dial(address string, opts ...grpc.DialOption) (*Client, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to master: %v", err)
+	}
+
+	return &Client{
+		conn:   conn,
+		client: pb.NewDistributedSystemClient(conn),
+	}, nil
+}
+
+// FindLeader asks the masters at addresses, in order, which master leads
+// and returns the leader's address. A master that runs without leader
+// election leads itself. A single address is returned without asking.
+// Without options the connections are not encrypted.
+func FindLeader(ctx context.Context, addresses []string, opts ...grpc.DialOption) (string, error) {
+	if len(addresses) == 1 {
+		return addresses[0], nil
+	}
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	err := errors.New("no master addresses")
+	for _, address := range addresses {
+		var leader string
+		leader, err = askLeader(ctx, address, opts)
+		if err == nil {
+			return leader, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find the leading master: %v", err)
+}
+
+// askLeader asks the master at address which master leads
+func askLeader(ctx context.Context, address string, opts []grpc.DialOption) (string, error) {
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, askLeaderTimeout)
+	defer cancel()
+
+	info, err := pb.NewDistributedSystemClient(conn).GetLeader(ctx, &pb.LeaderRequest{})
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", address, err)
+	}
+	if !info.Known {
+		return "", fmt.Errorf("%s: no leader elected", address)
+	}
+	if info.Address == "" {
+		return address, nil
+	}
+	return info.Address, nil
+}
+
+// Close closes the connection to the master
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Submit sends a task to the master and returns the ID the master gave it
+func (c *Client) Submit(ctx context.Context, taskType string, payload []byte) (string, error) {
+	resp, err := c.client.SubmitTask(ctx, &pb.SubmitTaskRequest{
+		TaskType: taskType,
+		Payload:  payload,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to submit task: %v", err)
+	}
+	if !resp.Success {
+		return "", fmt.Errorf("master rejected task: %s", resp.Message)
+	}
+	return resp.TaskId, nil
+}
+
+// Status returns the current status of a task
+func (c *Client) Status(ctx context.Context, taskID string) (*pb.TaskStatus, error) {
+	status, err := c.client.GetTaskStatus(ctx, &pb.TaskStatusRequest{TaskId: taskID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of task %s: %v", taskID, err)
+	}
+	if !status.Found {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	return status, nil
+}
+
+// Wait blocks until a task finishes and returns its final status. It gives
+// up when ctx is done.
+func (c *Client) Wait(ctx context.Context, taskID string) (*pb.TaskStatus, error) {
+	for {
+		// The master caps each call, so keep asking until the task finishes
+		var timeout time.Duration
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+
+		status, err := c.client.WaitForResult(ctx, &pb.WaitForResultRequest{
+			TaskId:    taskID,
+			TimeoutMs: timeout.Milliseconds(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to wait for task %s: %v", taskID, err)
+		}
+		if !status.Found {
+			return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+		}
+		if Finished(status.State) {
+			return status, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return status, err
+		}
+	}
+}
+
+// Cancel cancels a task that has not finished yet
+func (c *Client) Cancel(ctx context.Context, taskID string) error {
+	resp, err := c.client.CancelTask(ctx, &pb.CancelTaskRequest{TaskId: taskID})
+	if err != nil {
+		return fmt.Errorf("failed to cancel task %s: %v", taskID, err)
+	}
+	if !resp.Success {
+		return fmt.Errorf("master did not cancel task %s: %s", taskID, resp.Message)
+	}
+	return nil
+}
+
+// Finished reports whether a task in the given state is done for good
+func Finished(state pb.TaskState) bool {
+	switch state {
+	case pb.TaskState_TASK_STATE_SUCCEEDED, pb.TaskState_TASK_STATE_FAILED, pb.TaskState_TASK_STATE_CANCELLED:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package election
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	leaseFile = "leader.json"
+	lockFile  = "leader.lock"
+)
+
+// Lease records which master leads
+type Lease struct {
+	// Holder is the ID of the master holding the lease
+	Holder string `json:"holder"`
+	// Address is where slaves and the other masters reach the holder
+	Address string `json:"address"`
+	// Term grows by one whenever the lease changes hands or lapses
+	Term   uint64    `json:"term"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// Valid reports whether someone holds the lease at now
+func (l Lease) Valid(now time.Time) bool {
+	return l.Holder != "" && now.Before(l.Expiry)
+}
+
+// Elector campaigns for the leader lease, which is kept in a directory all
+// masters share. Updates to the lease are serialized with a lock on a file
+// next to it, so the directory must be on a file system where file locks
+// work across all masters, such as a local disk shared by masters on one
+// host. Masters are assumed to share a clock.
+type Elector struct {
+	dir     string
+	id      string
+	address string
+	ttl     time.Duration
+}
+
+// NewElector creates an elector for the master with the given ID, which
+// other masters and slaves reach at address. A lease lasts ttl unless its
+// holder renews it.
+func NewElector(dir, id, address string, ttl time.Duration) *Elector {
+	return &Elector{dir: dir, id: id, address: address, ttl: ttl}
+}
+
+// Leader returns the lease currently on record
+func (e *Elector) Leader() (Lease, error) {
+	return readLease(filepath.Join(e.dir, leaseFile))
+}
+
+// Campaign takes the lease if nobody holds it, or renews it if this master
+// does, and returns the lease in force afterwards
+func (e *Elector) Campaign() (Lease, error) {
+	unlock, err := lock(filepath.Join(e.dir, lockFile))
+	if err != nil {
+		return Lease{}, err
+	}
+	defer unlock()
+
+	path := filepath.Join(e.dir, leaseFile)
+	current, err := readLease(path)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	now := time.Now()
+	if current.Holder != e.id && current.Valid(now) {
+		return current, nil
+	}
+
+	next := Lease{
+		Holder:  e.id,
+		Address: e.address,
+		Term:    current.Term,
+		Expiry:  now.Add(e.ttl),
+	}
+	// A lapsed lease starts a new term even for the same master, since
+	// another master may have led in between as far as anyone knows
+	if current.Holder != e.id || !current.Valid(now) {
+		next.Term++
+	}
+	if err := writeLease(path, next); err != nil {
+		return Lease{}, err
+	}
+	return next, nil
+}
+
+// Resign gives up the lease if this master holds it, so another master can
+// take it right away instead of waiting for it to run out
+func (e *Elector) Resign() error {
+	unlock, err := lock(filepath.Join(e.dir, lockFile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := filepath.Join(e.dir, leaseFile)
+	current, err := readLease(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if current.Holder != e.id || !current.Valid(now) {
+		return nil
+	}
+	current.Expiry = now
+	return writeLease(path, current)
+}
+
+// Run campaigns every third of the lease until ctx ends. It calls elected
+// when this master takes the lease and deposed when it loses it, including
+// when it could not renew the lease in time or only renewed it after it
+// lapsed, in a new term. If elected fails, the master resigns and campaigns
+// again with the next attempt. Both run on Run's goroutine.
+func (e *Elector) Run(ctx context.Context, elected func(Lease) error, deposed func()) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	leading := false
+	var term uint64
+	var expiry time.Time
+	for {
+		lease, err := e.Campaign()
+		now := time.Now()
+
+		switch {
+		case err != nil:
+			log.Printf("Leader election failed: %v", err)
+			// Step down while the lease still holds if the next attempt
+			// would come too late to renew it
+			if leading && !now.Add(e.ttl/3).Before(expiry) {
+				leading = false
+				deposed()
+			}
+		case lease.Holder == e.id:
+			expiry = lease.Expiry
+			// A lease that lapsed before this master renewed it is a new
+			// term, and another master may have led in between
+			if leading && lease.Term != term {
+				leading = false
+				deposed()
+			}
+			if !leading {
+				if err := elected(lease); err != nil {
+					log.Printf("Failed to take over as leader for term %d: %v", lease.Term, err)
+					if err := e.Resign(); err != nil {
+						log.Printf("Failed to resign: %v", err)
+					}
+					break
+				}
+				leading = true
+				term = lease.Term
+			}
+		case leading:
+			leading = false
+			deposed()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readLease reads the lease file, returning an empty lease if there is none
+// yet
+func readLease(path string) (Lease, error) {
+	var lease Lease
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lease, nil
+	}
+	if err != nil {
+		return lease, fmt.Errorf("failed to read lease: %v", err)
+	}
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return lease, fmt.Errorf("failed to decode lease: %v", err)
+	}
+	return lease, nil
+}
+
+// writeLease replaces the lease file atomically
+func writeLease(path string, lease Lease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write lease: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write lease: %v", err)
+	}
+	return nil
+}
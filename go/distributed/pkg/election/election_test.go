@@ -0,0 +1,202 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// campaign runs one campaign and fails the test if it errors
+func campaign(t *testing.T, e *Elector) Lease {
+	t.Helper()
+	lease, err := e.Campaign()
+	if err != nil {
+		t.Fatalf("Campaign of %s: %v", e.id, err)
+	}
+	return lease
+}
+
+// sameLease reports whether two leases are the same, ignoring the monotonic
+// clock reading that only leases taken in this process carry
+func sameLease(a, b Lease) bool {
+	return a.Holder == b.Holder && a.Address == b.Address && a.Term == b.Term && a.Expiry.Equal(b.Expiry)
+}
+
+// run runs e until the test ends
+func run(t *testing.T, e *Elector, elected func(Lease) error, deposed func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx, elected, deposed)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCampaignAcquiresAndRenews(t *testing.T) {
+	dir := t.TempDir()
+	e := NewElector(dir, "m1", "localhost:50051", time.Minute)
+
+	if lease, err := e.Leader(); err != nil || lease.Valid(time.Now()) {
+		t.Fatalf("Expected no leader yet, got %+v, %v", lease, err)
+	}
+
+	lease := campaign(t, e)
+	if lease.Holder != "m1" || lease.Address != "localhost:50051" || lease.Term != 1 || !lease.Valid(time.Now()) {
+		t.Fatalf("Expected m1 to lead term 1, got %+v", lease)
+	}
+	if current, err := e.Leader(); err != nil || !sameLease(current, lease) {
+		t.Errorf("Lease on record is %+v, %v, expected %+v", current, err, lease)
+	}
+
+	// Renewing keeps the term and extends the lease
+	renewed := campaign(t, e)
+	if renewed.Term != 1 || !renewed.Expiry.After(lease.Expiry) {
+		t.Errorf("Expected term 1 to be extended, got %+v after %+v", renewed, lease)
+	}
+}
+
+func TestCampaignRespectsValidLease(t *testing.T) {
+	dir := t.TempDir()
+	m1 := NewElector(dir, "m1", "localhost:50051", time.Minute)
+	m2 := NewElector(dir, "m2", "localhost:50052", time.Minute)
+
+	held := campaign(t, m1)
+	if lease := campaign(t, m2); !sameLease(lease, held) {
+		t.Errorf("m2 took a valid lease: %+v", lease)
+	}
+}
+
+func TestTakeoverAfterExpiry(t *testing.T) {
+	dir := t.TempDir()
+	const ttl = 50 * time.Millisecond
+	m1 := NewElector(dir, "m1", "localhost:50051", ttl)
+	m2 := NewElector(dir, "m2", "localhost:50052", ttl)
+
+	campaign(t, m1)
+	time.Sleep(2 * ttl)
+
+	lease := campaign(t, m2)
+	if lease.Holder != "m2" || lease.Term != 2 {
+		t.Fatalf("Expected m2 to take over in term 2, got %+v", lease)
+	}
+	if lease := campaign(t, m1); lease.Holder != "m2" {
+		t.Errorf("m1 took the lease back from m2: %+v", lease)
+	}
+
+	// A holder that lets its lease lapse starts a new term even if nobody
+	// else took it
+	time.Sleep(2 * ttl)
+	if lease := campaign(t, m2); lease.Holder != "m2" || lease.Term != 3 {
+		t.Errorf("Expected m2 to lead term 3 after its lease lapsed, got %+v", lease)
+	}
+}
+
+func TestResign(t *testing.T) {
+	dir := t.TempDir()
+	m1 := NewElector(dir, "m1", "localhost:50051", time.Minute)
+	m2 := NewElector(dir, "m2", "localhost:50052", time.Minute)
+
+	campaign(t, m1)
+
+	// Only the holder can resign
+	if err := m2.Resign(); err != nil {
+		t.Fatalf("Resign of m2: %v", err)
+	}
+	if lease, _ := m1.Leader(); lease.Holder != "m1" || !lease.Valid(time.Now()) {
+		t.Fatalf("m2 ended the lease of m1: %+v", lease)
+	}
+
+	if err := m1.Resign(); err != nil {
+		t.Fatalf("Resign of m1: %v", err)
+	}
+	if lease, _ := m1.Leader(); lease.Valid(time.Now()) {
+		t.Fatalf("Lease is still valid after its holder resigned: %+v", lease)
+	}
+	if lease := campaign(t, m2); lease.Holder != "m2" || lease.Term != 2 {
+		t.Errorf("Expected m2 to take over in term 2, got %+v", lease)
+	}
+}
+
+func TestRunElectsAndDeposes(t *testing.T) {
+	dir := t.TempDir()
+	e := NewElector(dir, "m1", "localhost:50051", 150*time.Millisecond)
+
+	elected := make(chan Lease, 1)
+	deposed := make(chan struct{}, 1)
+	run(t, e, func(lease Lease) error {
+		elected <- lease
+		return nil
+	}, func() {
+		deposed <- struct{}{}
+	})
+
+	select {
+	case lease := <-elected:
+		if lease.Holder != "m1" || lease.Term != 1 {
+			t.Fatalf("Expected m1 to be elected for term 1, got %+v", lease)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("m1 was not elected")
+	}
+
+	// Another master takes the lease, as it would if m1 had stalled
+	if err := writeLease(filepath.Join(dir, leaseFile), Lease{
+		Holder:  "m2",
+		Address: "localhost:50052",
+		Term:    2,
+		Expiry:  time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-deposed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("m1 was not deposed")
+	}
+}
+
+func TestRunResignsWhenTakeoverFails(t *testing.T) {
+	dir := t.TempDir()
+	m1 := NewElector(dir, "m1", "localhost:50051", 150*time.Millisecond)
+	m2 := NewElector(dir, "m2", "localhost:50052", time.Minute)
+
+	attempts := make(chan struct{}, 16)
+	run(t, m1, func(lease Lease) error {
+		select {
+		case attempts <- struct{}{}:
+		default:
+		}
+		return errors.New("state unavailable")
+	}, func() {
+		t.Error("m1 was deposed without being elected")
+	})
+
+	select {
+	case <-attempts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("m1 never tried to take over")
+	}
+
+	// m1 gave the lease up, so m2 does not have to wait for it to run out
+	waitFor(t, "m2 to take over", func() bool {
+		return campaign(t, m2).Holder == "m2"
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package election
+
+import "errors"
+
+// lock is not implemented: leader election relies on flock
+func lock(path string) (func(), error) {
+	return nil, errors.New("leader election is only supported on Unix systems")
+}
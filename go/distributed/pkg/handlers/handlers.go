@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Handler runs one task. It receives the task payload and returns the
+// result that is reported back to the master, or an error if the task
+// failed. Handlers should return promptly once ctx is done.
+type Handler func(ctx context.Context, payload []byte) ([]byte, error)
+
+// Registry maps task types to the handlers that run them
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler)}
+}
+
+// Register adds the handler for a task type. It panics if the type is empty
+// or already has a handler, since both are programming errors.
+func (r *Registry) Register(taskType string, handler Handler) {
+	if taskType == "" {
+		panic("handlers: empty task type")
+	}
+	if handler == nil {
+		panic(fmt.Sprintf("handlers: nil handler for task type %q", taskType))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.handlers[taskType]; exists {
+		panic(fmt.Sprintf("handlers: task type %q registered twice", taskType))
+	}
+	r.handlers[taskType] = handler
+}
+
+// Lookup returns the handler for a task type
+func (r *Registry) Lookup(taskType string) (Handler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	handler, exists := r.handlers[taskType]
+	return handler, exists
+}
+
+// Types returns the registered task types in sorted order
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.handlers))
+	for taskType := range r.handlers {
+		types = append(types, taskType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Default is the registry slaves use unless they are given another one
+var Default = NewRegistry()
+
+// Register adds a handler to the Default registry
+func Register(taskType string, handler Handler) {
+	Default.Register(taskType, handler)
+}
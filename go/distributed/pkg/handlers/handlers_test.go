@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func echo(ctx context.Context, payload []byte) ([]byte, error) {
+	return payload, nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if types := r.Types(); len(types) != 0 {
+		t.Errorf("New registry has types %v", types)
+	}
+
+	r.Register("resize", echo)
+	r.Register("echo", echo)
+
+	handler, exists := r.Lookup("echo")
+	if !exists {
+		t.Fatal("Registered handler was not found")
+	}
+	if result, err := handler(context.Background(), []byte("hi")); err != nil || string(result) != "hi" {
+		t.Errorf("Handler returned %q, %v", result, err)
+	}
+	if _, exists := r.Lookup("unknown"); exists {
+		t.Error("Lookup found a handler for an unknown type")
+	}
+	if types := r.Types(); !reflect.DeepEqual(types, []string{"echo", "resize"}) {
+		t.Errorf("Expected sorted types [echo resize], got %v", types)
+	}
+}
+
+func TestRegistryRejectsBadRegistrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		taskType string
+		handler  Handler
+	}{
+		{"empty type", "", echo},
+		{"nil handler", "nil", nil},
+		{"duplicate type", "echo", echo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.Register("echo", echo)
+
+			defer func() {
+				if recover() == nil {
+					t.Error("Register did not panic")
+				}
+			}()
+			r.Register(tt.taskType, tt.handler)
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Slave is what a scheduler knows about a slave
+type Slave struct {
+	ID int32
+	// Load is the load the slave last reported
+	Load float64
+	// Slots is how many tasks the slave runs at once
+	Slots int
+	// Running is how many tasks the slave runs now
+	Running int
+}
+
+// FreeSlots returns how many more tasks the slave can take
+func (s *Slave) FreeSlots() int {
+	return s.Slots - s.Running
+}
+
+// Scheduler decides which slave runs a task
+type Scheduler interface {
+	// Pick returns the slave among candidates that should run a task of the
+	// given type. The master only passes slaves that support the type and
+	// have a free slot, and never an empty list.
+	Pick(taskType string, candidates []*Slave) *Slave
+}
+
+// Forgetter is implemented by schedulers that keep state per slave. The
+// master calls Forget when a slave leaves, so the state of slaves that are
+// gone does not pile up.
+type Forgetter interface {
+	Forget(slaveID int32)
+}
+
+// Policies lists the names New accepts
+var Policies = []string{"least-loaded", "round-robin", "weighted", "affinity"}
+
+// New creates the scheduler for a policy name
+func New(policy string) (Scheduler, error) {
+	switch policy {
+	case "least-loaded":
+		return LeastLoaded{}, nil
+	case "round-robin":
+		return NewRoundRobin(), nil
+	case "weighted":
+		return NewWeighted(), nil
+	case "affinity":
+		return NewAffinity(), nil
+	}
+	return nil, fmt.Errorf("unknown scheduling policy %q, known policies: %v", policy, Policies)
+}
+
+// LeastLoaded picks the slave with the lowest reported load. Ties go to the
+// slave with the smaller share of its slots in use, then to the lower ID.
+type LeastLoaded struct{}
+
+// Pick implements Scheduler
+func (LeastLoaded) Pick(taskType string, candidates []*Slave) *Slave {
+	return leastLoaded(candidates)
+}
+
+func leastLoaded(candidates []*Slave) *Slave {
+	best := candidates[0]
+	for _, slave := range candidates[1:] {
+		if lessLoaded(slave, best) {
+			best = slave
+		}
+	}
+	return best
+}
+
+// lessLoaded reports whether a is less loaded than b
+func lessLoaded(a, b *Slave) bool {
+	if a.Load != b.Load {
+		return a.Load < b.Load
+	}
+	// a.Running/a.Slots < b.Running/b.Slots without dividing
+	if x, y := a.Running*b.Slots, b.Running*a.Slots; x != y {
+		return x < y
+	}
+	return a.ID < b.ID
+}
+
+// RoundRobin picks slaves in turn, in order of their IDs, skipping the ones
+// that are not candidates
+type RoundRobin struct {
+	mu   sync.Mutex
+	last int32
+	used bool
+}
+
+// NewRoundRobin creates a round-robin scheduler
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+// Pick implements Scheduler
+func (r *RoundRobin) Pick(taskType string, candidates []*Slave) *Slave {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sorted := sortedByID(candidates)
+	next := sorted[0]
+	if r.used {
+		for _, slave := range sorted {
+			if slave.ID > r.last {
+				next = slave
+				break
+			}
+		}
+	}
+	r.last = next.ID
+	r.used = true
+	return next
+}
+
+// Weighted spreads tasks over the slaves in proportion to their slots,
+// using smooth weighted round-robin, so a slave with twice the slots gets
+// twice the tasks without getting them in bursts
+type Weighted struct {
+	mu      sync.Mutex
+	current map[int32]int
+}
+
+// NewWeighted creates a weighted-capacity scheduler
+func NewWeighted() *Weighted {
+	return &Weighted{current: make(map[int32]int)}
+}
+
+// Pick implements Scheduler
+func (w *Weighted) Pick(taskType string, candidates []*Slave) *Slave {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var best *Slave
+	total := 0
+	for _, slave := range sortedByID(candidates) {
+		w.current[slave.ID] += slave.Slots
+		total += slave.Slots
+		if best == nil || w.current[slave.ID] > w.current[best.ID] {
+			best = slave
+		}
+	}
+	w.current[best.ID] -= total
+	return best
+}
+
+// Forget implements Forgetter
+func (w *Weighted) Forget(slaveID int32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.current, slaveID)
+}
+
+// Affinity keeps sending tasks of a type to the slaves that ran the most
+// tasks of that type before, so caches and warmed-up state on those slaves
+// get reused. Ties, including types no candidate ran yet, go to the least
+// loaded slave.
+type Affinity struct {
+	mu  sync.Mutex
+	ran map[string]map[int32]int // task type -> slave ID -> tasks picked
+}
+
+// NewAffinity creates a task-type affinity scheduler
+func NewAffinity() *Affinity {
+	return &Affinity{ran: make(map[string]map[int32]int)}
+}
+
+// Pick implements Scheduler
+func (a *Affinity) Pick(taskType string, candidates []*Slave) *Slave {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ran := a.ran[taskType]
+	if ran == nil {
+		ran = make(map[int32]int)
+		a.ran[taskType] = ran
+	}
+
+	best := candidates[0]
+	for _, slave := range candidates[1:] {
+		if ran[slave.ID] > ran[best.ID] ||
+			(ran[slave.ID] == ran[best.ID] && lessLoaded(slave, best)) {
+			best = slave
+		}
+	}
+	ran[best.ID]++
+	return best
+}
+
+// Forget implements Forgetter. A slave that comes back under the same ID
+// starts without affinity, as its warmed-up state is likely gone.
+func (a *Affinity) Forget(slaveID int32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for taskType, ran := range a.ran {
+		delete(ran, slaveID)
+		if len(ran) == 0 {
+			delete(a.ran, taskType)
+		}
+	}
+}
+
+// sortedByID returns a copy of slaves ordered by ID, so the result of a
+// pick does not depend on the order the master lists slaves in
+func sortedByID(slaves []*Slave) []*Slave {
+	sorted := append([]*Slave(nil), slaves...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
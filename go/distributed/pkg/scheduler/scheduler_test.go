@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fakeSlave builds the scheduler's view of a slave
+func fakeSlave(id int32, load float64, slots, running int) *Slave {
+	return &Slave{ID: id, Load: load, Slots: slots, Running: running}
+}
+
+// pickIDs runs n picks of one task type and returns the IDs of the picked
+// slaves
+func pickIDs(s Scheduler, taskType string, candidates []*Slave, n int) []int32 {
+	ids := make([]int32, 0, n)
+	for i := 0; i < n; i++ {
+		ids = append(ids, s.Pick(taskType, candidates).ID)
+	}
+	return ids
+}
+
+func TestNew(t *testing.T) {
+	for _, policy := range Policies {
+		s, err := New(policy)
+		if err != nil || s == nil {
+			t.Errorf("New(%q) = %v, %v", policy, s, err)
+		}
+	}
+	if _, err := New("random"); err == nil {
+		t.Error("New accepted an unknown policy")
+	}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []*Slave
+		want       int32
+	}{
+		{
+			name:       "lowest load",
+			candidates: []*Slave{fakeSlave(1, 0.5, 4, 0), fakeSlave(2, 0.2, 4, 3), fakeSlave(3, 0.9, 4, 0)},
+			want:       2,
+		},
+		{
+			name:       "same load, fewer slots in use",
+			candidates: []*Slave{fakeSlave(1, 0.3, 2, 1), fakeSlave(2, 0.3, 4, 1), fakeSlave(3, 0.3, 4, 3)},
+			want:       2,
+		},
+		{
+			name:       "full tie goes to the lowest ID",
+			candidates: []*Slave{fakeSlave(3, 0, 1, 0), fakeSlave(1, 0, 1, 0), fakeSlave(2, 0, 1, 0)},
+			want:       1,
+		},
+	}
+	for _, tt := range tests {
+		if got := (LeastLoaded{}).Pick("fast", tt.candidates).ID; got != tt.want {
+			t.Errorf("%s: picked slave %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	s := NewRoundRobin()
+	all := []*Slave{fakeSlave(3, 0, 1, 0), fakeSlave(1, 0, 1, 0), fakeSlave(2, 0, 1, 0)}
+
+	if got, want := pickIDs(s, "fast", all, 4), []int32{1, 2, 3, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("picked %v, want %v", got, want)
+	}
+
+	// Slave 2 is busy, so the turn passes to slave 3
+	if got := s.Pick("fast", []*Slave{all[0], all[1]}).ID; got != 3 {
+		t.Fatalf("picked slave %d, want 3", got)
+	}
+	if got := s.Pick("fast", all).ID; got != 1 {
+		t.Fatalf("picked slave %d after wrapping around, want 1", got)
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	s := NewWeighted()
+	candidates := []*Slave{fakeSlave(1, 0, 5, 0), fakeSlave(2, 0, 1, 0), fakeSlave(3, 0, 1, 0)}
+
+	want := []int32{1, 1, 2, 1, 3, 1, 1}
+	for round := 0; round < 3; round++ {
+		if got := pickIDs(s, "fast", candidates, len(want)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("round %d: picked %v, want %v", round, got, want)
+		}
+	}
+}
+
+func TestWeightedForget(t *testing.T) {
+	s := NewWeighted()
+	for id := int32(1); id <= 100; id++ {
+		s.Pick("fast", []*Slave{fakeSlave(id, 0, 1, 0), fakeSlave(1000, 0, 2, 0)})
+		s.Forget(id)
+	}
+	if len(s.current) != 1 {
+		t.Errorf("Expected state for 1 slave, got %d", len(s.current))
+	}
+
+	// Forgetting a slave that is still there only costs it its place in
+	// the round
+	s.Forget(1000)
+	if got := s.Pick("fast", []*Slave{fakeSlave(1, 0, 1, 0), fakeSlave(2, 0, 1, 0)}).ID; got != 1 {
+		t.Errorf("picked slave %d, want 1", got)
+	}
+}
+
+func TestAffinity(t *testing.T) {
+	s := NewAffinity()
+	one := fakeSlave(1, 0.1, 2, 0)
+	two := fakeSlave(2, 0.0, 2, 0)
+
+	// A new type goes to the least loaded slave and then sticks to it
+	if got, want := pickIDs(s, "resize", []*Slave{one, two}, 3), []int32{2, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("picked %v, want %v", got, want)
+	}
+
+	// Another type builds its own affinity
+	two.Load = 0.5
+	if got, want := pickIDs(s, "encode", []*Slave{one, two}, 2), []int32{1, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("picked %v, want %v", got, want)
+	}
+
+	// The preferred slave keeps winning even when it is more loaded
+	if got := s.Pick("resize", []*Slave{one, two}).ID; got != 2 {
+		t.Fatalf("picked slave %d, want 2", got)
+	}
+
+	// When it is busy, another slave takes over
+	if got := s.Pick("resize", []*Slave{one}).ID; got != 1 {
+		t.Fatalf("picked slave %d, want 1", got)
+	}
+}
+
+func TestAffinityForget(t *testing.T) {
+	s := NewAffinity()
+	one := fakeSlave(1, 0.0, 2, 0)
+	two := fakeSlave(2, 0.5, 2, 0)
+	pickIDs(s, "resize", []*Slave{one, two}, 3)
+	pickIDs(s, "encode", []*Slave{one}, 1)
+
+	// The slave comes back under the same ID but without its affinity
+	s.Forget(1)
+	if len(s.ran) != 0 {
+		t.Errorf("Expected no state left, got %v", s.ran)
+	}
+	one.Load = 0.9
+	if got := s.Pick("resize", []*Slave{one, two}).ID; got != 2 {
+		t.Errorf("picked slave %d, want 2", got)
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	if got := fakeSlave(1, 0, 4, 1).FreeSlots(); got != 3 {
+		t.Fatalf("FreeSlots() = %d, want 3", got)
+	}
+}
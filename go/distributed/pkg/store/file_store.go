@@ -0,0 +1,244 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/yourusername/distributed/pkg/utils"
+)
+
+const (
+	opSaveTask       = "save_task"
+	opDeleteTask     = "delete_task"
+	opSaveResult     = "save_result"
+	opDeleteResult   = "delete_result"
+	opSaveDeadLetter = "save_dead_letter"
+
+	// minCompactRecords keeps small logs from being rewritten all the time
+	minCompactRecords = 1000
+)
+
+// ErrCorruptLog is returned when a record other than the last one in the
+// log cannot be decoded
+var ErrCorruptLog = errors.New("store: corrupt log")
+
+// Change is one change to a store: a line of the file store's write-ahead
+// log, and what a leading master replicates to the other masters
+type Change struct {
+	Op         string            `json:"op"`
+	Task       *utils.Task       `json:"task,omitempty"`
+	TaskID     string            `json:"task_id,omitempty"`
+	Result     *utils.TaskResult `json:"result,omitempty"`
+	DeadLetter *utils.DeadLetter `json:"dead_letter,omitempty"`
+}
+
+// FileStore is a write-ahead log of JSON records, one per line. Every change
+// is synced to disk before the call returns. The log is compacted into a
+// snapshot of the live state when it is opened and whenever it has grown to
+// several times the size of that state.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	state   *State
+	records int // records in the log since the last compaction
+}
+
+// OpenFileStore opens the log at path, creating it if it does not exist. A
+// torn last record, left by a crash in the middle of a write, is dropped.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, state: newState()}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	s.state.dropFinished()
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay rebuilds the state from the log on disk
+func (s *FileStore) replay() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open state log: %v", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A last line without a newline was cut short by a crash
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read state log: %v", err)
+		}
+
+		var rec Change
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil || !rec.valid() {
+			return fmt.Errorf("%w: line %d of %s", ErrCorruptLog, lineNumber, s.path)
+		}
+		s.state.apply(&rec)
+	}
+}
+
+func (rec *Change) valid() bool {
+	switch rec.Op {
+	case opSaveTask:
+		return rec.Task != nil
+	case opDeleteTask, opDeleteResult:
+		return rec.TaskID != ""
+	case opSaveResult:
+		return rec.Result != nil
+	case opSaveDeadLetter:
+		return rec.DeadLetter != nil && rec.DeadLetter.Task != nil
+	}
+	return false
+}
+
+// compact writes the live state to a new log and replaces the old one with it
+func (s *FileStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create state snapshot: %v", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	records := 0
+	for _, result := range s.state.Results {
+		if err == nil {
+			err = encoder.Encode(&Change{Op: opSaveResult, Result: result})
+			records++
+		}
+	}
+	for _, letter := range s.state.DeadLetters {
+		if err == nil {
+			err = encoder.Encode(&Change{Op: opSaveDeadLetter, DeadLetter: letter})
+			records++
+		}
+	}
+	for _, task := range s.state.Tasks {
+		if err == nil {
+			err = encoder.Encode(&Change{Op: opSaveTask, Task: task})
+			records++
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write state snapshot: %v", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open state log: %v", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.records = records
+	return nil
+}
+
+// append writes a record to the log, syncs it and applies it to the state
+func (s *FileStore) append(rec *Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("store: closed")
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write state log: %v", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync state log: %v", err)
+	}
+
+	s.state.apply(rec)
+	s.records++
+
+	live := len(s.state.Tasks) + len(s.state.Results) + len(s.state.DeadLetters)
+	if s.records > minCompactRecords && s.records > 4*live {
+		return s.compact()
+	}
+	return nil
+}
+
+// SaveTask implements Store
+func (s *FileStore) SaveTask(task *utils.Task) error {
+	return s.append(&Change{Op: opSaveTask, Task: copyTask(task)})
+}
+
+// DeleteTask implements Store
+func (s *FileStore) DeleteTask(taskID string) error {
+	return s.append(&Change{Op: opDeleteTask, TaskID: taskID})
+}
+
+// SaveResult implements Store
+func (s *FileStore) SaveResult(result *utils.TaskResult) error {
+	return s.append(&Change{Op: opSaveResult, Result: copyResult(result)})
+}
+
+// DeleteResult implements Store
+func (s *FileStore) DeleteResult(taskID string) error {
+	return s.append(&Change{Op: opDeleteResult, TaskID: taskID})
+}
+
+// SaveDeadLetter implements Store
+func (s *FileStore) SaveDeadLetter(letter *utils.DeadLetter) error {
+	return s.append(&Change{Op: opSaveDeadLetter, DeadLetter: copyDeadLetter(letter)})
+}
+
+// Load implements Store
+func (s *FileStore) Load() (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.clone(), nil
+}
+
+// Close implements Store
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
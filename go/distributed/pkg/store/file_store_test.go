@@ -0,0 +1,321 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yourusername/distributed/pkg/utils"
+)
+
+// openTestStore opens a file store in a fresh directory and returns it with
+// the path of its log
+func openTestStore(t *testing.T) (*FileStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "master.state")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	return s, path
+}
+
+// reopen closes a file store and opens its log again
+func reopen(t *testing.T, s *FileStore, path string) *FileStore {
+	t.Helper()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func load(t *testing.T, s Store) *State {
+	t.Helper()
+	state, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return state
+}
+
+func testTask(id string) *utils.Task {
+	return &utils.Task{
+		ID:        id,
+		Type:      "echo",
+		Payload:   []byte("payload of " + id),
+		CreatedAt: time.Unix(1700000000, 0).UTC(),
+	}
+}
+
+func testResult(id string) *utils.TaskResult {
+	return &utils.TaskResult{
+		TaskID:         id,
+		Success:        true,
+		Result:         []byte("result of " + id),
+		CompletionTime: time.Unix(1700000100, 0).UTC(),
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	s, path := openTestStore(t)
+
+	for _, id := range []string{"task-1", "task-2", "task-3"} {
+		if err := s.SaveTask(testTask(id)); err != nil {
+			t.Fatalf("SaveTask: %v", err)
+		}
+	}
+	assigned := testTask("task-2")
+	assigned.AssignedTo = 7
+	assigned.Attempts = 2
+	if err := s.SaveTask(assigned); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	if err := s.SaveResult(testResult("task-1")); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+	if err := s.DeleteTask("task-1"); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	letter := &utils.DeadLetter{Task: testTask("task-9"), Reason: "gave up", Time: time.Unix(1700000200, 0).UTC()}
+	if err := s.SaveDeadLetter(letter); err != nil {
+		t.Fatalf("SaveDeadLetter: %v", err)
+	}
+
+	s = reopen(t, s, path)
+	state := load(t, s)
+
+	if len(state.Tasks) != 2 || state.Tasks["task-1"] != nil {
+		t.Fatalf("Expected task-2 and task-3 to survive, got %v", state.Tasks)
+	}
+	got := state.Tasks["task-2"]
+	if got.AssignedTo != 7 || got.Attempts != 2 || string(got.Payload) != "payload of task-2" {
+		t.Errorf("task-2 was not replayed in its last version: %+v", got)
+	}
+	if result := state.Results["task-1"]; result == nil || string(result.Result) != "result of task-1" {
+		t.Errorf("Result of task-1 was not replayed: %+v", result)
+	}
+	if got := state.DeadLetters["task-9"]; got == nil || got.Reason != "gave up" || got.Task.ID != "task-9" {
+		t.Errorf("Dead letter was not replayed: %+v", got)
+	}
+}
+
+func TestFileStoreTornRecord(t *testing.T) {
+	s, path := openTestStore(t)
+	if err := s.SaveTask(testTask("task-1")); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	s.Close()
+
+	// A crash in the middle of a write leaves a last line without a newline
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"save_task","task":{"ID":"task-2","Ty`)
+	f.Close()
+
+	s, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore with a torn last record: %v", err)
+	}
+	defer s.Close()
+	state := load(t, s)
+	if len(state.Tasks) != 1 || state.Tasks["task-1"] == nil {
+		t.Errorf("Expected only task-1, got %v", state.Tasks)
+	}
+
+	// The torn record is gone from the log, so new records are readable
+	if err := s.SaveTask(testTask("task-3")); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	s = reopen(t, s, path)
+	if state := load(t, s); len(state.Tasks) != 2 || state.Tasks["task-3"] == nil {
+		t.Errorf("Expected task-1 and task-3, got %v", state.Tasks)
+	}
+}
+
+func TestFileStoreCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.state")
+	log := "{\"op\":\"save_task\",\"task\":{\"ID\":\"task-1\"}}\n" +
+		"not json\n" +
+		"{\"op\":\"save_task\",\"task\":{\"ID\":\"task-2\"}}\n"
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the last record can be torn; a bad record before it means the
+	// log was damaged and replaying the rest could resurrect stale state
+	if _, err := OpenFileStore(path); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("Expected ErrCorruptLog, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{\"op\":\"save_task\"}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileStore(path); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("Expected ErrCorruptLog for a record without its task, got %v", err)
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	s, path := openTestStore(t)
+	defer func() { s.Close() }()
+
+	// Saving the same task over and over leaves one live record
+	task := testTask("task-1")
+	for i := 0; i < minCompactRecords; i++ {
+		task.Attempts = i
+		if err := s.SaveTask(task); err != nil {
+			t.Fatalf("SaveTask: %v", err)
+		}
+	}
+	if lines := countLines(t, path); lines != minCompactRecords {
+		t.Fatalf("Expected %d records before compaction, got %d", minCompactRecords, lines)
+	}
+
+	task.Attempts = minCompactRecords
+	if err := s.SaveTask(task); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	if lines := countLines(t, path); lines != 1 {
+		t.Errorf("Expected the log to be compacted to 1 record, got %d", lines)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Compaction left its temporary file behind: %v", err)
+	}
+
+	// Records appended after a compaction go to the new log
+	if err := s.SaveTask(testTask("task-2")); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	s = reopen(t, s, path)
+	state := load(t, s)
+	if len(state.Tasks) != 2 || state.Tasks["task-1"].Attempts != minCompactRecords {
+		t.Errorf("Compacted log lost state: %v", state.Tasks)
+	}
+}
+
+func TestFileStoreCompactsOnOpen(t *testing.T) {
+	s, path := openTestStore(t)
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("task-%d", i)
+		if err := s.SaveTask(testTask(id)); err != nil {
+			t.Fatalf("SaveTask: %v", err)
+		}
+		if err := s.DeleteTask(id); err != nil {
+			t.Fatalf("DeleteTask: %v", err)
+		}
+	}
+
+	s = reopen(t, s, path)
+	if lines := countLines(t, path); lines != 0 {
+		t.Errorf("Expected an empty log after reopening, got %d records", lines)
+	}
+	if state := load(t, s); len(state.Tasks) != 0 {
+		t.Errorf("Deleted tasks came back: %v", state.Tasks)
+	}
+}
+
+func TestFileStoreDropsFinishedTasks(t *testing.T) {
+	s, path := openTestStore(t)
+
+	// A master that stops between saving a result and deleting the task
+	// leaves both behind
+	if err := s.SaveTask(testTask("task-1")); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	if err := s.SaveTask(testTask("task-2")); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	if err := s.SaveResult(testResult("task-1")); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+	if state := load(t, s); len(state.Tasks) != 2 {
+		t.Fatalf("Expected both tasks before reopening, got %v", state.Tasks)
+	}
+
+	s = reopen(t, s, path)
+	state := load(t, s)
+	if len(state.Tasks) != 1 || state.Tasks["task-2"] == nil {
+		t.Errorf("Expected only the unfinished task-2, got %v", state.Tasks)
+	}
+	if state.Results["task-1"] == nil {
+		t.Error("The result of task-1 was dropped with its task")
+	}
+}
+
+func TestFileStoreDeleteResult(t *testing.T) {
+	s, path := openTestStore(t)
+
+	letter := &utils.DeadLetter{Task: testTask("task-1"), Reason: "gave up", Time: time.Unix(1700000200, 0).UTC()}
+	if err := s.SaveDeadLetter(letter); err != nil {
+		t.Fatalf("SaveDeadLetter: %v", err)
+	}
+	if err := s.SaveResult(testResult("task-1")); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+	if err := s.SaveResult(testResult("task-2")); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+	if err := s.DeleteResult("task-1"); err != nil {
+		t.Fatalf("DeleteResult: %v", err)
+	}
+
+	for _, st := range []Store{s, reopen(t, s, path)} {
+		state := load(t, st)
+		if len(state.Results) != 1 || state.Results["task-2"] == nil {
+			t.Errorf("Expected only the result of task-2, got %v", state.Results)
+		}
+		if len(state.DeadLetters) != 0 {
+			t.Errorf("Dead letter of task-1 was kept: %v", state.DeadLetters)
+		}
+	}
+}
+
+func TestFileStoreLoadReturnsCopy(t *testing.T) {
+	s, _ := openTestStore(t)
+	defer s.Close()
+
+	task := testTask("task-1")
+	if err := s.SaveTask(task); err != nil {
+		t.Fatalf("SaveTask: %v", err)
+	}
+	task.Payload[0] = 'X'
+	state := load(t, s)
+	state.Tasks["task-1"].Attempts = 42
+
+	if got := load(t, s).Tasks["task-1"]; got.Attempts != 0 || got.Payload[0] == 'X' {
+		t.Errorf("Store shares memory with its callers: %+v", got)
+	}
+}
+
+func TestFileStoreClosed(t *testing.T) {
+	s, _ := openTestStore(t)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Second Close: %v", err)
+	}
+	if err := s.SaveTask(testTask("task-1")); err == nil {
+		t.Error("SaveTask succeeded on a closed store")
+	}
+}
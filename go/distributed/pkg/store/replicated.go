@@ -0,0 +1,188 @@
+package store
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/yourusername/distributed/pkg/utils"
+)
+
+// ErrInvalidChange is returned when applying a change that is malformed
+var ErrInvalidChange = errors.New("store: invalid change")
+
+// Replicated wraps a store and passes every change made through it on to
+// its subscribers. A leading master uses it to stream its state to the
+// other masters.
+type Replicated struct {
+	Store
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]bool
+}
+
+// NewReplicated wraps st
+func NewReplicated(st Store) *Replicated {
+	return &Replicated{
+		Store:       st,
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+// Subscription receives the changes made to a replicated store after it was
+// created
+type Subscription struct {
+	// C delivers the changes in the order they were made
+	C <-chan *Change
+
+	changes chan *Change
+	dropped chan struct{}
+	r       *Replicated
+}
+
+// Subscribe starts a subscription that buffers up to buffer changes. A
+// subscriber that falls further behind is dropped, since it has missed
+// changes and must start over from a fresh snapshot.
+func (r *Replicated) Subscribe(buffer int) *Subscription {
+	changes := make(chan *Change, buffer)
+	sub := &Subscription{
+		C:       changes,
+		changes: changes,
+		dropped: make(chan struct{}),
+		r:       r,
+	}
+
+	r.mu.Lock()
+	r.subscribers[sub] = true
+	r.mu.Unlock()
+	return sub
+}
+
+// Dropped is closed when the subscriber fell behind and was dropped
+func (s *Subscription) Dropped() <-chan struct{} {
+	return s.dropped
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.r.mu.Lock()
+	delete(s.r.subscribers, s)
+	s.r.mu.Unlock()
+}
+
+// publish hands a change to every subscriber without blocking
+func (r *Replicated) publish(change *Change) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for sub := range r.subscribers {
+		select {
+		case sub.changes <- change:
+		default:
+			delete(r.subscribers, sub)
+			close(sub.dropped)
+		}
+	}
+}
+
+// SaveTask implements Store
+func (r *Replicated) SaveTask(task *utils.Task) error {
+	if err := r.Store.SaveTask(task); err != nil {
+		return err
+	}
+	r.publish(&Change{Op: opSaveTask, Task: copyTask(task)})
+	return nil
+}
+
+// DeleteTask implements Store
+func (r *Replicated) DeleteTask(taskID string) error {
+	if err := r.Store.DeleteTask(taskID); err != nil {
+		return err
+	}
+	r.publish(&Change{Op: opDeleteTask, TaskID: taskID})
+	return nil
+}
+
+// SaveResult implements Store
+func (r *Replicated) SaveResult(result *utils.TaskResult) error {
+	if err := r.Store.SaveResult(result); err != nil {
+		return err
+	}
+	r.publish(&Change{Op: opSaveResult, Result: copyResult(result)})
+	return nil
+}
+
+// DeleteResult implements Store
+func (r *Replicated) DeleteResult(taskID string) error {
+	if err := r.Store.DeleteResult(taskID); err != nil {
+		return err
+	}
+	r.publish(&Change{Op: opDeleteResult, TaskID: taskID})
+	return nil
+}
+
+// SaveDeadLetter implements Store
+func (r *Replicated) SaveDeadLetter(letter *utils.DeadLetter) error {
+	if err := r.Store.SaveDeadLetter(letter); err != nil {
+		return err
+	}
+	r.publish(&Change{Op: opSaveDeadLetter, DeadLetter: copyDeadLetter(letter)})
+	return nil
+}
+
+// Apply makes a change received from another store
+func Apply(st Store, change *Change) error {
+	if !change.valid() {
+		return ErrInvalidChange
+	}
+	switch change.Op {
+	case opSaveTask:
+		return st.SaveTask(change.Task)
+	case opDeleteTask:
+		return st.DeleteTask(change.TaskID)
+	case opSaveResult:
+		return st.SaveResult(change.Result)
+	case opDeleteResult:
+		return st.DeleteResult(change.TaskID)
+	default:
+		return st.SaveDeadLetter(change.DeadLetter)
+	}
+}
+
+// Restore makes a store hold the same tasks, results and dead letters as
+// state
+func Restore(st Store, state *State) error {
+	current, err := st.Load()
+	if err != nil {
+		return err
+	}
+	for taskID := range current.Tasks {
+		if _, exists := state.Tasks[taskID]; !exists {
+			if err := st.DeleteTask(taskID); err != nil {
+				return err
+			}
+		}
+	}
+	for taskID := range current.Results {
+		if _, exists := state.Results[taskID]; !exists {
+			if err := st.DeleteResult(taskID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, result := range state.Results {
+		if err := st.SaveResult(result); err != nil {
+			return err
+		}
+	}
+	for _, letter := range state.DeadLetters {
+		if err := st.SaveDeadLetter(letter); err != nil {
+			return err
+		}
+	}
+	for _, task := range state.Tasks {
+		if err := st.SaveTask(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReplicatedPublishesChanges(t *testing.T) {
+	leader := NewReplicated(NewMemoryStore())
+	sub := leader.Subscribe(16)
+	defer sub.Close()
+
+	leader.SaveTask(testTask("task-1"))
+	leader.SaveResult(testResult("task-1"))
+	leader.DeleteTask("task-1")
+	leader.DeleteResult("task-1")
+
+	// A follower applying the changes ends up with the leader's state
+	follower := NewMemoryStore()
+	for i := 0; i < 4; i++ {
+		if err := Apply(follower, <-sub.C); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		if i == 1 {
+			if state := load(t, follower); state.Tasks["task-1"] == nil || state.Results["task-1"] == nil {
+				t.Fatalf("Follower is missing the task or its result: %+v", state)
+			}
+		}
+	}
+	if state := load(t, follower); len(state.Tasks) != 0 || len(state.Results) != 0 {
+		t.Errorf("Follower kept deleted entries: %+v", state)
+	}
+
+	if err := Apply(follower, &Change{Op: opDeleteResult}); !errors.Is(err, ErrInvalidChange) {
+		t.Errorf("Expected ErrInvalidChange, got %v", err)
+	}
+}
+
+func TestReplicatedDropsSlowSubscribers(t *testing.T) {
+	leader := NewReplicated(NewMemoryStore())
+	sub := leader.Subscribe(1)
+	defer sub.Close()
+
+	leader.SaveTask(testTask("task-1"))
+	leader.SaveTask(testTask("task-2"))
+
+	select {
+	case <-sub.Dropped():
+	default:
+		t.Fatal("Subscriber that fell behind was not dropped")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	leader := NewMemoryStore()
+	leader.SaveTask(testTask("task-2"))
+	leader.SaveResult(testResult("task-3"))
+
+	follower := NewMemoryStore()
+	follower.SaveTask(testTask("task-1"))
+	follower.SaveResult(testResult("task-0"))
+
+	if err := Restore(follower, load(t, leader)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	state := load(t, follower)
+	if len(state.Tasks) != 1 || state.Tasks["task-2"] == nil {
+		t.Errorf("Expected only task-2, got %v", state.Tasks)
+	}
+	if len(state.Results) != 1 || state.Results["task-3"] == nil {
+		t.Errorf("Expected only the result of task-3, got %v", state.Results)
+	}
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/yourusername/distributed/pkg/utils"
+)
+
+// Store persists the master's task and result state so that a restarted
+// master can reload the tasks that were still in flight
+type Store interface {
+	// SaveTask creates or replaces a task
+	SaveTask(task *utils.Task) error
+	// DeleteTask removes a task, usually once its result has been saved
+	DeleteTask(taskID string) error
+	// SaveResult records the result of a finished task
+	SaveResult(result *utils.TaskResult) error
+	// DeleteResult forgets a finished task, its result and its dead letter
+	// if it has one, once they have been kept long enough
+	DeleteResult(taskID string) error
+	// SaveDeadLetter records a task that failed permanently
+	SaveDeadLetter(letter *utils.DeadLetter) error
+	// Load returns everything saved so far
+	Load() (*State, error)
+	// Close releases the store
+	Close() error
+}
+
+// State is the content of a store
+type State struct {
+	Tasks       map[string]*utils.Task
+	Results     map[string]*utils.TaskResult
+	DeadLetters map[string]*utils.DeadLetter
+}
+
+func newState() *State {
+	return &State{
+		Tasks:       make(map[string]*utils.Task),
+		Results:     make(map[string]*utils.TaskResult),
+		DeadLetters: make(map[string]*utils.DeadLetter),
+	}
+}
+
+// apply records one change in the state
+func (st *State) apply(rec *Change) {
+	switch rec.Op {
+	case opSaveTask:
+		st.Tasks[rec.Task.ID] = rec.Task
+	case opDeleteTask:
+		delete(st.Tasks, rec.TaskID)
+	case opSaveResult:
+		st.Results[rec.Result.TaskID] = rec.Result
+	case opDeleteResult:
+		delete(st.Results, rec.TaskID)
+		delete(st.DeadLetters, rec.TaskID)
+	case opSaveDeadLetter:
+		st.DeadLetters[rec.DeadLetter.Task.ID] = rec.DeadLetter
+	}
+}
+
+// dropFinished removes tasks that already have a result. They are left
+// behind when the master stops between saving a result and deleting its task.
+func (st *State) dropFinished() {
+	for taskID := range st.Tasks {
+		if _, done := st.Results[taskID]; done {
+			delete(st.Tasks, taskID)
+		}
+	}
+}
+
+// clone returns a copy of the state that shares nothing with the original
+func (st *State) clone() *State {
+	c := newState()
+	for id, task := range st.Tasks {
+		c.Tasks[id] = copyTask(task)
+	}
+	for id, result := range st.Results {
+		c.Results[id] = copyResult(result)
+	}
+	for id, letter := range st.DeadLetters {
+		c.DeadLetters[id] = copyDeadLetter(letter)
+	}
+	return c
+}
+
+func copyTask(task *utils.Task) *utils.Task {
+	c := *task
+	c.Payload = append([]byte(nil), task.Payload...)
+	return &c
+}
+
+func copyResult(result *utils.TaskResult) *utils.TaskResult {
+	c := *result
+	c.Result = append([]byte(nil), result.Result...)
+	return &c
+}
+
+func copyDeadLetter(letter *utils.DeadLetter) *utils.DeadLetter {
+	c := *letter
+	c.Task = copyTask(letter.Task)
+	return &c
+}
+
+// MemoryStore keeps the state in memory. It survives a master being stopped
+// and started again within one process, which is what tests need, but not a
+// process restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	state *State
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: newState()}
+}
+
+// SaveTask implements Store
+func (s *MemoryStore) SaveTask(task *utils.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Tasks[task.ID] = copyTask(task)
+	return nil
+}
+
+// DeleteTask implements Store
+func (s *MemoryStore) DeleteTask(taskID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.state.Tasks, taskID)
+	return nil
+}
+
+// SaveResult implements Store
+func (s *MemoryStore) SaveResult(result *utils.TaskResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Results[result.TaskID] = copyResult(result)
+	return nil
+}
+
+// DeleteResult implements Store
+func (s *MemoryStore) DeleteResult(taskID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.state.Results, taskID)
+	delete(s.state.DeadLetters, taskID)
+	return nil
+}
+
+// SaveDeadLetter implements Store
+func (s *MemoryStore) SaveDeadLetter(letter *utils.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.DeadLetters[letter.Task.ID] = copyDeadLetter(letter)
+	return nil
+}
+
+// Load implements Store
+func (s *MemoryStore) Load() (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.clone(), nil
+}
+
+// Close implements Store
+func (s *MemoryStore) Close() error {
+	return nil
+}
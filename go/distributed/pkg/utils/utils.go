@@ -1,18 +1,41 @@
 package utils
 
 import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"math/rand"
 	"time"
 )
 
+// TaskState is a step in the lifecycle of a task
+type TaskState string
+
+const (
+	TaskPending   TaskState = "pending"
+	TaskAssigned  TaskState = "assigned"
+	TaskRunning   TaskState = "running"
+	TaskSucceeded TaskState = "succeeded"
+	TaskFailed    TaskState = "failed"
+	TaskCancelled TaskState = "cancelled"
+)
+
 // Task represents a job to be processed
 type Task struct {
-	ID       string
-	Type     string
-	Payload  []byte
-	Deadline time.Time
+	ID        string
+	Type      string
+	Payload   []byte
+	Deadline  time.Time
+	CreatedAt time.Time
+	// State is one of the unfinished states: pending, assigned or running
+	State TaskState
+	// AssignedTo is the ID of the slave running the task, or 0 while it waits
+	// to be dispatched
+	AssignedTo int32
+	// Attempts counts how many times the task has been dispatched
+	Attempts int
 }
 
 // TaskResult represents the result of a processed task
@@ -22,6 +45,15 @@ type TaskResult struct {
 	Result         []byte
 	ErrorMessage   string
 	CompletionTime time.Time
+	// State is one of the finished states: succeeded, failed or cancelled
+	State TaskState
+}
+
+// DeadLetter is a task the master gave up on after it failed too often
+type DeadLetter struct {
+	Task   *Task
+	Reason string
+	Time   time.Time
 }
 
 // GenerateRandomID creates a random ID for tasks
@@ -30,8 +62,19 @@ func GenerateRandomID(prefix string) string {
 	return fmt.Sprintf("%s-%d", prefix, rand.Intn(1000000))
 }
 
-// SimulateWork simulates processing time for a task
-func SimulateWork(taskType string) ([]byte, error) {
+// GenerateUniqueID creates an ID that is unique with overwhelming
+// probability, for IDs handed out to clients
+func GenerateUniqueID(prefix string) string {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return fmt.Sprintf("%s-%s", prefix, hex.EncodeToString(b[:]))
+}
+
+// SimulateWork simulates processing time for a task, stopping early when
+// ctx ends
+func SimulateWork(ctx context.Context, taskType string) ([]byte, error) {
 	// Simulate different processing times based on task type
 	var processingTime time.Duration
 
@@ -47,7 +90,13 @@ func SimulateWork(taskType string) ([]byte, error) {
 	}
 
 	log.Printf("Processing task of type '%s' for %v", taskType, processingTime)
-	time.Sleep(processingTime)
+	timer := time.NewTimer(processingTime)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
 	// 10% chance of failure for realistic simulation
 	if rand.Float32() < 0.1 {
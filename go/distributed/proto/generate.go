@@ -0,0 +1,6 @@
+// Package distributed holds the gRPC service the master, slaves and clients
+// talk over. The code is generated from distributed.proto with go generate,
+// which needs protoc, protoc-gen-go and protoc-gen-go-grpc (make deps).
+package distributed
+
+//go:generate protoc --go_out=. --go-grpc_out=. --go_opt=paths=source_relative --go-grpc_opt=paths=source_relative distributed.proto
@@ -12,7 +12,7 @@ make setup
 
 # Start the master server in the background
 echo "Starting master server..."
-go run master/master.go &
+go run ./master &
 MASTER_PID=$!
 
 # Give the master time to start up
@@ -20,11 +20,11 @@ sleep 2
 
 # Start the slave servers in the background
 echo "Starting slave 1..."
-go run slave/slave.go --id=1 --port=5001 &
+go run ./slave --id=1 --port=5001 &
 SLAVE1_PID=$!
 
 echo "Starting slave 2..."
-go run slave/slave.go --id=2 --port=5002 &
+go run ./slave --id=2 --port=5002 &
 SLAVE2_PID=$!
 
 # Wait for a key press
@@ -2,17 +2,24 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/yourusername/distributed/pkg/auth"
+	"github.com/yourusername/distributed/pkg/client"
+	"github.com/yourusername/distributed/pkg/handlers"
 	"github.com/yourusername/distributed/pkg/utils"
 	pb "github.com/yourusername/distributed/proto"
 )
@@ -21,6 +28,11 @@ const (
 	defaultID         = 1
 	defaultPort       = 5001
 	defaultMasterAddr = "localhost:50051"
+	defaultSlots      = 1
+
+	// defaultLeaseTTL is the lease the slave assumes until the master tells
+	// it otherwise. It sends three heartbeats per lease.
+	defaultLeaseTTL = 15 * time.Second
 )
 
 // ActiveTask represents a task currently being processed
@@ -30,21 +42,45 @@ type ActiveTask struct {
 	Deadline   time.Time
 	TaskType   string
 	Processing bool
+	// cancel stops the task's handler by cancelling its context
+	cancel context.CancelFunc
 }
 
 // Slave represents the slave server
 type Slave struct {
 	pb.UnimplementedDistributedSystemServer
-	id            int32
-	address       string
-	port          int32
+	id          int32
+	address     string
+	port        int32
+	status      string
+	load        float64
+	activeTasks map[string]*ActiveTask
+	tasksMutex  sync.RWMutex
+	maxLoad     float64
+	slots       int           // how many tasks the slave runs at once
+	running     int           // handlers holding a slot, guarded by tasksMutex
+	leaseTTL    time.Duration // guarded by tasksMutex
+	registry    *handlers.Registry
+	// stream is the open work stream, or nil while there is none, guarded
+	// by tasksMutex
+	stream *workStream
+	// term is the newest leader term the slave heard of from a master,
+	// guarded by tasksMutex
+	term uint64
+	// authenticator checks that calls to the slave's server come from a
+	// master
+	authenticator *auth.Authenticator
+
+	// masterAddresses lists the masters; the slave works for whichever of
+	// them leads
+	masterAddresses []string
+	dialOpts        []grpc.DialOption
+	// masterAddress, masterConn and masterClient reach the leading master,
+	// guarded by masterMutex
 	masterAddress string
+	masterConn    *grpc.ClientConn
 	masterClient  pb.DistributedSystemClient
-	status        string
-	load          float64
-	activeTasks   map[string]*ActiveTask
-	tasksMutex    sync.RWMutex
-	maxLoad       float64
+	masterMutex   sync.Mutex
 }
 
 // Heartbeat handles heartbeat requests from master
@@ -60,40 +96,78 @@ func (s *Slave) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.He
 func (s *Slave) AssignTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
 	taskID := req.TaskId
 	taskType := req.TaskType
-	deadline := time.Unix(req.Deadline, 0)
+	deadline := time.UnixMilli(req.Deadline)
 
 	log.Printf("Received task assignment: %s (type: %s, deadline: %v)", taskID, taskType, deadline)
 
-	// Check if we can accept more tasks
-	s.tasksMutex.RLock()
-	currentLoad := s.load
-	s.tasksMutex.RUnlock()
+	// Check if we know how to run the task
+	if _, exists := s.registry.Lookup(taskType); !exists {
+		log.Printf("Rejecting task %s: unknown task type %q", taskID, taskType)
+		return &pb.TaskResponse{
+			TaskId:   taskID,
+			Accepted: false,
+			Message: fmt.Sprintf("Unknown task type %q, supported types: %s",
+				taskType, strings.Join(s.registry.Types(), ", ")),
+		}, nil
+	}
 
-	if currentLoad >= s.maxLoad {
-		log.Printf("Rejecting task %s: load too high (%.2f/%.2f)", taskID, currentLoad, s.maxLoad)
+	// Turn away a master that was deposed, even if it does not know yet
+	if !s.observeTerm(req.Term) {
+		log.Printf("Rejecting task %s: it comes from a master of the stale term %d", taskID, req.Term)
 		return &pb.TaskResponse{
 			TaskId:   taskID,
 			Accepted: false,
-			Message:  fmt.Sprintf("Load too high: %.2f/%.2f", currentLoad, s.maxLoad),
+			Message:  fmt.Sprintf("Stale master term %d", req.Term),
 		}, nil
 	}
 
-	// Accept and process the task
+	// Accept and process the task. The handler runs under a context that
+	// ends at the deadline or when the master cancels the task.
+	taskCtx, cancel := context.WithCancel(context.Background())
+	if req.Deadline > 0 {
+		taskCtx, cancel = context.WithDeadline(context.Background(), deadline)
+	}
 	task := &ActiveTask{
 		TaskID:     taskID,
 		StartTime:  time.Now(),
 		Deadline:   deadline,
 		TaskType:   taskType,
 		Processing: true,
+		cancel:     cancel,
 	}
 
+	// Check if we can accept more tasks and take the slot under the same
+	// lock, so concurrent assignments cannot overbook the slave
 	s.tasksMutex.Lock()
+	running := s.running
+	currentLoad := s.load
+	if running >= s.slots {
+		s.tasksMutex.Unlock()
+		cancel()
+		log.Printf("Rejecting task %s: no free slots (%d/%d)", taskID, running, s.slots)
+		return &pb.TaskResponse{
+			TaskId:   taskID,
+			Accepted: false,
+			Message:  fmt.Sprintf("No free slots: %d/%d", running, s.slots),
+		}, nil
+	}
+	if currentLoad >= s.maxLoad {
+		s.tasksMutex.Unlock()
+		cancel()
+		log.Printf("Rejecting task %s: load too high (%.2f/%.2f)", taskID, currentLoad, s.maxLoad)
+		return &pb.TaskResponse{
+			TaskId:   taskID,
+			Accepted: false,
+			Message:  fmt.Sprintf("Load too high: %.2f/%.2f", currentLoad, s.maxLoad),
+		}, nil
+	}
 	s.activeTasks[taskID] = task
+	s.running++
 	s.load += 0.1 // Increase the load
 	s.tasksMutex.Unlock()
 
 	// Process the task in a goroutine
-	go s.processTask(task, req.Payload)
+	go s.processTask(taskCtx, task, req.Payload)
 
 	return &pb.TaskResponse{
 		TaskId:   taskID,
@@ -122,44 +196,147 @@ func (s *Slave) CompleteTask(ctx context.Context, req *pb.TaskResult) (*pb.TaskA
 	}, nil
 }
 
+// CancelTask handles task cancellation requests from master
+func (s *Slave) CancelTask(ctx context.Context, req *pb.CancelTaskRequest) (*pb.CancelTaskResponse, error) {
+	if !s.observeTerm(req.Term) {
+		log.Printf("Not cancelling task %s for a master of the stale term %d", req.TaskId, req.Term)
+		return &pb.CancelTaskResponse{
+			TaskId:  req.TaskId,
+			Success: false,
+			Message: fmt.Sprintf("Stale master term %d", req.Term),
+		}, nil
+	}
+
+	s.tasksMutex.RLock()
+	task, exists := s.activeTasks[req.TaskId]
+	s.tasksMutex.RUnlock()
+
+	if !exists {
+		return &pb.CancelTaskResponse{
+			TaskId:  req.TaskId,
+			Success: false,
+			Message: fmt.Sprintf("Task %s is not running", req.TaskId),
+		}, nil
+	}
+
+	log.Printf("Cancelling task %s", req.TaskId)
+	task.cancel()
+	return &pb.CancelTaskResponse{
+		TaskId:  req.TaskId,
+		Success: true,
+		Message: "Task cancelled",
+	}, nil
+}
+
 // processTask handles the actual processing of a task
-func (s *Slave) processTask(task *ActiveTask, payload []byte) {
+func (s *Slave) processTask(ctx context.Context, task *ActiveTask, payload []byte) {
+	defer task.cancel()
+
 	log.Printf("Processing task %s of type %s", task.TaskID, task.TaskType)
 
-	// Simulate work
-	result, err := utils.SimulateWork(task.TaskType)
-	success := err == nil
+	type handlerResult struct {
+		result []byte
+		err    error
+	}
+	done := make(chan handlerResult, 1)
+	go func() {
+		result, err := s.runHandler(ctx, task.TaskType, payload)
+		done <- handlerResult{result, err}
+
+		// The slot stays taken until the handler returns, even if the
+		// task was reported already
+		s.tasksMutex.Lock()
+		s.running--
+		s.load -= 0.1 // Decrease the load
+		if s.load < 0 {
+			s.load = 0
+		}
+		s.tasksMutex.Unlock()
+	}()
+
+	var result []byte
+	var err error
+	select {
+	case r := <-done:
+		result, err = r.result, r.err
+	case <-ctx.Done():
+		// Report right away instead of waiting for a handler that ignores
+		// its context; its slot is freed once it returns
+		err = ctx.Err()
+		log.Printf("Abandoning task %s: %v", task.TaskID, err)
+	}
+
+	status := pb.ResultStatus_RESULT_STATUS_SUCCEEDED
 	errorMessage := ""
 	if err != nil {
 		errorMessage = err.Error()
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			status = pb.ResultStatus_RESULT_STATUS_DEADLINE_EXCEEDED
+		case errors.Is(ctx.Err(), context.Canceled):
+			status = pb.ResultStatus_RESULT_STATUS_CANCELLED
+		default:
+			status = pb.ResultStatus_RESULT_STATUS_FAILED
+		}
 	}
 
-	// Report task completion to master
-	s.reportTaskCompletion(task.TaskID, success, result, errorMessage)
-
-	// Update local state
+	// Update local state before reporting, so a registration racing with
+	// the report does not claim the finished task again. The master may
+	// already have handed the same task to this slave again, so only remove
+	// this attempt.
 	s.tasksMutex.Lock()
-	delete(s.activeTasks, task.TaskID)
-	s.load -= 0.1 // Decrease the load
-	if s.load < 0 {
-		s.load = 0
+	if s.activeTasks[task.TaskID] == task {
+		delete(s.activeTasks, task.TaskID)
 	}
 	s.tasksMutex.Unlock()
+
+	// Report task completion to master
+	s.reportTaskCompletion(task.TaskID, status, result, errorMessage)
 }
 
-// reportTaskCompletion sends task results back to master
-func (s *Slave) reportTaskCompletion(taskID string, success bool, result []byte, errorMessage string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// runHandler runs the registered handler for a task type, turning a panic
+// in the handler into an error
+func (s *Slave) runHandler(ctx context.Context, taskType string, payload []byte) (result []byte, err error) {
+	handler, exists := s.registry.Lookup(taskType)
+	if !exists {
+		return nil, fmt.Errorf("unknown task type %q", taskType)
+	}
 
-	_, err := s.masterClient.CompleteTask(ctx, &pb.TaskResult{
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = fmt.Errorf("handler for task type %q panicked: %v", taskType, r)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// reportTaskCompletion sends task results back to master, preferably
+// over the work stream if there is one
+func (s *Slave) reportTaskCompletion(taskID string, status pb.ResultStatus, result []byte, errorMessage string) {
+	req := &pb.TaskResult{
+		SlaveId:        s.id,
 		TaskId:         taskID,
-		Success:        success,
+		Success:        status == pb.ResultStatus_RESULT_STATUS_SUCCEEDED,
 		Result:         result,
 		ErrorMessage:   errorMessage,
 		CompletionTime: time.Now().Unix(),
-	})
+		Status:         status,
+	}
+
+	if stream := s.currentStream(); stream != nil {
+		err := stream.send(&pb.SlaveMessage{Message: &pb.SlaveMessage_Result{Result: req}})
+		if err == nil {
+			log.Printf("Sent completion of task %s over the work stream", taskID)
+			return
+		}
+		log.Printf("Failed to send task completion over the work stream: %v", err)
+	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.master().CompleteTask(ctx, req)
 	if err != nil {
 		log.Printf("Failed to report task completion to master: %v", err)
 	} else {
@@ -167,16 +344,71 @@ func (s *Slave) reportTaskCompletion(taskID string, success bool, result []byte,
 	}
 }
 
+// master returns the client of the leading master
+func (s *Slave) master() pb.DistributedSystemClient {
+	s.masterMutex.Lock()
+	defer s.masterMutex.Unlock()
+	return s.masterClient
+}
+
+// connectToLeader finds the leading master and connects to it, unless the
+// slave is connected to it already
+func (s *Slave) connectToLeader() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	address, err := client.FindLeader(ctx, s.masterAddresses, s.dialOpts...)
+	if err != nil {
+		return err
+	}
+
+	s.masterMutex.Lock()
+	defer s.masterMutex.Unlock()
+
+	if s.masterConn != nil && address == s.masterAddress {
+		return nil
+	}
+	conn, err := grpc.Dial(address, s.dialOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to master: %v", err)
+	}
+	if s.masterConn != nil {
+		log.Printf("Switching from master at %s to the leader at %s", s.masterAddress, address)
+		s.masterConn.Close()
+	}
+	s.masterAddress = address
+	s.masterConn = conn
+	s.masterClient = pb.NewDistributedSystemClient(conn)
+	return nil
+}
+
+// registerRequest describes this slave to the master
+func (s *Slave) registerRequest() *pb.RegisterRequest {
+	// Report the tasks still running so a restarted master can match them
+	// with its recovered state
+	s.tasksMutex.RLock()
+	activeTasks := make([]string, 0, len(s.activeTasks))
+	for taskID := range s.activeTasks {
+		activeTasks = append(activeTasks, taskID)
+	}
+	s.tasksMutex.RUnlock()
+
+	return &pb.RegisterRequest{
+		SlaveId:     s.id,
+		Address:     s.address,
+		Port:        s.port,
+		ActiveTasks: activeTasks,
+		TaskTypes:   s.registry.Types(),
+		Slots:       int32(s.slots),
+	}
+}
+
 // registerWithMaster attempts to register this slave with the master
 func (s *Slave) registerWithMaster() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	resp, err := s.masterClient.RegisterSlave(ctx, &pb.RegisterRequest{
-		SlaveId: s.id,
-		Address: s.address,
-		Port:    s.port,
-	})
+	resp, err := s.master().RegisterSlave(ctx, s.registerRequest())
 
 	if err != nil {
 		return fmt.Errorf("failed to register with master: %v", err)
@@ -186,49 +418,222 @@ func (s *Slave) registerWithMaster() error {
 		return fmt.Errorf("master rejected registration: %s", resp.Message)
 	}
 
+	if !s.observeTerm(resp.Term) {
+		return fmt.Errorf("master leads the stale term %d", resp.Term)
+	}
+
 	log.Printf("Successfully registered with master: %s", resp.Message)
+	s.setLeaseTTL(resp.LeaseTtlMs)
+	return nil
+}
+
+// observeTerm records the leader term of a master the slave heard from and
+// reports whether that master is current. A master of an older term than
+// the newest the slave heard of was deposed.
+func (s *Slave) observeTerm(term uint64) bool {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	if term < s.term {
+		return false
+	}
+	s.term = term
+	return true
+}
+
+// setLeaseTTL records the lease duration the master granted, in milliseconds
+func (s *Slave) setLeaseTTL(ms int64) {
+	if ms <= 0 {
+		return
+	}
+	s.tasksMutex.Lock()
+	s.leaseTTL = time.Duration(ms) * time.Millisecond
+	s.tasksMutex.Unlock()
+}
+
+// sendHeartbeats renews the slave's lease with the master three times per
+// lease, and registers again when the master no longer knows the slave,
+// which happens when the master restarted, evicted it or failed over
+func (s *Slave) sendHeartbeats() {
+	for {
+		time.Sleep(s.heartbeatInterval())
+
+		if err := s.sendHeartbeat(); err != nil {
+			log.Printf("Failed to send heartbeat to master: %v", err)
+			// Another master may have taken over; the next heartbeat
+			// registers with it
+			if err := s.connectToLeader(); err != nil {
+				log.Printf("Failed to find the leading master: %v", err)
+			}
+		}
+	}
+}
+
+// heartbeatInterval returns how often the slave sends heartbeats: three
+// times per lease
+func (s *Slave) heartbeatInterval() time.Duration {
+	s.tasksMutex.RLock()
+	defer s.tasksMutex.RUnlock()
+	return s.leaseTTL / 3
+}
+
+// heartbeatRequest describes the slave's load to the master
+func (s *Slave) heartbeatRequest() *pb.HeartbeatRequest {
+	s.tasksMutex.RLock()
+	defer s.tasksMutex.RUnlock()
+
+	return &pb.HeartbeatRequest{
+		Timestamp:   time.Now().Unix(),
+		SlaveId:     s.id,
+		Status:      s.status,
+		Load:        s.load,
+		ActiveTasks: int32(s.running),
+	}
+}
+
+// sendHeartbeat reports the slave's load to the master once
+func (s *Slave) sendHeartbeat() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := s.master().Heartbeat(ctx, s.heartbeatRequest())
+	if err != nil {
+		return err
+	}
+
+	if !s.observeTerm(resp.Term) {
+		return fmt.Errorf("master leads the stale term %d", resp.Term)
+	}
+	if !resp.Registered {
+		log.Printf("Master does not know this slave, registering again")
+		return s.registerWithMaster()
+	}
+	s.setLeaseTTL(resp.LeaseTtlMs)
 	return nil
 }
 
-// startServer starts the gRPC server for this slave
-func startServer(id int32, port int32, masterAddress string) {
+// registerSimulatedHandlers registers handlers for the "fast", "medium" and
+// "slow" task types that sleep for a while and fail now and then, for trying
+// out the system without writing handlers
+func registerSimulatedHandlers(registry *handlers.Registry) {
+	for _, taskType := range []string{"fast", "medium", "slow"} {
+		taskType := taskType
+		registry.Register(taskType, func(ctx context.Context, payload []byte) ([]byte, error) {
+			return utils.SimulateWork(ctx, taskType)
+		})
+	}
+}
+
+// Config holds the slave's settings
+type Config struct {
+	ID   int32
+	Port int32
+	// MasterAddresses lists the masters; with several, the slave works for
+	// whichever leads
+	MasterAddresses []string
+	// Slots is how many tasks the slave runs at once
+	Slots int
+	// UseStream makes the slave connect to the master over a work stream
+	// instead of serving tasks on Port
+	UseStream bool
+	// TLS, if set, encrypts the connection to the master and holds the
+	// certificate the slave identifies itself with
+	TLS *tls.Config
+	// ServerTLS, if set, encrypts the slave's own server, which then only
+	// accepts the master's certificate
+	ServerTLS *tls.Config
+	// AuthSecret, if set, is the shared secret the slave signs its tokens
+	// with
+	AuthSecret []byte
+}
+
+// newServer creates the gRPC server the master sends tasks to, encrypted
+// with serverTLS if it is set. With a secret or TLS, only callers that
+// authenticate as a master get through.
+func (s *Slave) newServer(serverTLS *tls.Config) *grpc.Server {
+	var opts []grpc.ServerOption
+	if s.authenticator.Enabled() {
+		opts = append(opts, grpc.UnaryInterceptor(s.authUnaryInterceptor))
+	}
+	if serverTLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(serverTLS)))
+	}
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterDistributedSystemServer(grpcServer, s)
+	return grpcServer
+}
+
+// authUnaryInterceptor turns away calls that do not authenticate as a master
+func (s *Slave) authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authenticator.AuthorizeMasterToSlave(ctx); err != nil {
+		log.Printf("Rejecting call to %s: %v", info.FullMethod, err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// startServer connects this slave to the master. Over a work stream it
+// only dials the master; otherwise it starts a gRPC server for the master
+// to send tasks to.
+func startServer(config Config, registry *handlers.Registry) {
 	// Prepare the slave object
 	slave := &Slave{
-		id:            id,
-		address:       "localhost", // In a real system, this would be determined dynamically
-		port:          port,
-		masterAddress: masterAddress,
-		status:        "starting",
-		load:          0.0,
-		activeTasks:   make(map[string]*ActiveTask),
-		maxLoad:       1.0, // Maximum load this slave can handle
+		id:              config.ID,
+		address:         "localhost", // In a real system, this would be determined dynamically
+		port:            config.Port,
+		status:          "starting",
+		load:            0.0,
+		activeTasks:     make(map[string]*ActiveTask),
+		maxLoad:         1.0, // Maximum load this slave can handle
+		slots:           config.Slots,
+		leaseTTL:        defaultLeaseTTL,
+		registry:        registry,
+		masterAddresses: config.MasterAddresses,
+		authenticator: &auth.Authenticator{
+			Secret:      config.AuthSecret,
+			RequireCert: config.ServerTLS != nil,
+		},
 	}
 
 	// Connect to the master
-	conn, err := grpc.Dial(masterAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("Failed to connect to master: %v", err)
+	creds := insecure.NewCredentials()
+	if config.TLS != nil {
+		creds = credentials.NewTLS(config.TLS)
 	}
-	defer conn.Close()
-
-	slave.masterClient = pb.NewDistributedSystemClient(conn)
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if config.AuthSecret != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(
+			auth.NewTokenCredentials(config.AuthSecret, config.ID, config.TLS != nil)))
+	}
+	slave.dialOpts = opts
 	slave.status = "active"
 
+	if config.UseStream {
+		log.Printf("Slave %d connecting to master at %s over a work stream",
+			config.ID, strings.Join(config.MasterAddresses, ", "))
+		slave.streamWork()
+		return
+	}
+
+	if err := slave.connectToLeader(); err != nil {
+		log.Fatalf("Failed to connect to master: %v", err)
+	}
+
 	// Start the gRPC server
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterDistributedSystemServer(grpcServer, slave)
+	grpcServer := slave.newServer(config.ServerTLS)
 
 	// Register with master before serving
 	if err := slave.registerWithMaster(); err != nil {
 		log.Fatalf("Failed to register with master: %v", err)
 	}
 
-	log.Printf("Slave %d started on port %d and registered with master at %s", id, port, masterAddress)
+	go slave.sendHeartbeats()
+
+	log.Printf("Slave %d started on port %d and registered with master at %s", config.ID, config.Port, slave.masterAddress)
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
@@ -240,8 +645,54 @@ func main() {
 
 	id := flag.Int("id", defaultID, "The ID of this slave")
 	port := flag.Int("port", defaultPort, "The server port for this slave")
-	masterAddr := flag.String("master", defaultMasterAddr, "The master server address")
+	masterAddr := flag.String("master", defaultMasterAddr, "The master server address, or a comma-separated list of masters to work for whichever leads")
+	simulate := flag.Bool("simulate", true, "Register the simulated fast, medium and slow task types")
+	slots := flag.Int("slots", defaultSlots, "How many tasks this slave runs at once")
+	stream := flag.Bool("stream", false, "Connect to the master over a work stream instead of serving tasks on --port")
+	tlsCA := flag.String("tls-ca", "", "CA certificate that the master's certificate must be signed by (TLS is off if empty)")
+	tlsCert := flag.String("tls-cert", "", "Certificate this slave presents, issued for the common name slave-<id>")
+	tlsKey := flag.String("tls-key", "", "Private key of --tls-cert")
+	secretFile := flag.String("auth-secret-file", "", "File with the shared secret this slave signs its tokens with")
 	flag.Parse()
 
-	startServer(int32(*id), int32(*port), *masterAddr)
+	if *id < 1 {
+		log.Fatalf("--id must be at least 1")
+	}
+	if *slots < 1 {
+		log.Fatalf("--slots must be at least 1")
+	}
+	if *simulate {
+		registerSimulatedHandlers(handlers.Default)
+	}
+	if len(handlers.Default.Types()) == 0 {
+		log.Fatalf("No task handlers registered")
+	}
+
+	config := Config{
+		ID:              int32(*id),
+		Port:            int32(*port),
+		MasterAddresses: strings.Split(*masterAddr, ","),
+		Slots:           *slots,
+		UseStream:       *stream,
+	}
+	if *tlsCA != "" || *tlsCert != "" || *tlsKey != "" {
+		var err error
+		if config.TLS, err = auth.ClientTLSConfig(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		if config.ServerTLS, err = auth.ServerTLSConfig(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		// Only the master may send the slave tasks, not any holder of a
+		// certificate from the CA
+		auth.RequireClientName(config.ServerTLS, auth.MasterName)
+	}
+	if *secretFile != "" {
+		var err error
+		if config.AuthSecret, err = auth.LoadSecret(*secretFile); err != nil {
+			log.Fatalf("Failed to load auth secret: %v", err)
+		}
+	}
+
+	startServer(config, handlers.Default)
 }
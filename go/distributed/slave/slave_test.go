@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/yourusername/distributed/pkg/auth"
+	"github.com/yourusername/distributed/pkg/handlers"
+	pb "github.com/yourusername/distributed/proto"
+)
+
+// fakeMaster is the master as a slave without a work stream sees it. It
+// records the results the slave reports.
+type fakeMaster struct {
+	pb.DistributedSystemClient
+	results chan *pb.TaskResult
+}
+
+func (f *fakeMaster) CompleteTask(ctx context.Context, req *pb.TaskResult, opts ...grpc.CallOption) (*pb.TaskAck, error) {
+	f.results <- req
+	return &pb.TaskAck{TaskId: req.TaskId, Received: true}, nil
+}
+
+// newTestSlave creates a slave with the given slots that runs tasks with
+// the handlers in registry and reports them to the returned fake master
+func newTestSlave(registry *handlers.Registry, slots int) (*Slave, *fakeMaster) {
+	master := &fakeMaster{results: make(chan *pb.TaskResult, 16)}
+	return &Slave{
+		id:           1,
+		status:       "active",
+		activeTasks:  make(map[string]*ActiveTask),
+		maxLoad:      1.0,
+		slots:        slots,
+		leaseTTL:     defaultLeaseTTL,
+		registry:     registry,
+		masterClient: master,
+	}, master
+}
+
+// assign sends a task to the slave and fails the test unless it accepts
+func assign(t *testing.T, s *Slave, req *pb.TaskRequest) {
+	t.Helper()
+	resp, err := s.AssignTask(context.Background(), req)
+	if err != nil || !resp.Accepted {
+		t.Fatalf("Task %s was not accepted: %v %v", req.TaskId, resp, err)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// nextResult waits for the slave to report a task
+func nextResult(t *testing.T, master *fakeMaster) *pb.TaskResult {
+	t.Helper()
+	select {
+	case result := <-master.results:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("The slave did not report the task")
+		return nil
+	}
+}
+
+func TestAssignTaskRoutesByType(t *testing.T) {
+	registry := handlers.NewRegistry()
+	registry.Register("upper", func(ctx context.Context, payload []byte) ([]byte, error) {
+		return []byte("UPPER:" + string(payload)), nil
+	})
+	registry.Register("fail", func(ctx context.Context, payload []byte) ([]byte, error) {
+		return nil, errors.New("bad input")
+	})
+	registry.Register("panic", func(ctx context.Context, payload []byte) ([]byte, error) {
+		panic("oops")
+	})
+	s, master := newTestSlave(registry, 3)
+
+	resp, err := s.AssignTask(context.Background(), &pb.TaskRequest{TaskId: "task-0", TaskType: "resize"})
+	if err != nil || resp.Accepted {
+		t.Errorf("Task of an unknown type was accepted: %v %v", resp, err)
+	}
+
+	assign(t, s, &pb.TaskRequest{TaskId: "task-1", TaskType: "upper", Payload: []byte("hi")})
+	result := nextResult(t, master)
+	if !result.Success || result.Status != pb.ResultStatus_RESULT_STATUS_SUCCEEDED || string(result.Result) != "UPPER:hi" {
+		t.Errorf("Expected the upper handler's result, got %v", result)
+	}
+
+	assign(t, s, &pb.TaskRequest{TaskId: "task-2", TaskType: "fail"})
+	result = nextResult(t, master)
+	if result.Success || result.Status != pb.ResultStatus_RESULT_STATUS_FAILED || result.ErrorMessage != "bad input" {
+		t.Errorf("Expected the fail handler's error, got %v", result)
+	}
+
+	// A panicking handler fails its task instead of the slave
+	assign(t, s, &pb.TaskRequest{TaskId: "task-3", TaskType: "panic"})
+	result = nextResult(t, master)
+	if result.Success || result.Status != pb.ResultStatus_RESULT_STATUS_FAILED {
+		t.Errorf("Expected the panic to fail the task, got %v", result)
+	}
+
+	if types := s.registerRequest().TaskTypes; len(types) != 3 {
+		t.Errorf("Slave should register its 3 task types, got %v", types)
+	}
+}
+
+// blockingRegistry has a "wait" handler that runs until its context ends
+// and a "stuck" handler that ignores its context until release is closed
+func blockingRegistry(release chan struct{}) *handlers.Registry {
+	registry := handlers.NewRegistry()
+	registry.Register("wait", func(ctx context.Context, payload []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	registry.Register("stuck", func(ctx context.Context, payload []byte) ([]byte, error) {
+		<-release
+		return []byte("too late"), nil
+	})
+	return registry
+}
+
+// slotsInUse returns how many slots the slave's handlers hold
+func slotsInUse(s *Slave) int {
+	s.tasksMutex.RLock()
+	defer s.tasksMutex.RUnlock()
+	return s.running
+}
+
+func TestDeadlineStopsTask(t *testing.T) {
+	release := make(chan struct{})
+	s, master := newTestSlave(blockingRegistry(release), 2)
+
+	deadline := time.Now().Add(200 * time.Millisecond).UnixMilli()
+	assign(t, s, &pb.TaskRequest{TaskId: "task-1", TaskType: "wait", Deadline: deadline})
+	assign(t, s, &pb.TaskRequest{TaskId: "task-2", TaskType: "stuck", Deadline: deadline})
+
+	// A handler that ignores its context is reported at the deadline too
+	for i := 0; i < 2; i++ {
+		result := nextResult(t, master)
+		if result.Success || result.Status != pb.ResultStatus_RESULT_STATUS_DEADLINE_EXCEEDED {
+			t.Errorf("Expected %s to exceed its deadline, got %v", result.TaskId, result)
+		}
+		if now := time.Now().UnixMilli(); now < deadline {
+			t.Errorf("Task %s was stopped %dms before its deadline", result.TaskId, deadline-now)
+		}
+	}
+
+	// but keeps its slot until it returns
+	waitFor(t, "the stopped tasks to leave", func() bool {
+		s.tasksMutex.RLock()
+		defer s.tasksMutex.RUnlock()
+		return len(s.activeTasks) == 0 && s.running == 1
+	})
+	assign(t, s, &pb.TaskRequest{TaskId: "task-3", TaskType: "wait"})
+	if resp, err := s.AssignTask(context.Background(), &pb.TaskRequest{TaskId: "task-4", TaskType: "wait"}); err != nil || resp.Accepted {
+		t.Errorf("Slave accepted a task into the slot of a running handler: %v %v", resp, err)
+	}
+
+	close(release)
+	waitFor(t, "the stuck handler to return", func() bool { return slotsInUse(s) == 1 })
+	assign(t, s, &pb.TaskRequest{TaskId: "task-4", TaskType: "wait"})
+	for _, taskID := range []string{"task-3", "task-4"} {
+		s.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: taskID})
+		nextResult(t, master)
+	}
+}
+
+func TestCancelTaskStopsTask(t *testing.T) {
+	release := make(chan struct{})
+	s, master := newTestSlave(blockingRegistry(release), 2)
+
+	resp, err := s.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: "task-1"})
+	if err != nil || resp.Success {
+		t.Errorf("Cancelling a task that does not run succeeded: %v %v", resp, err)
+	}
+
+	assign(t, s, &pb.TaskRequest{TaskId: "task-1", TaskType: "wait"})
+	assign(t, s, &pb.TaskRequest{TaskId: "task-2", TaskType: "stuck"})
+	for _, taskID := range []string{"task-1", "task-2"} {
+		resp, err := s.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: taskID})
+		if err != nil || !resp.Success {
+			t.Fatalf("CancelTask %s failed: %v %v", taskID, resp, err)
+		}
+		result := nextResult(t, master)
+		if result.TaskId != taskID || result.Success || result.Status != pb.ResultStatus_RESULT_STATUS_CANCELLED {
+			t.Errorf("Expected %s to be cancelled, got %v", taskID, result)
+		}
+	}
+
+	// The cancelled task whose handler ignores its context holds its slot
+	// until the handler returns
+	waitFor(t, "the cancelled handler to return", func() bool { return slotsInUse(s) == 1 })
+	close(release)
+	waitFor(t, "the stuck handler to return", func() bool { return slotsInUse(s) == 0 })
+
+	// The freed slots take new tasks
+	assign(t, s, &pb.TaskRequest{TaskId: "task-3", TaskType: "wait"})
+	assign(t, s, &pb.TaskRequest{TaskId: "task-4", TaskType: "wait"})
+	if resp, err := s.AssignTask(context.Background(), &pb.TaskRequest{TaskId: "task-5", TaskType: "wait"}); err != nil || resp.Accepted {
+		t.Errorf("Slave with no free slots accepted a task: %v %v", resp, err)
+	}
+	for _, taskID := range []string{"task-3", "task-4"} {
+		s.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: taskID})
+		nextResult(t, master)
+	}
+}
+
+func TestAssignTaskDoesNotOverbook(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	s, master := newTestSlave(blockingRegistry(release), 2)
+
+	var wg sync.WaitGroup
+	accepted := make(chan string, 20)
+	for i := 0; i < 20; i++ {
+		taskID := fmt.Sprintf("task-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.AssignTask(context.Background(), &pb.TaskRequest{TaskId: taskID, TaskType: "wait"})
+			if err == nil && resp.Accepted {
+				accepted <- taskID
+			}
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+
+	if len(accepted) != 2 {
+		t.Errorf("Slave with 2 slots accepted %d tasks", len(accepted))
+	}
+	for taskID := range accepted {
+		s.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: taskID})
+		nextResult(t, master)
+	}
+}
+
+func TestStaleTermRejected(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	s, master := newTestSlave(blockingRegistry(release), 2)
+
+	assign(t, s, &pb.TaskRequest{TaskId: "task-1", TaskType: "wait", Term: 5})
+
+	// A master still acting in an older term was deposed
+	resp, err := s.AssignTask(context.Background(), &pb.TaskRequest{TaskId: "task-2", TaskType: "wait", Term: 4})
+	if err != nil || resp.Accepted {
+		t.Errorf("Task from a deposed master was accepted: %v %v", resp, err)
+	}
+	cancelResp, err := s.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: "task-1", Term: 4})
+	if err != nil || cancelResp.Success {
+		t.Errorf("Deposed master cancelled a task: %v %v", cancelResp, err)
+	}
+
+	// The current master and its successors are obeyed
+	cancelResp, err = s.CancelTask(context.Background(), &pb.CancelTaskRequest{TaskId: "task-1", Term: 6})
+	if err != nil || !cancelResp.Success {
+		t.Fatalf("CancelTask failed: %v %v", cancelResp, err)
+	}
+	if result := nextResult(t, master); result.Status != pb.ResultStatus_RESULT_STATUS_CANCELLED {
+		t.Errorf("Expected task-1 to be cancelled, got %v", result)
+	}
+	resp, err = s.AssignTask(context.Background(), &pb.TaskRequest{TaskId: "task-3", TaskType: "wait", Term: 5})
+	if err != nil || resp.Accepted {
+		t.Errorf("Task from the master of term 5 was accepted after term 6: %v %v", resp, err)
+	}
+}
+
+func TestServerRequiresMasterToken(t *testing.T) {
+	secret := []byte("secret")
+	s, _ := newTestSlave(handlers.NewRegistry(), 1)
+	s.authenticator = &auth.Authenticator{Secret: secret}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := s.newServer(nil)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	cancelTask := func(creds credentials.PerRPCCredentials) error {
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		if creds != nil {
+			opts = append(opts, grpc.WithPerRPCCredentials(creds))
+		}
+		conn, err := grpc.Dial(lis.Addr().String(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, err = pb.NewDistributedSystemClient(conn).CancelTask(context.Background(),
+			&pb.CancelTaskRequest{TaskId: "task-1"})
+		return err
+	}
+
+	if err := cancelTask(auth.NewTokenCredentials(secret, auth.MasterID, false)); err != nil {
+		t.Fatalf("Call with a master token was rejected: %v", err)
+	}
+	tests := []struct {
+		name  string
+		creds credentials.PerRPCCredentials
+	}{
+		{"no token", nil},
+		{"token signed with another secret", auth.NewTokenCredentials([]byte("other"), auth.MasterID, false)},
+		{"slave token", auth.NewTokenCredentials(secret, 2, false)},
+	}
+	for _, tt := range tests {
+		if got := status.Code(cancelTask(tt.creds)); got != codes.Unauthenticated {
+			t.Errorf("%s: got %v, want %v", tt.name, got, codes.Unauthenticated)
+		}
+	}
+}
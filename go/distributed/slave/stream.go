@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "github.com/yourusername/distributed/proto"
+)
+
+// reconnectDelay is how long the slave waits before it opens a new work
+// stream after the last one broke
+const reconnectDelay = 1 * time.Second
+
+// workStream is the slave's end of a work stream to the master
+type workStream struct {
+	stream    pb.DistributedSystem_WorkStreamClient
+	sendMutex sync.Mutex // gRPC streams do not allow concurrent sends
+}
+
+// send sends a message to the master
+func (w *workStream) send(msg *pb.SlaveMessage) error {
+	w.sendMutex.Lock()
+	defer w.sendMutex.Unlock()
+	return w.stream.Send(msg)
+}
+
+// currentStream returns the open work stream, or nil if there is none
+func (s *Slave) currentStream() *workStream {
+	s.tasksMutex.RLock()
+	defer s.tasksMutex.RUnlock()
+	return s.stream
+}
+
+func (s *Slave) setStream(stream *workStream) {
+	s.tasksMutex.Lock()
+	s.stream = stream
+	s.tasksMutex.Unlock()
+}
+
+// sendStreamHeartbeats renews the slave's lease over a work stream until
+// ctx ends. The master answers on the stream.
+func (s *Slave) sendStreamHeartbeats(ctx context.Context, ws *workStream) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.heartbeatInterval()):
+		}
+
+		err := ws.send(&pb.SlaveMessage{
+			Message: &pb.SlaveMessage_Heartbeat{Heartbeat: s.heartbeatRequest()},
+		})
+		if err != nil {
+			log.Printf("Failed to send heartbeat over the work stream: %v", err)
+			return
+		}
+	}
+}
+
+// streamWork keeps a work stream to the leading master open, opening a new
+// one and registering again whenever it breaks. The new stream may go to
+// another master if the leader changed.
+func (s *Slave) streamWork() {
+	for {
+		err := s.connectToLeader()
+		if err == nil {
+			err = s.serveWorkStream()
+		}
+		log.Printf("Work stream to master ended: %v. Reconnecting in %v", err, reconnectDelay)
+		time.Sleep(reconnectDelay)
+	}
+}
+
+// serveWorkStream opens a work stream, registers over it and runs the tasks
+// the master sends until the stream breaks
+func (s *Slave) serveWorkStream() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := s.master().WorkStream(ctx)
+	if err != nil {
+		return err
+	}
+	ws := &workStream{stream: stream}
+
+	err = ws.send(&pb.SlaveMessage{
+		Message: &pb.SlaveMessage_Register{Register: s.registerRequest()},
+	})
+	if err != nil {
+		return err
+	}
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	resp := msg.GetRegisterResponse()
+	if resp == nil {
+		return errors.New("master did not answer the registration")
+	}
+	if !resp.Success {
+		return fmt.Errorf("master rejected registration: %s", resp.Message)
+	}
+	if !s.observeTerm(resp.Term) {
+		return fmt.Errorf("master leads the stale term %d", resp.Term)
+	}
+
+	log.Printf("Registered with master over a work stream: %s", resp.Message)
+	s.setLeaseTTL(resp.LeaseTtlMs)
+	s.setStream(ws)
+	defer s.setStream(nil)
+	go s.sendStreamHeartbeats(ctx, ws)
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch msg := msg.Message.(type) {
+		case *pb.MasterMessage_Task:
+			resp, _ := s.AssignTask(ctx, msg.Task)
+			err = ws.send(&pb.SlaveMessage{
+				Message: &pb.SlaveMessage_TaskResponse{TaskResponse: resp},
+			})
+		case *pb.MasterMessage_Cancel:
+			s.CancelTask(ctx, msg.Cancel)
+		case *pb.MasterMessage_HeartbeatResponse:
+			if !msg.HeartbeatResponse.Registered {
+				return errors.New("master does not know this slave")
+			}
+			if !s.observeTerm(msg.HeartbeatResponse.Term) {
+				return fmt.Errorf("master leads the stale term %d", msg.HeartbeatResponse.Term)
+			}
+			s.setLeaseTTL(msg.HeartbeatResponse.LeaseTtlMs)
+		case *pb.MasterMessage_Ack:
+			if !msg.Ack.Received {
+				log.Printf("Master did not accept the result of task %s", msg.Ack.TaskId)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/yourusername/distributed/pkg/auth"
+	"github.com/yourusername/distributed/pkg/client"
+	pb "github.com/yourusername/distributed/proto"
+)
+
+const (
+	defaultMasterAddr = "localhost:50051"
+	defaultTaskType   = "fast"
+)
+
+func main() {
+	masterAddr := flag.String("master", defaultMasterAddr, "The master server address, or a comma-separated list of masters to submit to whichever leads")
+	taskType := flag.String("type", defaultTaskType, "The type of the task")
+	payload := flag.String("payload", "", "The task payload; read from stdin if it is -")
+	timeout := flag.Duration("timeout", 5*time.Minute, "How long to wait for the result")
+	noWait := flag.Bool("no-wait", false, "Print the task ID and exit without waiting for the result")
+	tlsCA := flag.String("tls-ca", "", "CA certificate that the master's certificate must be signed by (TLS is off if empty)")
+	flag.Parse()
+
+	data := []byte(*payload)
+	if *payload == "-" {
+		var err error
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			log.Fatalf("Failed to read payload: %v", err)
+		}
+	}
+
+	var opts []grpc.DialOption
+	if *tlsCA != "" {
+		config, err := auth.ClientTLSConfig("", "", *tlsCA)
+		if err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	leader, err := client.FindLeader(ctx, strings.Split(*masterAddr, ","), opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := client.Dial(leader, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	taskID, err := c.Submit(ctx, *taskType, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *noWait {
+		fmt.Println(taskID)
+		return
+	}
+	log.Printf("Submitted task %s, waiting for its result", taskID)
+
+	status, err := c.Wait(ctx, taskID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	state := strings.ToLower(strings.TrimPrefix(status.State.String(), "TASK_STATE_"))
+	if status.State != pb.TaskState_TASK_STATE_SUCCEEDED {
+		log.Fatalf("Task %s %s: %s", taskID, state, status.ErrorMessage)
+	}
+	os.Stdout.Write(status.Result)
+	if len(status.Result) > 0 && status.Result[len(status.Result)-1] != '\n' {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,136 @@
+package lockfreequeue
+
+import (
+	"context"
+)
+
+// BoundedQueue is a fixed-capacity queue built on top of LockFreeQueue.
+// Producers block (or fail fast with TryEnqueue) once the queue is full,
+// which gives callers backpressure instead of unbounded memory growth.
+//
+// Blocked goroutines are parked by the runtime rather than spinning: free
+// slots and ready items are tracked by two buffered channels acting as
+// counting semaphores.
+type BoundedQueue[T any] struct {
+	queue *LockFreeQueue[T]
+	slots chan struct{} // one token per occupied slot, capacity == queue capacity
+	items chan struct{} // one token per element that is ready to be dequeued
+}
+
+// NewBoundedQueue creates a bounded queue that holds at most capacity elements.
+// It panics if capacity is not positive.
+func NewBoundedQueue[T any](capacity int) *BoundedQueue[T] {
+	if capacity <= 0 {
+		panic("lockfreequeue: capacity must be positive")
+	}
+	return &BoundedQueue[T]{
+		queue: NewLockFreeQueue[T](),
+		slots: make(chan struct{}, capacity),
+		items: make(chan struct{}, capacity),
+	}
+}
+
+// TryEnqueue adds an element to the end of the queue without blocking.
+// It returns false if the queue is full.
+func (b *BoundedQueue[T]) TryEnqueue(value T) bool {
+	select {
+	case b.slots <- struct{}{}:
+	default:
+		return false
+	}
+	b.push(value)
+	return true
+}
+
+// Enqueue adds an element to the end of the queue, blocking while the queue
+// is full. It returns ctx.Err() if the context is done before a slot frees up.
+func (b *BoundedQueue[T]) Enqueue(ctx context.Context, value T) error {
+	// Fail fast on an already cancelled context even if a slot is free.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.push(value)
+	return nil
+}
+
+// TryDequeue removes and returns the element at the front of the queue without
+// blocking. It returns the zero value of T and false if the queue is empty.
+func (b *BoundedQueue[T]) TryDequeue() (T, bool) {
+	select {
+	case <-b.items:
+	default:
+		var zeroValue T
+		return zeroValue, false
+	}
+	return b.pop(), true
+}
+
+// Dequeue removes and returns the element at the front of the queue, blocking
+// while the queue is empty. It returns ctx.Err() if the context is done before
+// an element becomes available.
+func (b *BoundedQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	var zeroValue T
+
+	if err := ctx.Err(); err != nil {
+		return zeroValue, err
+	}
+
+	select {
+	case <-b.items:
+	case <-ctx.Done():
+		return zeroValue, ctx.Err()
+	}
+	return b.pop(), nil
+}
+
+// Peek returns the value at the front of the queue without removing it.
+// It returns the zero value of T and false if the queue is empty.
+//
+// Like TryDequeue, it only reports an element once its item token has been
+// published, so a value a producer has linked in but not yet published is
+// never observed.
+func (b *BoundedQueue[T]) Peek() (T, bool) {
+	if len(b.items) == 0 {
+		var zeroValue T
+		return zeroValue, false
+	}
+	return b.queue.Peek()
+}
+
+// Size returns the number of elements that are ready to be dequeued.
+func (b *BoundedQueue[T]) Size() int {
+	return len(b.items)
+}
+
+// IsEmpty returns true if no elements are ready to be dequeued.
+func (b *BoundedQueue[T]) IsEmpty() bool {
+	return b.Size() == 0
+}
+
+// Cap returns the maximum number of elements the queue can hold.
+func (b *BoundedQueue[T]) Cap() int {
+	return cap(b.slots)
+}
+
+// push links the value into the underlying queue once a slot has been reserved
+// and then publishes it to consumers.
+func (b *BoundedQueue[T]) push(value T) {
+	b.queue.Enqueue(value)
+	b.items <- struct{}{} // never blocks: items holds at most cap(slots) tokens
+}
+
+// pop removes a value from the underlying queue once an item token has been
+// taken and then releases its slot to producers.
+func (b *BoundedQueue[T]) pop() T {
+	// An item token is only published after its value has been linked in,
+	// so the underlying queue cannot be empty here.
+	value, _ := b.queue.Dequeue()
+	<-b.slots
+	return value
+}
@@ -0,0 +1,266 @@
+package lockfreequeue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBoundedQueue_BasicOperations(t *testing.T) {
+	queue := NewBoundedQueue[int](2)
+
+	if queue.Cap() != 2 {
+		t.Errorf("Expected capacity 2, got %d", queue.Cap())
+	}
+	if !queue.IsEmpty() {
+		t.Error("New queue should be empty")
+	}
+
+	if !queue.TryEnqueue(1) {
+		t.Error("TryEnqueue should succeed on empty queue")
+	}
+	if !queue.TryEnqueue(2) {
+		t.Error("TryEnqueue should succeed below capacity")
+	}
+	if queue.TryEnqueue(3) {
+		t.Error("TryEnqueue should fail on full queue")
+	}
+	if queue.Size() != 2 {
+		t.Errorf("Queue should have size 2, got %d", queue.Size())
+	}
+
+	val, ok := queue.Peek()
+	if !ok || val != 1 {
+		t.Errorf("Peek should return 1, got %d (ok=%v)", val, ok)
+	}
+
+	// Verify FIFO order
+	for i := 1; i <= 2; i++ {
+		val, ok := queue.TryDequeue()
+		if !ok {
+			t.Errorf("TryDequeue #%d should succeed", i)
+		}
+		if val != i {
+			t.Errorf("Expected %d, got %d", i, val)
+		}
+	}
+
+	if _, ok := queue.TryDequeue(); ok {
+		t.Error("TryDequeue should fail on empty queue")
+	}
+	if !queue.TryEnqueue(3) {
+		t.Error("TryEnqueue should succeed after slots are freed")
+	}
+}
+
+func TestBoundedQueue_PeekIgnoresUnpublished(t *testing.T) {
+	queue := NewBoundedQueue[int](2)
+
+	// Link a value in without publishing its item token, as a producer
+	// between the two steps of push would
+	queue.slots <- struct{}{}
+	queue.queue.Enqueue(1)
+
+	if _, ok := queue.Peek(); ok {
+		t.Error("Peek returned a value that was not published yet")
+	}
+	if _, ok := queue.TryDequeue(); ok {
+		t.Error("TryDequeue returned a value that was not published yet")
+	}
+
+	queue.items <- struct{}{}
+	if value, ok := queue.Peek(); !ok || value != 1 {
+		t.Errorf("Expected Peek to return 1 once published, got %d, %v", value, ok)
+	}
+}
+
+func TestBoundedQueue_InvalidCapacity(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewBoundedQueue should panic on zero capacity")
+		}
+	}()
+	NewBoundedQueue[int](0)
+}
+
+func TestBoundedQueue_EnqueueBlocksWhenFull(t *testing.T) {
+	queue := NewBoundedQueue[int](1)
+	queue.TryEnqueue(1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- queue.Enqueue(context.Background(), 2)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Enqueue should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if val, err := queue.Dequeue(context.Background()); err != nil || val != 1 {
+		t.Fatalf("Expected 1, got %d (err=%v)", val, err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Enqueue should succeed once a slot frees up, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue was not woken up after a slot freed up")
+	}
+
+	if val, ok := queue.TryDequeue(); !ok || val != 2 {
+		t.Errorf("Expected 2, got %d (ok=%v)", val, ok)
+	}
+}
+
+func TestBoundedQueue_DequeueBlocksWhenEmpty(t *testing.T) {
+	queue := NewBoundedQueue[int](1)
+
+	done := make(chan int, 1)
+	go func() {
+		val, err := queue.Dequeue(context.Background())
+		if err != nil {
+			t.Errorf("Dequeue failed unexpectedly: %v", err)
+		}
+		done <- val
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Dequeue should block while the queue is empty")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	queue.TryEnqueue(42)
+
+	select {
+	case val := <-done:
+		if val != 42 {
+			t.Errorf("Expected 42, got %d", val)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dequeue was not woken up after an enqueue")
+	}
+}
+
+func TestBoundedQueue_Cancellation(t *testing.T) {
+	queue := NewBoundedQueue[int](1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := queue.Dequeue(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Dequeue on empty queue should time out, got %v", err)
+	}
+
+	queue.TryEnqueue(1)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := queue.Enqueue(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Enqueue on full queue should time out, got %v", err)
+	}
+
+	// A cancelled context fails fast even when the operation could proceed.
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if _, err := queue.Dequeue(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Dequeue with cancelled context should fail, got %v", err)
+	}
+
+	// Cancelled operations must not leak slots or items.
+	if queue.Size() != 1 {
+		t.Errorf("Queue should still have size 1, got %d", queue.Size())
+	}
+	if val, ok := queue.TryDequeue(); !ok || val != 1 {
+		t.Errorf("Expected 1, got %d (ok=%v)", val, ok)
+	}
+	if !queue.TryEnqueue(3) {
+		t.Error("Slot should be available after cancelled enqueue")
+	}
+}
+
+func TestBoundedQueue_StressTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stress test in short mode")
+	}
+
+	queue := NewBoundedQueue[int](16)
+	const iterations = 10000
+	const workerCount = 4
+
+	var enqueueDone int64
+	var dequeueDone int64
+	var maxSize int64
+	var consumed sync.Map
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+
+	wg.Add(workerCount)
+	for i := 0; i < workerCount; i++ {
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				if err := queue.Enqueue(ctx, id*iterations+j); err != nil {
+					t.Errorf("Enqueue failed unexpectedly: %v", err)
+					return
+				}
+				atomic.AddInt64(&enqueueDone, 1)
+
+				// Track the largest size observed to verify the bound holds.
+				size := int64(queue.Size())
+				for {
+					current := atomic.LoadInt64(&maxSize)
+					if size <= current || atomic.CompareAndSwapInt64(&maxSize, current, size) {
+						break
+					}
+				}
+			}
+		}(i)
+	}
+
+	wg.Add(workerCount)
+	for i := 0; i < workerCount; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				val, err := queue.Dequeue(ctx)
+				if err != nil {
+					t.Errorf("Dequeue failed unexpectedly: %v", err)
+					return
+				}
+				consumed.Store(val, true)
+				atomic.AddInt64(&dequeueDone, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	expectedOps := int64(workerCount * iterations)
+	if atomic.LoadInt64(&enqueueDone) != expectedOps {
+		t.Errorf("Expected %d enqueues, got %d", expectedOps, atomic.LoadInt64(&enqueueDone))
+	}
+	if atomic.LoadInt64(&dequeueDone) != expectedOps {
+		t.Errorf("Expected %d dequeues, got %d", expectedOps, atomic.LoadInt64(&dequeueDone))
+	}
+	if maxSize > int64(queue.Cap()) {
+		t.Errorf("Queue size exceeded capacity: %d > %d", maxSize, queue.Cap())
+	}
+	for w := 0; w < workerCount; w++ {
+		for i := 0; i < iterations; i++ {
+			val := w*iterations + i
+			if _, exists := consumed.Load(val); !exists {
+				t.Errorf("Item %d was not consumed", val)
+			}
+		}
+	}
+	if !queue.IsEmpty() {
+		t.Errorf("Queue should be empty, got size %d", queue.Size())
+	}
+}
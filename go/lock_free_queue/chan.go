@@ -0,0 +1,83 @@
+package lockfreequeue
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// minPollInterval and maxPollInterval bound the exponential backoff
+	// ToChan uses while the queue is empty.
+	minPollInterval = 10 * time.Microsecond
+	maxPollInterval = time.Millisecond
+)
+
+// ToChan starts a goroutine that dequeues elements from q and sends them on the
+// returned channel in FIFO order until ctx is done, after which the channel is
+// closed. The goroutine becomes the consumer of q, so for single-consumer
+// queues no other goroutine may dequeue while it runs.
+//
+// The queue has no way to signal new elements, so while it is empty the
+// goroutine polls it with an exponential backoff of up to maxPollInterval.
+//
+// The goroutine dequeues an element before it waits for a receiver, so when
+// ctx is done it may hold one element that nobody received. That element is
+// dropped: putting it back would reorder q and make the goroutine a producer,
+// which single-producer queues do not allow. The elements after it stay in q
+// in order, so a caller that cannot lose elements should stop receiving only
+// once q is empty, or not cancel ctx while an element may be in flight.
+func ToChan[T any](ctx context.Context, q Queue[T]) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+
+		timer := time.NewTimer(minPollInterval)
+		defer timer.Stop()
+		backoff := minPollInterval
+
+		for {
+			value, ok := q.Dequeue()
+			if ok {
+				backoff = minPollInterval
+				select {
+				case out <- value:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			// Queue is empty, wait a bit before polling again.
+			timer.Reset(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
+			}
+			backoff *= 2
+			if backoff > maxPollInterval {
+				backoff = maxPollInterval
+			}
+		}
+	}()
+
+	return out
+}
+
+// FromChan enqueues every value received from ch into q until ch is closed,
+// in which case it returns nil, or until ctx is done, in which case it returns
+// ctx.Err(). It blocks the calling goroutine, which becomes a producer of q.
+func FromChan[T any](ctx context.Context, q Queue[T], ch <-chan T) error {
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			q.Enqueue(value)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package lockfreequeue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestToChan(t *testing.T) {
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			queue := impl.newQueue(100)
+			for i := 0; i < 50; i++ {
+				queue.Enqueue(i)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ch := ToChan(ctx, queue)
+
+			for i := 0; i < 50; i++ {
+				if val := <-ch; val != i {
+					t.Fatalf("Expected %d, got %d", i, val)
+				}
+			}
+
+			// Elements enqueued later are picked up by polling
+			go func() {
+				time.Sleep(5 * time.Millisecond)
+				queue.Enqueue(50)
+			}()
+			select {
+			case val := <-ch:
+				if val != 50 {
+					t.Errorf("Expected 50, got %d", val)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Element enqueued later was not delivered")
+			}
+
+			// Cancelling closes the channel
+			cancel()
+			select {
+			case _, ok := <-ch:
+				if ok {
+					t.Error("Channel should be closed after cancellation")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Channel was not closed after cancellation")
+			}
+		})
+	}
+}
+
+func TestToChanCancelDropsAtMostOne(t *testing.T) {
+	queue := NewLockFreeQueue[int]()
+	for i := 0; i < 10; i++ {
+		queue.Enqueue(i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := ToChan(ctx, queue)
+	for i := 0; i < 3; i++ {
+		if val := <-ch; val != i {
+			t.Fatalf("Expected %d, got %d", i, val)
+		}
+	}
+
+	// Wait until the goroutine holds the next element, then cancel while it
+	// waits for a receiver
+	deadline := time.Now().Add(time.Second)
+	for queue.Size() != 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Goroutine did not dequeue the next element, size %d", queue.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	next := 3
+	for val := range ch {
+		if val != next {
+			t.Fatalf("Expected %d, got %d", next, val)
+		}
+		next++
+	}
+
+	// Only the element the goroutine held can be gone, the rest are still
+	// queued in order
+	front, ok := queue.Peek()
+	if !ok || (front != next && front != next+1) {
+		t.Fatalf("Expected %d or %d at the front, got %d (ok=%v)", next, next+1, front, ok)
+	}
+	for expected := front; expected < 10; expected++ {
+		if val, ok := queue.Dequeue(); !ok || val != expected {
+			t.Fatalf("Expected %d, got %d (ok=%v)", expected, val, ok)
+		}
+	}
+	if !queue.IsEmpty() {
+		t.Error("Queue should be empty")
+	}
+}
+
+func TestFromChan(t *testing.T) {
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			queue := impl.newQueue(100)
+			ch := make(chan int)
+
+			go func() {
+				for i := 0; i < 50; i++ {
+					ch <- i
+				}
+				close(ch)
+			}()
+
+			if err := FromChan(context.Background(), queue, ch); err != nil {
+				t.Fatalf("FromChan should return nil when the channel is closed, got %v", err)
+			}
+			for i := 0; i < 50; i++ {
+				if val, ok := queue.Dequeue(); !ok || val != i {
+					t.Fatalf("Expected %d, got %d (ok=%v)", i, val, ok)
+				}
+			}
+
+			// Cancellation unblocks a FromChan waiting on an idle channel
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if err := FromChan(ctx, queue, make(chan int)); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected deadline exceeded, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChanRoundTrip(t *testing.T) {
+	queue := NewLockFreeQueue[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan int)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+	go FromChan(ctx, queue, in)
+
+	out := ToChan(ctx, queue)
+	for i := 0; i < 1000; i++ {
+		if val := <-out; val != i {
+			t.Fatalf("Expected %d, got %d", i, val)
+		}
+	}
+}
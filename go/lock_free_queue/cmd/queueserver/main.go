@@ -0,0 +1,34 @@
+// Command queueserver serves named lock-free queues over TCP. Clients connect
+// with the lockfreequeue/queueserver package.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"lockfreequeue/queueserver"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:7070", "TCP address to listen on")
+	maxQueues := flag.Int("max-queues", queueserver.DefaultMaxQueues, "Maximum number of queues clients can create")
+	flag.Parse()
+
+	server := queueserver.NewServer(queueserver.WithMaxQueues(*maxQueues))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Printf("Shutting down")
+		server.Close()
+	}()
+
+	log.Printf("Queue server listening on %s", *addr)
+	if err := server.ListenAndServe(*addr); err != nil && err != queueserver.ErrServerClosed {
+		log.Fatalf("Queue server failed: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package lockfreequeue
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells a DelayQueue what time it is. Tests inject a fake clock to step
+// through delays and expiry deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock used when none is injected.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// DelayOption configures a DelayQueue.
+type DelayOption[T any] func(*delayOptions[T])
+
+// delayOptions collects the settings applied by DelayOption values.
+type delayOptions[T any] struct {
+	clock    Clock
+	onExpire func(value T)
+}
+
+// WithClock makes the queue read the time from clock instead of time.Now.
+func WithClock[T any](clock Clock) DelayOption[T] {
+	return func(o *delayOptions[T]) {
+		o.clock = clock
+	}
+}
+
+// WithExpiryCallback sets a function that is called with every element whose
+// TTL runs out before it is dequeued. It runs on the goroutine that notices
+// the expiry, inside Dequeue, Peek or Expire.
+func WithExpiryCallback[T any](onExpire func(value T)) DelayOption[T] {
+	return func(o *delayOptions[T]) {
+		o.onExpire = onExpire
+	}
+}
+
+// Claim states of a delayItem. Both indexes of a DelayQueue may hold the same
+// item, and whichever claims it first decides its fate.
+const (
+	delayItemPending int32 = iota
+	delayItemDequeued
+	delayItemExpired
+)
+
+// delayItem is an element of a DelayQueue.
+type delayItem[T any] struct {
+	value     T
+	readyAt   time.Time
+	expiresAt time.Time // zero if the element never expires
+	state     int32     // atomic, one of the delayItem* states
+
+	// readyNode and expiryNode are the item's nodes in the two indexes, so
+	// that whoever claims the item can delete it from both.
+	readyNode  atomic.Pointer[pqNode[time.Time, *delayItem[T]]]
+	expiryNode atomic.Pointer[pqNode[time.Time, *delayItem[T]]]
+}
+
+// expired reports whether the item has a TTL that ran out by now.
+func (it *delayItem[T]) expired(now time.Time) bool {
+	return !it.expiresAt.IsZero() && !now.Before(it.expiresAt)
+}
+
+func compareTime(a, b time.Time) int {
+	return a.Compare(b)
+}
+
+// DelayQueue holds elements that only become visible to Dequeue once their
+// ready time has passed, and that may expire if nobody dequeues them in time.
+// Elements come out in order of ready time, and elements with the same ready
+// time in the order they were enqueued.
+//
+// It is built on two lock-free PriorityQueues: one ordered by ready time that
+// Dequeue takes from, and one ordered by expiry time for elements with a TTL.
+// An element in both is claimed with a CAS, so it is either dequeued or
+// expired, never both, and whoever claims it deletes it from both indexes.
+// Elements are never popped and pushed back, so they keep their place among
+// elements with the same time.
+//
+// Expiry is noticed lazily, when an expired element reaches the front of the
+// queue or when Expire is called; call Expire periodically if the expiry
+// callback has to run promptly while no one is dequeuing.
+type DelayQueue[T any] struct {
+	ready    *PriorityQueue[time.Time, *delayItem[T]]
+	expiry   *PriorityQueue[time.Time, *delayItem[T]]
+	clock    Clock
+	onExpire func(value T)
+	size     int64 // atomic count of pending elements
+}
+
+// NewDelayQueue creates an empty delay queue.
+func NewDelayQueue[T any](opts ...DelayOption[T]) *DelayQueue[T] {
+	options := delayOptions[T]{clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &DelayQueue[T]{
+		ready:    NewPriorityQueue[time.Time, *delayItem[T]](compareTime),
+		expiry:   NewPriorityQueue[time.Time, *delayItem[T]](compareTime),
+		clock:    options.clock,
+		onExpire: options.onExpire,
+	}
+}
+
+// Enqueue adds an element that is visible immediately and never expires.
+func (q *DelayQueue[T]) Enqueue(value T) {
+	q.push(&delayItem[T]{value: value, readyAt: q.clock.Now()})
+}
+
+// EnqueueAt adds an element that becomes visible at the given time.
+func (q *DelayQueue[T]) EnqueueAt(value T, at time.Time) {
+	q.push(&delayItem[T]{value: value, readyAt: at})
+}
+
+// EnqueueAfter adds an element that becomes visible after the given delay.
+func (q *DelayQueue[T]) EnqueueAfter(value T, delay time.Duration) {
+	q.EnqueueAt(value, q.clock.Now().Add(delay))
+}
+
+// EnqueueWithTTL adds an element that is visible immediately and expires if
+// it has not been dequeued within ttl.
+func (q *DelayQueue[T]) EnqueueWithTTL(value T, ttl time.Duration) {
+	q.EnqueueAtWithTTL(value, q.clock.Now(), ttl)
+}
+
+// EnqueueAtWithTTL adds an element that becomes visible at the given time and
+// expires if it has not been dequeued within ttl after that.
+func (q *DelayQueue[T]) EnqueueAtWithTTL(value T, at time.Time, ttl time.Duration) {
+	q.push(&delayItem[T]{value: value, readyAt: at, expiresAt: at.Add(ttl)})
+}
+
+func (q *DelayQueue[T]) push(item *delayItem[T]) {
+	atomic.AddInt64(&q.size, 1)
+	if !item.expiresAt.IsZero() {
+		item.expiryNode.Store(q.expiry.push(item.expiresAt, item))
+	}
+	item.readyNode.Store(q.ready.push(item.readyAt, item))
+
+	// The item may have been claimed through one index before its node in
+	// the other was recorded; the claimer could not delete that node then.
+	if atomic.LoadInt32(&item.state) != delayItemPending {
+		q.unlink(item)
+	}
+}
+
+// unlink deletes a claimed item from both indexes.
+func (q *DelayQueue[T]) unlink(item *delayItem[T]) {
+	if node := item.readyNode.Load(); node != nil {
+		q.ready.delete(node)
+	}
+	if node := item.expiryNode.Load(); node != nil {
+		q.expiry.delete(node)
+	}
+}
+
+// Dequeue removes and returns the element with the earliest ready time, if
+// that time has passed. It returns the zero value of T and false if no
+// element is ready. Expired elements found on the way are handed to the
+// expiry callback.
+func (q *DelayQueue[T]) Dequeue() (T, bool) {
+	for {
+		item, ok := q.peekReady(q.clock.Now())
+		if !ok {
+			var zeroValue T
+			return zeroValue, false
+		}
+		if atomic.CompareAndSwapInt32(&item.state, delayItemPending, delayItemDequeued) {
+			atomic.AddInt64(&q.size, -1)
+			q.unlink(item)
+			return item.value, true
+		}
+		// Another Dequeue or Expire claimed it first; peekReady drops it.
+	}
+}
+
+// Peek returns the element Dequeue would return next without removing it.
+// It returns the zero value of T and false if no element is ready.
+func (q *DelayQueue[T]) Peek() (T, bool) {
+	item, ok := q.peekReady(q.clock.Now())
+	if !ok {
+		var zeroValue T
+		return zeroValue, false
+	}
+	return item.value, true
+}
+
+// peekReady returns the front of the ready index if it is due at now, first
+// discarding items at the front that were already claimed or have expired.
+func (q *DelayQueue[T]) peekReady(now time.Time) (*delayItem[T], bool) {
+	for {
+		node := q.ready.peekMinNode()
+		if node == nil || node.key.After(now) {
+			return nil, false
+		}
+		item := node.value
+		switch {
+		case atomic.LoadInt32(&item.state) != delayItemPending:
+			// The claimer deletes it too, but may not have got to it yet.
+			q.ready.delete(node)
+		case item.expired(now):
+			q.expire(item)
+		default:
+			return item, true
+		}
+	}
+}
+
+// Expire hands every element whose TTL has run out to the expiry callback
+// and returns how many there were.
+func (q *DelayQueue[T]) Expire() int {
+	count := 0
+	for {
+		node := q.expiry.peekMinNode()
+		if node == nil || node.key.After(q.clock.Now()) {
+			return count
+		}
+		if q.expire(node.value) {
+			count++
+		} else {
+			q.expiry.delete(node)
+		}
+	}
+}
+
+// expire claims item as expired, deletes it from both indexes and runs the
+// expiry callback. It returns false if the item was already claimed.
+func (q *DelayQueue[T]) expire(item *delayItem[T]) bool {
+	if !atomic.CompareAndSwapInt32(&item.state, delayItemPending, delayItemExpired) {
+		return false
+	}
+	atomic.AddInt64(&q.size, -1)
+	q.unlink(item)
+	if q.onExpire != nil {
+		q.onExpire(item.value)
+	}
+	return true
+}
+
+// NextReady returns the ready time of the earliest pending element, so a
+// consumer knows how long it can sleep. It returns false if the queue is
+// empty.
+func (q *DelayQueue[T]) NextReady() (time.Time, bool) {
+	for {
+		node := q.ready.peekMinNode()
+		if node == nil {
+			return time.Time{}, false
+		}
+		if atomic.LoadInt32(&node.value.state) == delayItemPending {
+			return node.key, true
+		}
+		// Claimed but not deleted yet, drop it so it no longer hides the
+		// real front.
+		q.ready.delete(node)
+	}
+}
+
+// Size returns the number of pending elements, including those that are not
+// ready yet. An element whose TTL ran out is counted until the expiry has
+// been noticed.
+func (q *DelayQueue[T]) Size() int {
+	size := atomic.LoadInt64(&q.size)
+	if size < 0 {
+		return 0
+	}
+	return int(size)
+}
+
+// IsEmpty returns true if the queue holds no pending elements. A non-empty
+// queue may still have nothing ready to dequeue.
+func (q *DelayQueue[T]) IsEmpty() bool {
+	return q.Size() == 0
+}
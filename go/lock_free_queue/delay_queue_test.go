@@ -0,0 +1,262 @@
+package lockfreequeue
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when the test advances it.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestDelayQueue_Delay(t *testing.T) {
+	clock := newFakeClock()
+	queue := NewDelayQueue(WithClock[string](clock))
+
+	queue.EnqueueAfter("late", 2*time.Second)
+	queue.EnqueueAt("early", clock.Now().Add(time.Second))
+	queue.Enqueue("now")
+
+	if queue.Size() != 3 {
+		t.Errorf("Queue should have size 3, got %d", queue.Size())
+	}
+	if val, ok := queue.Dequeue(); !ok || val != "now" {
+		t.Errorf("Expected now, got %q (ok=%v)", val, ok)
+	}
+	if _, ok := queue.Dequeue(); ok {
+		t.Error("Dequeue should fail while nothing is ready")
+	}
+	if _, ok := queue.Peek(); ok {
+		t.Error("Peek should fail while nothing is ready")
+	}
+	if next, ok := queue.NextReady(); !ok || !next.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("NextReady: expected %v, got %v (ok=%v)", clock.Now().Add(time.Second), next, ok)
+	}
+	if queue.IsEmpty() {
+		t.Error("Queue with delayed elements should not be empty")
+	}
+
+	clock.Advance(time.Second)
+	if val, ok := queue.Peek(); !ok || val != "early" {
+		t.Errorf("Peek: expected early, got %q (ok=%v)", val, ok)
+	}
+	if val, ok := queue.Dequeue(); !ok || val != "early" {
+		t.Errorf("Expected early, got %q (ok=%v)", val, ok)
+	}
+
+	clock.Advance(time.Hour)
+	if val, ok := queue.Dequeue(); !ok || val != "late" {
+		t.Errorf("Expected late, got %q (ok=%v)", val, ok)
+	}
+	if !queue.IsEmpty() {
+		t.Errorf("Queue should be empty, size %d", queue.Size())
+	}
+	if _, ok := queue.NextReady(); ok {
+		t.Error("NextReady on empty queue should return false")
+	}
+}
+
+func TestDelayQueue_SameReadyTimeFIFO(t *testing.T) {
+	clock := newFakeClock()
+	queue := NewDelayQueue(WithClock[int](clock))
+
+	at := clock.Now().Add(time.Minute)
+	for i := 0; i < 10; i++ {
+		queue.EnqueueAt(i, at)
+	}
+	clock.Advance(time.Minute)
+
+	for i := 0; i < 10; i++ {
+		if val, ok := queue.Dequeue(); !ok || val != i {
+			t.Fatalf("Expected %d, got %d (ok=%v)", i, val, ok)
+		}
+	}
+}
+
+func TestDelayQueue_TTL(t *testing.T) {
+	clock := newFakeClock()
+	var expired []string
+	queue := NewDelayQueue(
+		WithClock[string](clock),
+		WithExpiryCallback(func(value string) { expired = append(expired, value) }),
+	)
+
+	queue.EnqueueWithTTL("short", time.Second)
+	queue.EnqueueWithTTL("long", time.Hour)
+	queue.Enqueue("forever")
+
+	clock.Advance(time.Second)
+
+	// The expired element at the front is skipped and reported.
+	if val, ok := queue.Dequeue(); !ok || val != "long" {
+		t.Errorf("Expected long, got %q (ok=%v)", val, ok)
+	}
+	if len(expired) != 1 || expired[0] != "short" {
+		t.Errorf("Expected [short] to expire, got %v", expired)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if val, ok := queue.Dequeue(); !ok || val != "forever" {
+		t.Errorf("Elements without TTL never expire, got %q (ok=%v)", val, ok)
+	}
+	if len(expired) != 1 {
+		t.Errorf("A dequeued element must not expire later, got %v", expired)
+	}
+}
+
+func TestDelayQueue_Expire(t *testing.T) {
+	clock := newFakeClock()
+	var expired int32
+	queue := NewDelayQueue(
+		WithClock[int](clock),
+		WithExpiryCallback(func(int) { atomic.AddInt32(&expired, 1) }),
+	)
+
+	// Delayed elements with a TTL expire relative to their ready time.
+	start := clock.Now()
+	queue.EnqueueAtWithTTL(1, start.Add(time.Minute), time.Second)
+	queue.EnqueueAtWithTTL(2, start.Add(2*time.Minute), time.Second)
+	queue.EnqueueWithTTL(3, 3*time.Minute)
+
+	clock.Advance(time.Minute)
+	if n := queue.Expire(); n != 0 {
+		t.Errorf("Nothing should have expired yet, got %d", n)
+	}
+
+	clock.Advance(30 * time.Second)
+	if n := queue.Expire(); n != 1 {
+		t.Errorf("Expected 1 expiry, got %d", n)
+	}
+	if queue.Size() != 2 {
+		t.Errorf("Expected 2 pending elements, got %d", queue.Size())
+	}
+
+	clock.Advance(time.Hour)
+	if n := queue.Expire(); n != 2 {
+		t.Errorf("Expected 2 expiries, got %d", n)
+	}
+	if atomic.LoadInt32(&expired) != 3 || !queue.IsEmpty() {
+		t.Errorf("Expected every element to expire, callback ran %d times, size %d", expired, queue.Size())
+	}
+	if _, ok := queue.Dequeue(); ok {
+		t.Error("Expired elements must not be dequeued")
+	}
+}
+
+func TestDelayQueue_DequeueReleasesExpiryIndex(t *testing.T) {
+	clock := newFakeClock()
+	queue := NewDelayQueue(WithClock[int](clock))
+
+	// Elements dequeued long before their TTL runs out must not linger in
+	// the expiry index, even though Expire is never called.
+	for i := 0; i < 1000; i++ {
+		queue.EnqueueWithTTL(i, time.Hour)
+		if val, ok := queue.Dequeue(); !ok || val != i {
+			t.Fatalf("Expected %d, got %d (ok=%v)", i, val, ok)
+		}
+	}
+	if n := queue.expiry.Size(); n != 0 {
+		t.Errorf("Expiry index should be empty, holds %d elements", n)
+	}
+	if n := queue.ready.Size(); n != 0 {
+		t.Errorf("Ready index should be empty, holds %d elements", n)
+	}
+}
+
+func TestDelayQueue_ExpireReleasesReadyIndex(t *testing.T) {
+	clock := newFakeClock()
+	var expired []int
+	queue := NewDelayQueue(
+		WithClock[int](clock),
+		WithExpiryCallback(func(value int) { expired = append(expired, value) }),
+	)
+
+	at := clock.Now().Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		queue.EnqueueAtWithTTL(i, at, time.Second)
+	}
+	clock.Advance(time.Hour + time.Second)
+
+	// Elements with the same expiry time expire in the order they came in.
+	if n := queue.Expire(); n != 10 {
+		t.Errorf("Expected 10 expiries, got %d", n)
+	}
+	for i, val := range expired {
+		if val != i {
+			t.Fatalf("Expected expiry order 0..9, got %v", expired)
+		}
+	}
+	if n := queue.ready.Size(); n != 0 {
+		t.Errorf("Ready index should be empty, holds %d elements", n)
+	}
+}
+
+func TestDelayQueue_ConcurrentDequeueAndExpire(t *testing.T) {
+	clock := newFakeClock()
+	var expired int64
+	queue := NewDelayQueue(
+		WithClock[int](clock),
+		WithExpiryCallback(func(int) { atomic.AddInt64(&expired, 1) }),
+	)
+
+	const numItems = 4000
+	for i := 0; i < numItems; i++ {
+		queue.EnqueueWithTTL(i, time.Duration(i%4)*time.Millisecond)
+	}
+	clock.Advance(2 * time.Millisecond)
+
+	// Consumers and expirers race for the same elements; every element must
+	// end up either dequeued or expired, exactly once.
+	var dequeued int64
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, ok := queue.Dequeue(); !ok {
+					return
+				}
+				atomic.AddInt64(&dequeued, 1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				queue.Expire()
+			}
+		}()
+	}
+	wg.Wait()
+	queue.Expire()
+
+	if dequeued+expired != numItems {
+		t.Errorf("Expected %d elements accounted for, got %d dequeued and %d expired", numItems, dequeued, expired)
+	}
+	if expired < numItems/4*3 {
+		t.Errorf("Expected at least %d expiries, got %d", numItems/4*3, expired)
+	}
+	if !queue.IsEmpty() {
+		t.Errorf("Queue should be empty, size %d", queue.Size())
+	}
+}
@@ -1,6 +1,6 @@
 module lockfreequeue/example
 
-go 1.18
+go 1.23
 
 require lockfreequeue v0.0.0
 replace lockfreequeue => ../ 
\ No newline at end of file
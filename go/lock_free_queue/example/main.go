@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -22,6 +23,14 @@ func main() {
 	// Custom type example
 	fmt.Println("\n=== Custom Type Example ===")
 	customTypeExample()
+
+	// Channel adapter example
+	fmt.Println("\n=== Channel Adapters ===")
+	channelExample()
+
+	// Iterator example
+	fmt.Println("\n=== Iterators ===")
+	iteratorExample()
 }
 
 func basicExample() {
@@ -150,3 +159,44 @@ func customTypeExample() {
 		}
 	}
 }
+
+func channelExample() {
+	queue := lockfreequeue.NewLockFreeQueue[string]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Fill the queue from a channel in the background
+	in := make(chan string)
+	go func() {
+		for _, word := range []string{"lock", "free", "queue"} {
+			in <- word
+		}
+		close(in)
+	}()
+	go lockfreequeue.FromChan(ctx, queue, in)
+
+	// Read the queue back out through a channel
+	out := lockfreequeue.ToChan(ctx, queue)
+	for i := 0; i < 3; i++ {
+		fmt.Println("Received from channel:", <-out)
+	}
+}
+
+func iteratorExample() {
+	queue := lockfreequeue.NewLockFreeQueue[int]()
+	for i := 1; i <= 3; i++ {
+		queue.Enqueue(i)
+	}
+
+	// All walks a snapshot without removing anything
+	for val := range queue.All() {
+		fmt.Println("Snapshot element:", val)
+	}
+	fmt.Println("Queue size after All:", queue.Size())
+
+	// Drain consumes the queue
+	for val := range queue.Drain() {
+		fmt.Println("Drained:", val)
+	}
+	fmt.Println("Queue size after Drain:", queue.Size())
+}
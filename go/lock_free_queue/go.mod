@@ -1,3 +1,3 @@
 module lockfreequeue
 
-go 1.18
+go 1.23
@@ -0,0 +1,619 @@
+package lockfreequeue
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// opKind identifies a queue operation in a recorded history.
+type opKind int
+
+const (
+	opEnqueue opKind = iota
+	opDequeue
+	opPeek
+	opSize
+	opClear
+	opSnapshot
+)
+
+func (k opKind) String() string {
+	return [...]string{"Enqueue", "Dequeue", "Peek", "Size", "Clear", "Snapshot"}[k]
+}
+
+// operation is one completed call in a concurrent history. call and ret are
+// logical timestamps taken from a shared clock right before the call started
+// and right after it returned, so ret < call of another operation means the
+// first one finished before the second one began.
+type operation struct {
+	kind     opKind
+	value    int   // enqueued value, or value returned by Dequeue/Peek
+	ok       bool  // result flag of Dequeue/Peek
+	size     int   // result of Size
+	snapshot []int // result of Snapshot
+	call     int64
+	ret      int64
+}
+
+func (op operation) String() string {
+	var desc string
+	switch op.kind {
+	case opEnqueue:
+		desc = fmt.Sprintf("Enqueue(%d)", op.value)
+	case opDequeue, opPeek:
+		desc = fmt.Sprintf("%s() = (%d, %v)", op.kind, op.value, op.ok)
+	case opSize:
+		desc = fmt.Sprintf("Size() = %d", op.size)
+	case opClear:
+		desc = "Clear()"
+	case opSnapshot:
+		desc = fmt.Sprintf("Snapshot() = %v", op.snapshot)
+	}
+	return fmt.Sprintf("[%d,%d] %s", op.call, op.ret, desc)
+}
+
+// historyRecorder collects operations from concurrent goroutines. Each
+// goroutine gets its own log so recording adds no contention beyond the clock.
+type historyRecorder struct {
+	clock int64
+	mu    sync.Mutex
+	ops   []operation
+}
+
+// historyLog records the operations of a single goroutine.
+type historyLog struct {
+	recorder *historyRecorder
+	ops      []operation
+}
+
+func (r *historyRecorder) newLog() *historyLog {
+	return &historyLog{recorder: r}
+}
+
+// history returns every operation recorded by logs that have been flushed.
+func (r *historyRecorder) history() []operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]operation(nil), r.ops...)
+}
+
+// do runs fn between two clock ticks and records the resulting operation.
+func (l *historyLog) do(kind opKind, fn func(op *operation)) {
+	op := operation{kind: kind}
+	op.call = atomic.AddInt64(&l.recorder.clock, 1)
+	fn(&op)
+	op.ret = atomic.AddInt64(&l.recorder.clock, 1)
+	l.ops = append(l.ops, op)
+}
+
+// flush hands the goroutine's operations to the recorder.
+func (l *historyLog) flush() {
+	l.recorder.mu.Lock()
+	l.recorder.ops = append(l.recorder.ops, l.ops...)
+	l.recorder.mu.Unlock()
+	l.ops = nil
+}
+
+// applyToModel applies op to a sequential FIFO queue holding state and
+// returns the new state, or false if op's result is impossible in that state.
+// state is never modified in place.
+func applyToModel(state []int, op operation) ([]int, bool) {
+	switch op.kind {
+	case opEnqueue:
+		next := make([]int, len(state), len(state)+1)
+		copy(next, state)
+		return append(next, op.value), true
+	case opDequeue:
+		if !op.ok {
+			return state, len(state) == 0
+		}
+		if len(state) == 0 || state[0] != op.value {
+			return nil, false
+		}
+		return state[1:], true
+	case opPeek:
+		if !op.ok {
+			return state, len(state) == 0
+		}
+		return state, len(state) > 0 && state[0] == op.value
+	case opSize:
+		return state, len(state) == op.size
+	case opClear:
+		return nil, true
+	case opSnapshot:
+		return state, slices.Equal(state, op.snapshot)
+	}
+	panic(fmt.Sprintf("unknown operation kind %d", op.kind))
+}
+
+// checkLinearizable reports whether history can be explained by some
+// sequential execution of a FIFO queue that respects real-time order: every
+// operation takes effect at a single instant between its call and return.
+//
+// It is the Wing & Gong search with the memoization of Lowe's refinement:
+// repeatedly pick an operation that could be linearized next (no other
+// pending operation returned before it was called), apply it to the model and
+// recurse, caching (linearized set, model state) pairs that lead nowhere.
+func checkLinearizable(history []operation) bool {
+	ops := append([]operation(nil), history...)
+	sort.Slice(ops, func(i, j int) bool { return ops[i].call < ops[j].call })
+
+	linearized := make([]bool, len(ops))
+	visited := make(map[string]bool)
+
+	var search func(state []int, remaining int) bool
+	search = func(state []int, remaining int) bool {
+		if remaining == 0 {
+			return true
+		}
+
+		key := linearizationKey(linearized, state)
+		if visited[key] {
+			return false
+		}
+		visited[key] = true
+
+		// Only operations called before the earliest pending return are
+		// candidates; anything later must come after that operation.
+		minRet := int64(-1)
+		for i, op := range ops {
+			if !linearized[i] && (minRet < 0 || op.ret < minRet) {
+				minRet = op.ret
+			}
+		}
+
+		for i, op := range ops {
+			if linearized[i] {
+				continue
+			}
+			if op.call > minRet {
+				break // ops are sorted by call time
+			}
+			next, ok := applyToModel(state, op)
+			if !ok {
+				continue
+			}
+			linearized[i] = true
+			if search(next, remaining-1) {
+				return true
+			}
+			linearized[i] = false
+		}
+		return false
+	}
+
+	return search(nil, len(ops))
+}
+
+// linearizationKey encodes the search position for memoization.
+func linearizationKey(linearized []bool, state []int) string {
+	var b strings.Builder
+	for _, done := range linearized {
+		if done {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	for _, v := range state {
+		fmt.Fprintf(&b, ",%d", v)
+	}
+	return b.String()
+}
+
+// formatHistory renders a history sorted by call time for failure messages.
+func formatHistory(history []operation) string {
+	ops := append([]operation(nil), history...)
+	sort.Slice(ops, func(i, j int) bool { return ops[i].call < ops[j].call })
+
+	var b strings.Builder
+	for _, op := range ops {
+		b.WriteString("\n\t")
+		b.WriteString(op.String())
+	}
+	return b.String()
+}
+
+// workerRole says which operations a goroutine in a concurrent history may
+// issue against impl, honouring single-producer and single-consumer limits.
+func workerRole(impl queueImplementation, worker int) (canEnqueue, canDequeue bool) {
+	canEnqueue = !impl.singleProducer || worker == 0
+	canDequeue = !impl.singleConsumer || worker == 1
+	return canEnqueue, canDequeue
+}
+
+// runRecorded executes per-worker operation schedules concurrently against
+// queue and returns the recorded history. Operations a worker may not issue,
+// or the queue does not support, are turned into Size calls. Size results are dropped from the history unless
+// the implementation keeps Size exact, since they cannot be checked otherwise.
+func runRecorded(impl queueImplementation, queue Queue[int], schedules [][]opKind) []operation {
+	clearer, _ := queue.(interface{ Clear() })
+	snapshotter, _ := queue.(interface{ Snapshot() []int })
+
+	recorder := &historyRecorder{}
+	var start, wg sync.WaitGroup
+	start.Add(1)
+
+	for w, schedule := range schedules {
+		wg.Add(1)
+		go func(worker int, schedule []opKind) {
+			defer wg.Done()
+			log := recorder.newLog()
+			canEnqueue, canDequeue := workerRole(impl, worker)
+			start.Wait()
+
+			for i, kind := range schedule {
+				switch {
+				case kind == opEnqueue && canEnqueue:
+					value := worker*1000000 + i
+					log.do(opEnqueue, func(op *operation) {
+						op.value = value
+						queue.Enqueue(value)
+					})
+				case kind == opDequeue && canDequeue:
+					log.do(opDequeue, func(op *operation) {
+						op.value, op.ok = queue.Dequeue()
+					})
+				case kind == opPeek && canDequeue:
+					log.do(opPeek, func(op *operation) {
+						op.value, op.ok = queue.Peek()
+					})
+				case kind == opClear && clearer != nil:
+					log.do(opClear, func(op *operation) {
+						clearer.Clear()
+					})
+				case kind == opSnapshot && snapshotter != nil:
+					log.do(opSnapshot, func(op *operation) {
+						op.snapshot = snapshotter.Snapshot()
+					})
+				default:
+					log.do(opSize, func(op *operation) {
+						op.size = queue.Size()
+					})
+				}
+			}
+			log.flush()
+		}(w, schedule)
+	}
+
+	start.Done()
+	wg.Wait()
+
+	history := recorder.history()
+	if impl.exactSize {
+		return history
+	}
+	checked := history[:0]
+	for _, op := range history {
+		if op.kind != opSize {
+			checked = append(checked, op)
+		}
+	}
+	return checked
+}
+
+func TestLinearizabilityChecker(t *testing.T) {
+	tests := []struct {
+		name         string
+		history      []operation
+		linearizable bool
+	}{
+		{
+			name: "sequential FIFO",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 2},
+				{kind: opEnqueue, value: 2, call: 3, ret: 4},
+				{kind: opDequeue, value: 1, ok: true, call: 5, ret: 6},
+				{kind: opSize, size: 1, call: 7, ret: 8},
+			},
+			linearizable: true,
+		},
+		{
+			name: "sequential LIFO order",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 2},
+				{kind: opEnqueue, value: 2, call: 3, ret: 4},
+				{kind: opDequeue, value: 2, ok: true, call: 5, ret: 6},
+			},
+			linearizable: false,
+		},
+		{
+			name: "overlapping enqueues in either order",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 4},
+				{kind: opEnqueue, value: 2, call: 2, ret: 3},
+				{kind: opDequeue, value: 2, ok: true, call: 5, ret: 6},
+				{kind: opDequeue, value: 1, ok: true, call: 7, ret: 8},
+			},
+			linearizable: true,
+		},
+		{
+			name: "dequeue overlapping enqueue may see it",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 4},
+				{kind: opDequeue, value: 1, ok: true, call: 2, ret: 3},
+			},
+			linearizable: true,
+		},
+		{
+			name: "empty dequeue after completed enqueue",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 2},
+				{kind: opDequeue, ok: false, call: 3, ret: 4},
+			},
+			linearizable: false,
+		},
+		{
+			name: "value dequeued twice",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 2},
+				{kind: opDequeue, value: 1, ok: true, call: 3, ret: 6},
+				{kind: opDequeue, value: 1, ok: true, call: 4, ret: 5},
+			},
+			linearizable: false,
+		},
+		{
+			name: "peek sees a value that was never at the front",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 2},
+				{kind: opEnqueue, value: 2, call: 3, ret: 4},
+				{kind: opPeek, value: 2, ok: true, call: 5, ret: 6},
+			},
+			linearizable: false,
+		},
+		{
+			name: "enqueue lost by clear racing with it",
+			history: []operation{
+				{kind: opClear, call: 1, ret: 4},
+				{kind: opEnqueue, value: 1, call: 2, ret: 3},
+				{kind: opDequeue, ok: false, call: 5, ret: 6},
+			},
+			linearizable: true,
+		},
+		{
+			name: "snapshot overlapping a dequeue",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 2},
+				{kind: opEnqueue, value: 2, call: 3, ret: 4},
+				{kind: opDequeue, value: 1, ok: true, call: 5, ret: 8},
+				{kind: opSnapshot, snapshot: []int{2}, call: 6, ret: 7},
+			},
+			linearizable: true,
+		},
+		{
+			name: "snapshot that was never the content",
+			history: []operation{
+				{kind: opEnqueue, value: 1, call: 1, ret: 2},
+				{kind: opEnqueue, value: 2, call: 3, ret: 4},
+				{kind: opEnqueue, value: 3, call: 5, ret: 8},
+				{kind: opDequeue, value: 1, ok: true, call: 6, ret: 9},
+				{kind: opSnapshot, snapshot: []int{1, 3}, call: 7, ret: 10},
+			},
+			linearizable: false,
+		},
+		{
+			name: "enqueue lost after clear returned",
+			history: []operation{
+				{kind: opClear, call: 1, ret: 2},
+				{kind: opEnqueue, value: 1, call: 3, ret: 4},
+				{kind: opDequeue, ok: false, call: 5, ret: 6},
+			},
+			linearizable: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkLinearizable(tt.history); got != tt.linearizable {
+				t.Errorf("checkLinearizable = %v, want %v for history:%s", got, tt.linearizable, formatHistory(tt.history))
+			}
+		})
+	}
+}
+
+func TestQueue_Linearizable(t *testing.T) {
+	rounds := 200
+	if testing.Short() {
+		rounds = 20
+	}
+
+	const workers = 3
+	const opsPerWorker = 12
+
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			if impl.weakEmpty {
+				t.Skip("Dequeue may report empty while an earlier Enqueue is still linking")
+			}
+
+			rng := rand.New(rand.NewSource(1))
+			for round := 0; round < rounds; round++ {
+				schedules := make([][]opKind, workers)
+				for w := range schedules {
+					schedules[w] = make([]opKind, opsPerWorker)
+					for i := range schedules[w] {
+						schedules[w][i] = opKind(rng.Intn(int(opSize) + 1))
+					}
+				}
+
+				queue := impl.newQueue(workers * opsPerWorker)
+				history := runRecorded(impl, queue, schedules)
+				if !checkLinearizable(history) {
+					t.Fatalf("Round %d: history is not linearizable:%s", round, formatHistory(history))
+				}
+			}
+		})
+	}
+}
+
+func TestLockFreeQueue_ClearLinearizable(t *testing.T) {
+	rounds := 200
+	if testing.Short() {
+		rounds = 20
+	}
+
+	const workers = 3
+	const opsPerWorker = 12
+
+	variants := []queueImplementation{
+		{name: "Default", newQueue: func(int) Queue[int] { return NewLockFreeQueue[int]() }},
+		{name: "Recycling", newQueue: func(int) Queue[int] { return NewLockFreeQueue[int](WithNodeRecycling()) }},
+	}
+
+	for _, impl := range variants {
+		t.Run(impl.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			for round := 0; round < rounds; round++ {
+				// Mostly enqueues so that Clear usually has something to
+				// race with.
+				schedules := make([][]opKind, workers)
+				for w := range schedules {
+					schedules[w] = make([]opKind, opsPerWorker)
+					for i := range schedules[w] {
+						switch r := rng.Intn(10); {
+						case r < 5:
+							schedules[w][i] = opEnqueue
+						case r < 7:
+							schedules[w][i] = opDequeue
+						case r < 8:
+							schedules[w][i] = opPeek
+						default:
+							schedules[w][i] = opClear
+						}
+					}
+				}
+
+				queue := impl.newQueue(workers * opsPerWorker)
+				history := runRecorded(impl, queue, schedules)
+				if !checkLinearizable(history) {
+					t.Fatalf("Round %d: history is not linearizable:%s", round, formatHistory(history))
+				}
+			}
+		})
+	}
+}
+
+func TestLockFreeQueue_SizeAndSnapshotLinearizable(t *testing.T) {
+	rounds := 200
+	if testing.Short() {
+		rounds = 20
+	}
+
+	const workers = 3
+	const opsPerWorker = 12
+
+	variants := []queueImplementation{
+		{name: "Default", newQueue: func(int) Queue[int] { return NewLockFreeQueue[int]() }, exactSize: true},
+		{name: "Recycling", newQueue: func(int) Queue[int] { return NewLockFreeQueue[int](WithNodeRecycling()) }, exactSize: true},
+	}
+
+	for _, impl := range variants {
+		t.Run(impl.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			for round := 0; round < rounds; round++ {
+				// Reads race with a steady mix of enqueues and dequeues.
+				schedules := make([][]opKind, workers)
+				for w := range schedules {
+					schedules[w] = make([]opKind, opsPerWorker)
+					for i := range schedules[w] {
+						switch r := rng.Intn(10); {
+						case r < 4:
+							schedules[w][i] = opEnqueue
+						case r < 7:
+							schedules[w][i] = opDequeue
+						case r < 8:
+							schedules[w][i] = opSize
+						default:
+							schedules[w][i] = opSnapshot
+						}
+					}
+				}
+
+				queue := impl.newQueue(workers * opsPerWorker)
+				history := runRecorded(impl, queue, schedules)
+				if !checkLinearizable(history) {
+					t.Fatalf("Round %d: history is not linearizable:%s", round, formatHistory(history))
+				}
+			}
+		})
+	}
+}
+
+// FuzzQueue_Sequential runs a random sequence of operations on every
+// implementation and compares each result with the sequential model.
+func FuzzQueue_Sequential(f *testing.F) {
+	f.Add([]byte{0, 0, 1, 2, 3, 1, 1, 2, 3})
+	f.Add([]byte{0, 1, 0, 1, 0, 0, 0, 3, 2, 1, 1, 1, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, impl := range queueImplementations {
+			queue := impl.newQueue(len(data) + 1)
+			var state []int
+
+			for i, b := range data {
+				op := operation{kind: opKind(int(b) % (int(opSize) + 1))}
+				switch op.kind {
+				case opEnqueue:
+					op.value = i
+					queue.Enqueue(i)
+				case opDequeue:
+					op.value, op.ok = queue.Dequeue()
+				case opPeek:
+					op.value, op.ok = queue.Peek()
+				case opSize:
+					op.size = queue.Size()
+				}
+
+				next, ok := applyToModel(state, op)
+				if !ok {
+					t.Fatalf("%s: step %d: %s is inconsistent with model state %v", impl.name, i, op, state)
+				}
+				state = next
+
+				if queue.IsEmpty() != (len(state) == 0) {
+					t.Fatalf("%s: step %d: IsEmpty = %v with model state %v", impl.name, i, queue.IsEmpty(), state)
+				}
+			}
+		}
+	})
+}
+
+// FuzzQueue_Linearizable deals the fuzzed operations round-robin to three
+// goroutines, runs them concurrently against every implementation and checks
+// the recorded history for linearizability.
+func FuzzQueue_Linearizable(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 0, 2, 1, 1, 0, 3, 1, 2, 1})
+	f.Add([]byte{0, 0, 0, 1, 1, 1, 2, 2, 2, 0, 1, 3})
+
+	const workers = 3
+	const maxOps = 48
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > maxOps {
+			data = data[:maxOps]
+		}
+
+		schedules := make([][]opKind, workers)
+		for i, b := range data {
+			w := i % workers
+			schedules[w] = append(schedules[w], opKind(int(b)%(int(opSize)+1)))
+		}
+
+		for _, impl := range queueImplementations {
+			if impl.weakEmpty {
+				continue
+			}
+			queue := impl.newQueue(len(data) + 1)
+			history := runRecorded(impl, queue, schedules)
+			if !checkLinearizable(history) {
+				t.Fatalf("%s: history is not linearizable:%s", impl.name, formatHistory(history))
+			}
+		}
+	})
+}
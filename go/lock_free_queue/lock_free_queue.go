@@ -1,6 +1,7 @@
 package lockfreequeue
 
 import (
+	"iter"
 	"sync/atomic"
 	"unsafe"
 )
@@ -9,27 +10,50 @@ import (
 type Node[T any] struct {
 	value T
 	next  unsafe.Pointer // points to the next node (for atomic operations)
+	index uint64         // position in enqueue order, fixed before the node is linked
 }
 
 // LockFreeQueue is the lock-free queue structure.
+//
+// The queue keeps no size counter. Every node records its position in the
+// enqueue order, so the sentinel's index is the number of elements dequeued
+// so far and the last node's index the number enqueued; Size is the
+// difference, read from a consistent pair of nodes.
 type LockFreeQueue[T any] struct {
-	head unsafe.Pointer // points to the first node (head)
-	tail unsafe.Pointer // points to the last node (tail)
-	size int64          // atomic counter for queue size
+	head     unsafe.Pointer   // points to the first node (head)
+	tail     unsafe.Pointer   // points to the last node (tail)
+	recycler *nodeRecycler[T] // non-nil when node recycling is enabled
+	stats    *queueStats      // non-nil when stats collection is enabled
 }
 
 // NewLockFreeQueue initializes a new lock-free queue with a sentinel node.
-func NewLockFreeQueue[T any]() *LockFreeQueue[T] {
+func NewLockFreeQueue[T any](opts ...Option) *LockFreeQueue[T] {
+	var options queueOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	sentinel := unsafe.Pointer(&Node[T]{})
-	return &LockFreeQueue[T]{
+	q := &LockFreeQueue[T]{
 		head: sentinel,
 		tail: sentinel,
-		size: 0,
 	}
+	if options.recycleNodes {
+		q.recycler = &nodeRecycler[T]{}
+	}
+	if options.collectStats {
+		q.stats = &queueStats{}
+	}
+	return q
 }
 
 // Enqueue inserts an element at the end of the queue.
 func (q *LockFreeQueue[T]) Enqueue(value T) {
+	if q.recycler != nil {
+		q.enqueueRecycled(value)
+		return
+	}
+
 	newNode := unsafe.Pointer(&Node[T]{value: value})
 
 	for {
@@ -40,15 +64,18 @@ func (q *LockFreeQueue[T]) Enqueue(value T) {
 		if tail == atomic.LoadPointer(&q.tail) {
 			if next == nil {
 				// Try to link the new node at the end of the queue.
+				(*Node[T])(newNode).index = (*Node[T])(tail).index + 1
 				if atomic.CompareAndSwapPointer(&((*Node[T])(tail).next), nil, newNode) {
 					// If successful, try to move the tail pointer forward.
 					atomic.CompareAndSwapPointer(&q.tail, tail, newNode)
-					atomic.AddInt64(&q.size, 1)
+					q.stats.enqueued(1)
 					return
 				}
+				q.stats.enqueueCASFailed()
 			} else {
 				// Tail is not the last node, move the tail pointer forward.
 				atomic.CompareAndSwapPointer(&q.tail, tail, next)
+				q.stats.helpedTail()
 			}
 		}
 	}
@@ -57,6 +84,10 @@ func (q *LockFreeQueue[T]) Enqueue(value T) {
 // Dequeue removes and returns the element at the front of the queue.
 // It returns the zero value of T and false if the queue is empty.
 func (q *LockFreeQueue[T]) Dequeue() (T, bool) {
+	if q.recycler != nil {
+		return q.dequeueRecycled()
+	}
+
 	var zeroValue T
 
 	for {
@@ -73,100 +104,381 @@ func (q *LockFreeQueue[T]) Dequeue() (T, bool) {
 				}
 				// Tail is lagging, move it forward.
 				atomic.CompareAndSwapPointer(&q.tail, tail, next)
+				q.stats.helpedTail()
 			} else {
 				// Queue is not empty, try to move the head pointer forward.
 				value := (*Node[T])(next).value
 				if atomic.CompareAndSwapPointer(&q.head, head, next) {
-					// Decrement the size counter after successful dequeue
-					// Use max(0, size-1) to avoid negative size
-					for {
-						size := atomic.LoadInt64(&q.size)
-						if size <= 0 {
-							atomic.StoreInt64(&q.size, 0)
-							break
-						}
-						if atomic.CompareAndSwapInt64(&q.size, size, size-1) {
-							break
-						}
-					}
+					q.stats.dequeued(1)
 					return value, true
 				}
+				q.stats.dequeueCASFailed()
 			}
 		}
 	}
 }
 
-// ResetSize recalculates the size by walking through the queue
-// This is an expensive operation but can be used to correct the size counter if it gets out of sync
-func (q *LockFreeQueue[T]) ResetSize() {
-	// Walk the queue and count nodes
-	var count int64
-	head := atomic.LoadPointer(&q.head)
-	current := atomic.LoadPointer(&((*Node[T])(head).next))
+// EnqueueBatch inserts all values at the end of the queue in order.
+// The nodes are linked into a chain up front so the whole batch is published
+// with a single CAS on the tail, and the values from one batch are never
+// interleaved with values from concurrent enqueues.
+func (q *LockFreeQueue[T]) EnqueueBatch(values []T) {
+	if len(values) == 0 {
+		return
+	}
+	if q.recycler != nil {
+		q.enqueueBatchRecycled(values)
+		return
+	}
 
-	for current != nil {
-		count++
-		current = atomic.LoadPointer(&((*Node[T])(unsafe.Pointer(current)).next))
+	// Pre-build the chain of nodes outside of the CAS loop.
+	first := &Node[T]{value: values[0]}
+	last := first
+	for _, value := range values[1:] {
+		node := &Node[T]{value: value}
+		last.next = unsafe.Pointer(node)
+		last = node
 	}
+	firstPtr := unsafe.Pointer(first)
+	lastPtr := unsafe.Pointer(last)
 
-	// Atomically update the size
-	atomic.StoreInt64(&q.size, count)
-}
+	for {
+		tail := atomic.LoadPointer(&q.tail)
+		next := atomic.LoadPointer(&((*Node[T])(tail).next))
 
-// Size returns the current size of the queue.
-func (q *LockFreeQueue[T]) Size() int {
-	// Check if queue is structurally empty
-	head := atomic.LoadPointer(&q.head)
-	next := atomic.LoadPointer(&((*Node[T])(head).next))
+		if tail == atomic.LoadPointer(&q.tail) {
+			if next == nil {
+				// Number the chain after the current last node.
+				index := (*Node[T])(tail).index
+				for node := first; node != nil; node = (*Node[T])(node.next) {
+					index++
+					node.index = index
+				}
 
-	if next == nil {
-		// Queue is definitely empty - reset size counter to 0
-		atomic.StoreInt64(&q.size, 0)
-		return 0
+				// Try to link the whole chain at the end of the queue.
+				if atomic.CompareAndSwapPointer(&((*Node[T])(tail).next), nil, firstPtr) {
+					// If successful, try to swing the tail to the end of the chain.
+					// Other goroutines will help it along if this CAS fails.
+					atomic.CompareAndSwapPointer(&q.tail, tail, lastPtr)
+					q.stats.enqueued(int64(len(values)))
+					return
+				}
+				q.stats.enqueueCASFailed()
+			} else {
+				// Tail is not the last node, move the tail pointer forward.
+				atomic.CompareAndSwapPointer(&q.tail, tail, next)
+				q.stats.helpedTail()
+			}
+		}
 	}
+}
 
-	// Get current size
-	size := atomic.LoadInt64(&q.size)
-	if size < 0 {
-		// Negative size is impossible - reset to avoid returning negative
-		atomic.StoreInt64(&q.size, 0)
+// DequeueBatch removes up to max elements from the front of the queue and
+// stores them in dst, returning how many were removed. At most len(dst)
+// elements are removed. The elements are detached with a single CAS on the
+// head, so they are always a contiguous run of the queue.
+func (q *LockFreeQueue[T]) DequeueBatch(dst []T, max int) int {
+	if max > len(dst) {
+		max = len(dst)
+	}
+	if max <= 0 {
 		return 0
 	}
+	if q.recycler != nil {
+		// Walking several nodes at once is not covered by hazard pointers,
+		// so recycling queues detach the batch one node at a time.
+		count := 0
+		for count < max {
+			value, ok := q.dequeueRecycled()
+			if !ok {
+				break
+			}
+			dst[count] = value
+			count++
+		}
+		return count
+	}
+
+	for {
+		head := atomic.LoadPointer(&q.head)
+		tail := atomic.LoadPointer(&q.tail)
+
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+
+		// Walk forward from the sentinel, copying out up to max values.
+		count := 0
+		current := head
+		for count < max {
+			next := atomic.LoadPointer(&((*Node[T])(current).next))
+			if next == nil {
+				break
+			}
+			if current == tail {
+				// Tail is lagging behind a node we are about to dequeue;
+				// move it forward so it never points before the new head.
+				atomic.CompareAndSwapPointer(&q.tail, tail, next)
+				q.stats.helpedTail()
+				tail = atomic.LoadPointer(&q.tail)
+			}
+			dst[count] = (*Node[T])(next).value
+			current = next
+			count++
+		}
 
-	return int(size)
+		if count == 0 {
+			// Queue is empty.
+			return 0
+		}
+
+		// The last node walked becomes the new sentinel.
+		if atomic.CompareAndSwapPointer(&q.head, head, current) {
+			q.stats.dequeued(int64(count))
+			return count
+		}
+		q.stats.dequeueCASFailed()
+	}
+}
+
+// ResetSize used to recount the elements to repair a drifting size counter.
+//
+// Deprecated: Size is always exact, so there is nothing to repair and
+// ResetSize does nothing.
+func (q *LockFreeQueue[T]) ResetSize() {}
+
+// Size returns the number of elements in the queue. It never writes to the
+// queue and is linearizable: the result is the exact size at some instant
+// during the call. Under a steady stream of dequeues it may retry, but only
+// because other operations completed.
+func (q *LockFreeQueue[T]) Size() int {
+	if q.recycler != nil {
+		// Keep the nodes we read the indexes of from being reused.
+		q.recycler.pinWalk()
+		defer q.recycler.unpinWalk()
+	}
+
+	for {
+		head, last, ok := q.consistentEnds()
+		if ok {
+			return int((*Node[T])(last).index - (*Node[T])(head).index)
+		}
+	}
 }
 
 // IsEmpty returns true if the queue is empty.
 func (q *LockFreeQueue[T]) IsEmpty() bool {
-	// Always check the structure first
-	head := atomic.LoadPointer(&q.head)
-	next := atomic.LoadPointer(&((*Node[T])(head).next))
+	return q.headIsLast()
+}
 
-	if next == nil {
-		// Queue is structurally empty - ensure size is 0
-		atomic.StoreInt64(&q.size, 0)
-		return true
+// Snapshot returns a copy of the elements in the queue, from front to back,
+// exactly as they were at one instant during the call. Unlike All, no element
+// dequeued before that instant and none enqueued after it is included.
+//
+// Snapshot never blocks other operations. It retries if the head moves while
+// it copies, so a steady stream of dequeues can make it retry repeatedly, but
+// never without other operations making progress.
+func (q *LockFreeQueue[T]) Snapshot() []T {
+	if q.recycler != nil {
+		q.recycler.pinWalk()
+		defer q.recycler.unpinWalk()
+	}
+
+	for {
+		head, last, ok := q.consistentEnds()
+		if !ok {
+			continue
+		}
+
+		values := make([]T, 0, (*Node[T])(last).index-(*Node[T])(head).index)
+		for node := head; node != last; {
+			node = atomic.LoadPointer(&((*Node[T])(node).next))
+			values = append(values, (*Node[T])(node).value)
+		}
+		return values
+	}
+}
+
+// consistentEnds returns the sentinel and the last node of the queue as they
+// were at the same instant: the moment the last node was seen without a
+// successor. That holds if the head did not move while the last node was
+// being found, otherwise ok is false and the caller should retry. Nodes are
+// never unlinked from between the two, so the chain from head to last is the
+// exact content of the queue at that instant.
+//
+// consistentEnds does not help a lagging tail, so it never writes to the
+// queue. With node recycling the caller must hold pinWalk.
+func (q *LockFreeQueue[T]) consistentEnds() (head, last unsafe.Pointer, ok bool) {
+	head = atomic.LoadPointer(&q.head)
+
+	// The tail is never behind the head, so walking forward from it finds
+	// the last node.
+	last = atomic.LoadPointer(&q.tail)
+	for {
+		next := atomic.LoadPointer(&((*Node[T])(last).next))
+		if next == nil {
+			break
+		}
+		last = next
 	}
 
-	return false
+	return head, last, head == atomic.LoadPointer(&q.head)
 }
 
-// Clear resets the queue to its initial empty state
+// headIsLast reports whether the sentinel node has no successor, i.e. the
+// queue is structurally empty.
+func (q *LockFreeQueue[T]) headIsLast() bool {
+	if q.recycler != nil {
+		_, ok := q.peekRecycled()
+		return !ok
+	}
+
+	head := atomic.LoadPointer(&q.head)
+	return atomic.LoadPointer(&((*Node[T])(head).next)) == nil
+}
+
+// Clear removes every element from the queue. It is safe to call while
+// other goroutines enqueue and dequeue: the current contents are detached
+// with a single CAS on the head, so an element is either removed by Clear or
+// stays in the queue, and concurrent enqueues are never lost.
 func (q *LockFreeQueue[T]) Clear() {
-	// Create a new sentinel node
-	sentinel := unsafe.Pointer(&Node[T]{})
+	q.detachAll(nil)
+}
+
+// Drain returns an iterator that consumes the queue. When iteration starts it
+// atomically detaches the current contents and yields them in FIFO order;
+// elements enqueued after that stay in the queue. If the loop stops early,
+// the detached elements that were not yielded are enqueued again, in order,
+// at the end of the queue.
+func (q *LockFreeQueue[T]) Drain() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		q.detachAll(yield)
+	}
+}
+
+// All returns an iterator over the elements in the queue at the moment
+// iteration starts, from front to back, without removing them. Elements
+// dequeued concurrently may still be yielded and elements enqueued after the
+// start are not; use Drain to consume the queue instead.
+func (q *LockFreeQueue[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		if q.recycler != nil {
+			// Keep dequeued nodes from being reused while we walk them.
+			q.recycler.pinWalk()
+			defer q.recycler.unpinWalk()
+		}
+
+		head := atomic.LoadPointer(&q.head)
+		last := q.lastNode()
+		for node := head; node != last; {
+			next := atomic.LoadPointer(&((*Node[T])(node).next))
+			if !yield((*Node[T])(next).value) {
+				return
+			}
+			node = next
+		}
+	}
+}
+
+// lastNode returns the node at the very end of the queue, helping the tail
+// pointer forward if it is lagging.
+func (q *LockFreeQueue[T]) lastNode() unsafe.Pointer {
+	for {
+		tail := atomic.LoadPointer(&q.tail)
+		next := atomic.LoadPointer(&((*Node[T])(tail).next))
+		if next == nil {
+			return tail
+		}
+		atomic.CompareAndSwapPointer(&q.tail, tail, next)
+		q.stats.helpedTail()
+	}
+}
+
+// detachAll unlinks every element currently in the queue and hands the values
+// to fn, if fn is not nil. If fn returns false the values it has not seen are
+// enqueued again; with a nil fn they are discarded.
+//
+// The tail is first helped forward until it is the real last node; then the
+// head is swung from the current sentinel straight to that last node, which
+// becomes the new sentinel. The nodes in between are detached in one step.
+func (q *LockFreeQueue[T]) detachAll(fn func(T) bool) {
+	var rec *hazardRecord[T]
+	if q.recycler != nil {
+		rec = q.recycler.acquire()
+		defer q.recycler.release(rec)
+	}
 
-	// Atomically update head and tail to point to the new sentinel
-	atomic.StorePointer(&q.head, sentinel)
-	atomic.StorePointer(&q.tail, sentinel)
+	var oldHead, newHead unsafe.Pointer
+	for {
+		head := atomic.LoadPointer(&q.head)
+		tail := atomic.LoadPointer(&q.tail)
+		if rec != nil {
+			rec.protect(0, head)
+			rec.protect(1, tail)
+		}
+		if head != atomic.LoadPointer(&q.head) || tail != atomic.LoadPointer(&q.tail) {
+			continue
+		}
 
-	// Reset the size counter
-	atomic.StoreInt64(&q.size, 0)
+		next := atomic.LoadPointer(&((*Node[T])(tail).next))
+		if next != nil {
+			// Tail is lagging, move it forward until it is the last node.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			q.stats.helpedTail()
+			continue
+		}
+		if head == tail {
+			// Queue is empty.
+			return
+		}
+		if atomic.CompareAndSwapPointer(&q.head, head, tail) {
+			oldHead, newHead = head, tail
+			break
+		}
+		q.stats.dequeueCASFailed()
+	}
+
+	// The detached nodes are now only reachable from here, so they can be
+	// walked without further synchronization with other consumers.
+	var count int64
+	var rest []T
+	deliver := fn != nil
+	for node := oldHead; node != newHead; {
+		next := atomic.LoadPointer(&((*Node[T])(node).next))
+		value := (*Node[T])(next).value
+		if deliver {
+			deliver = fn(value)
+		} else if fn != nil {
+			rest = append(rest, value)
+		}
+		count++
+		if rec != nil {
+			q.recycler.retire(rec, node)
+		}
+		node = next
+	}
+	q.stats.dequeued(count)
+
+	if len(rest) > 0 {
+		q.EnqueueBatch(rest)
+	}
+}
+
+// Stats returns a snapshot of the queue's counters. It returns a zero Stats,
+// apart from Size, unless the queue was created with WithStats.
+func (q *LockFreeQueue[T]) Stats() Stats {
+	stats := q.stats.snapshot()
+	stats.Size = q.Size()
+	return stats
 }
 
 // Peek returns the value at the front of the queue without removing it.
 // It returns the zero value of T and false if the queue is empty.
 func (q *LockFreeQueue[T]) Peek() (T, bool) {
+	if q.recycler != nil {
+		return q.peekRecycled()
+	}
+
 	var zeroValue T
 
 	for {
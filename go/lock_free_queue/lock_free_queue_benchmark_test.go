@@ -1,65 +1,86 @@
 package lockfreequeue
 
 import (
+	"cmp"
+	"container/heap"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // Benchmark sequential operations
 func BenchmarkQueue_Sequential(b *testing.B) {
-	queue := NewLockFreeQueue[int]()
-
-	b.Run("Enqueue", func(b *testing.B) {
-		for i := 0; i < b.N; i++ {
-			queue.Enqueue(i)
-		}
-	})
+	for _, impl := range queueImplementations {
+		b.Run(impl.name, func(b *testing.B) {
+			b.Run("Enqueue", func(b *testing.B) {
+				queue := impl.newQueue(b.N)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					queue.Enqueue(i)
+				}
+			})
 
-	// Reset the queue
-	queue = NewLockFreeQueue[int]()
-	// Fill queue for dequeue benchmarks
-	for i := 0; i < 1000000; i++ {
-		queue.Enqueue(i)
-	}
+			// Fill queue for dequeue benchmarks
+			queue := impl.newQueue(1000000)
+			for i := 0; i < 1000000; i++ {
+				queue.Enqueue(i)
+			}
 
-	b.Run("Dequeue", func(b *testing.B) {
-		for i := 0; i < b.N; i++ {
-			if i%1000000 == 0 {
-				// Refill the queue if it might be empty
-				for j := 0; j < 1000000; j++ {
-					queue.Enqueue(j)
+			b.Run("Dequeue", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if i%1000000 == 0 && queue.IsEmpty() {
+						// Refill the queue if it might be empty
+						for j := 0; j < 1000000; j++ {
+							queue.Enqueue(j)
+						}
+					}
+					queue.Dequeue()
 				}
-			}
-			queue.Dequeue()
-		}
-	})
+			})
 
-	b.Run("Peek", func(b *testing.B) {
-		for i := 0; i < b.N; i++ {
-			queue.Peek()
-		}
-	})
+			b.Run("Peek", func(b *testing.B) {
+				queue.Enqueue(0)
+				for i := 0; i < b.N; i++ {
+					queue.Peek()
+				}
+			})
+		})
+	}
 }
 
 // Benchmark concurrent operations
 func BenchmarkQueue_Concurrent(b *testing.B) {
+	for _, impl := range queueImplementations {
+		b.Run(impl.name, func(b *testing.B) {
+			benchmarkQueueConcurrent(b, impl)
+		})
+	}
+}
+
+func benchmarkQueueConcurrent(b *testing.B, impl queueImplementation) {
 	// For a fair comparison, scale down b.N to account for multiple goroutines
 	operationsPerGoroutine := b.N / 8
 	if operationsPerGoroutine < 1 {
 		operationsPerGoroutine = 1
 	}
 
+	// Implementations restricted to one producer or consumer get a single
+	// goroutine doing that side's whole share of the work.
+	producers, consumers := impl.workers(8)
+
 	b.Run("EnqueueOnly", func(b *testing.B) {
+		queue := impl.newQueue(operationsPerGoroutine * 8)
 		b.ResetTimer()
-		queue := NewLockFreeQueue[int]()
 		var wg sync.WaitGroup
 
-		// Launch 8 goroutines to enqueue concurrently
-		for i := 0; i < 8; i++ {
+		// Launch up to 8 goroutines to enqueue concurrently
+		for i := 0; i < producers; i++ {
 			wg.Add(1)
 			go func(id int) {
 				defer wg.Done()
-				for j := 0; j < operationsPerGoroutine; j++ {
+				for j := 0; j < operationsPerGoroutine*8/producers; j++ {
 					queue.Enqueue(j)
 				}
 			}(i)
@@ -69,7 +90,7 @@ func BenchmarkQueue_Concurrent(b *testing.B) {
 	})
 
 	b.Run("DequeueOnly", func(b *testing.B) {
-		queue := NewLockFreeQueue[int]()
+		queue := impl.newQueue(operationsPerGoroutine * 10)
 		// Fill queue for dequeue benchmarks
 		for i := 0; i < operationsPerGoroutine*10; i++ {
 			queue.Enqueue(i)
@@ -78,12 +99,12 @@ func BenchmarkQueue_Concurrent(b *testing.B) {
 		b.ResetTimer()
 		var wg sync.WaitGroup
 
-		// Launch 8 goroutines to dequeue concurrently
-		for i := 0; i < 8; i++ {
+		// Launch up to 8 goroutines to dequeue concurrently
+		for i := 0; i < consumers; i++ {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				for j := 0; j < operationsPerGoroutine; j++ {
+				for j := 0; j < operationsPerGoroutine*8/consumers; j++ {
 					queue.Dequeue()
 				}
 			}()
@@ -93,7 +114,8 @@ func BenchmarkQueue_Concurrent(b *testing.B) {
 	})
 
 	b.Run("MixedOperations", func(b *testing.B) {
-		queue := NewLockFreeQueue[int]()
+		mixedProducers, mixedConsumers := impl.workers(4)
+		queue := impl.newQueue(1000 + operationsPerGoroutine*4)
 		var wg sync.WaitGroup
 
 		// Prefill the queue with some items
@@ -103,23 +125,23 @@ func BenchmarkQueue_Concurrent(b *testing.B) {
 
 		b.ResetTimer()
 
-		// Launch 4 goroutines to enqueue concurrently
-		for i := 0; i < 4; i++ {
+		// Launch up to 4 goroutines to enqueue concurrently
+		for i := 0; i < mixedProducers; i++ {
 			wg.Add(1)
 			go func(id int) {
 				defer wg.Done()
-				for j := 0; j < operationsPerGoroutine; j++ {
+				for j := 0; j < operationsPerGoroutine*4/mixedProducers; j++ {
 					queue.Enqueue(j)
 				}
 			}(i)
 		}
 
-		// Launch 4 goroutines to dequeue concurrently
-		for i := 0; i < 4; i++ {
+		// Launch up to 4 goroutines to dequeue concurrently
+		for i := 0; i < mixedConsumers; i++ {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				for j := 0; j < operationsPerGoroutine; j++ {
+				for j := 0; j < operationsPerGoroutine*4/mixedConsumers; j++ {
 					queue.Dequeue()
 				}
 			}()
@@ -212,3 +234,387 @@ func BenchmarkQueue_ComparisonWithMutexQueue(b *testing.B) {
 		wg.Wait()
 	})
 }
+
+// Benchmark batch operations against the single-item path
+func BenchmarkQueue_Batch(b *testing.B) {
+	const batchSize = 64
+
+	b.Run("Single-Sequential", func(b *testing.B) {
+		queue := NewLockFreeQueue[int]()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < batchSize; j++ {
+				queue.Enqueue(j)
+			}
+			for j := 0; j < batchSize; j++ {
+				queue.Dequeue()
+			}
+		}
+	})
+
+	b.Run("Batch-Sequential", func(b *testing.B) {
+		queue := NewLockFreeQueue[int]()
+		values := make([]int, batchSize)
+		dst := make([]int, batchSize)
+		for i := 0; i < b.N; i++ {
+			queue.EnqueueBatch(values)
+			queue.DequeueBatch(dst, batchSize)
+		}
+	})
+
+	// Each iteration moves batchSize items through the queue from
+	// 4 producers to 4 consumers.
+	b.Run("Single-ConcurrentMixed", func(b *testing.B) {
+		queue := NewLockFreeQueue[int]()
+		operationsPerGoroutine := b.N / 4
+		if operationsPerGoroutine < 1 {
+			operationsPerGoroutine = 1
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < operationsPerGoroutine; j++ {
+					for k := 0; k < batchSize; k++ {
+						queue.Enqueue(k)
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < operationsPerGoroutine; j++ {
+					for k := 0; k < batchSize; k++ {
+						queue.Dequeue()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	b.Run("Batch-ConcurrentMixed", func(b *testing.B) {
+		queue := NewLockFreeQueue[int]()
+		operationsPerGoroutine := b.N / 4
+		if operationsPerGoroutine < 1 {
+			operationsPerGoroutine = 1
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				values := make([]int, batchSize)
+				for j := 0; j < operationsPerGoroutine; j++ {
+					queue.EnqueueBatch(values)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				dst := make([]int, batchSize)
+				for j := 0; j < operationsPerGoroutine; j++ {
+					queue.DequeueBatch(dst, batchSize)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// Benchmark allocations with and without node recycling
+func BenchmarkQueue_NodeRecycling(b *testing.B) {
+	variants := []struct {
+		name string
+		opts []Option
+	}{
+		{"Default", nil},
+		{"Recycling", []Option{WithNodeRecycling()}},
+	}
+
+	for _, v := range variants {
+		b.Run(v.name+"-Sequential", func(b *testing.B) {
+			queue := NewLockFreeQueue[int](v.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				queue.Enqueue(i)
+				queue.Dequeue()
+			}
+		})
+
+		b.Run(v.name+"-ConcurrentMixed", func(b *testing.B) {
+			queue := NewLockFreeQueue[int](v.opts...)
+			operationsPerGoroutine := b.N / 4
+			if operationsPerGoroutine < 1 {
+				operationsPerGoroutine = 1
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < operationsPerGoroutine; j++ {
+						queue.Enqueue(j)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for j := 0; j < operationsPerGoroutine; j++ {
+						queue.Dequeue()
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// intHeap is a container/heap min-heap of ints, the baseline for the
+// priority queue benchmarks.
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *intHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// mutexHeap guards an intHeap with a mutex.
+type mutexHeap struct {
+	mu   sync.Mutex
+	heap intHeap
+}
+
+func (h *mutexHeap) Push(key int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	heap.Push(&h.heap, key)
+}
+
+func (h *mutexHeap) PopMin() (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.heap) == 0 {
+		return 0, false
+	}
+	return heap.Pop(&h.heap).(int), true
+}
+
+// Benchmark the skiplist priority queue against a mutex-guarded container/heap
+func BenchmarkPriorityQueue_ComparisonWithMutexHeap(b *testing.B) {
+	const prefill = 10000
+
+	type priorityQueue struct {
+		push   func(key int)
+		popMin func() (int, bool)
+	}
+	variants := []struct {
+		name     string
+		newQueue func() priorityQueue
+	}{
+		{"LockFree", func() priorityQueue {
+			q := NewPriorityQueue[int, struct{}](cmp.Compare[int])
+			return priorityQueue{
+				push: func(key int) { q.Push(key, struct{}{}) },
+				popMin: func() (int, bool) {
+					key, _, ok := q.PopMin()
+					return key, ok
+				},
+			}
+		}},
+		{"MutexHeap", func() priorityQueue {
+			q := &mutexHeap{}
+			return priorityQueue{push: q.Push, popMin: q.PopMin}
+		}},
+	}
+
+	for _, v := range variants {
+		b.Run(v.name+"-Sequential", func(b *testing.B) {
+			queue := v.newQueue()
+			for i := 0; i < prefill; i++ {
+				queue.push(rand.IntN(prefill))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				queue.push(rand.IntN(prefill))
+				queue.popMin()
+			}
+		})
+
+		b.Run(v.name+"-ConcurrentMixed", func(b *testing.B) {
+			queue := v.newQueue()
+			for i := 0; i < prefill; i++ {
+				queue.push(rand.IntN(prefill))
+			}
+			operationsPerGoroutine := b.N / 8
+			if operationsPerGoroutine < 1 {
+				operationsPerGoroutine = 1
+			}
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < operationsPerGoroutine; j++ {
+						queue.push(rand.IntN(prefill))
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for j := 0; j < operationsPerGoroutine; j++ {
+						queue.popMin()
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// sharedQueuePool is the baseline for the worker pool benchmarks: every worker
+// takes tasks from, and spawns tasks onto, a single LockFreeQueue.
+type sharedQueuePool struct {
+	queue   *LockFreeQueue[func()]
+	pending sync.WaitGroup
+	closed  int32
+	done    sync.WaitGroup
+}
+
+func newSharedQueuePool(workers int) *sharedQueuePool {
+	p := &sharedQueuePool{queue: NewLockFreeQueue[func()]()}
+	p.done.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.done.Done()
+			backoff := minPollInterval
+			for atomic.LoadInt32(&p.closed) == 0 {
+				task, ok := p.queue.Dequeue()
+				if !ok {
+					time.Sleep(backoff)
+					backoff = min(backoff*2, maxPollInterval)
+					continue
+				}
+				backoff = minPollInterval
+				task()
+				p.pending.Done()
+			}
+		}()
+	}
+	return p
+}
+
+func (p *sharedQueuePool) submit(task func()) {
+	p.pending.Add(1)
+	p.queue.Enqueue(task)
+}
+
+func (p *sharedQueuePool) close() {
+	atomic.StoreInt32(&p.closed, 1)
+	p.done.Wait()
+}
+
+// Benchmark the work-stealing pool against workers sharing one queue
+func BenchmarkWorkerPool_ComparisonWithSharedQueue(b *testing.B) {
+	const workers = 8
+
+	// Flat: many independent tasks submitted from outside the pool.
+	b.Run("WorkStealing-Flat", func(b *testing.B) {
+		pool := NewWorkerPool(workers)
+		defer pool.Close()
+		var sum int64
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pool.Submit(func(w *Worker) { atomic.AddInt64(&sum, 1) })
+		}
+		pool.Wait()
+	})
+
+	b.Run("SharedQueue-Flat", func(b *testing.B) {
+		pool := newSharedQueuePool(workers)
+		defer pool.close()
+		var sum int64
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pool.submit(func() { atomic.AddInt64(&sum, 1) })
+		}
+		pool.pending.Wait()
+	})
+
+	// Recursive: each iteration is a binary tree of tasks spawned from
+	// within the pool, the case work stealing is designed for.
+	const depth = 10
+
+	b.Run("WorkStealing-Recursive", func(b *testing.B) {
+		pool := NewWorkerPool(workers)
+		defer pool.Close()
+		var spawnTree func(level int) Task
+		spawnTree = func(level int) Task {
+			return func(w *Worker) {
+				if level == 0 {
+					return
+				}
+				w.Spawn(spawnTree(level - 1))
+				w.Spawn(spawnTree(level - 1))
+			}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pool.Submit(spawnTree(depth))
+			pool.Wait()
+		}
+	})
+
+	b.Run("SharedQueue-Recursive", func(b *testing.B) {
+		pool := newSharedQueuePool(workers)
+		defer pool.close()
+		var spawnTree func(level int) func()
+		spawnTree = func(level int) func() {
+			return func() {
+				if level == 0 {
+					return
+				}
+				pool.submit(spawnTree(level - 1))
+				pool.submit(spawnTree(level - 1))
+			}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pool.submit(spawnTree(depth))
+			pool.pending.Wait()
+		}
+	})
+}
+
+// Benchmark the cost of stats collection
+func BenchmarkQueue_Stats(b *testing.B) {
+	variants := []struct {
+		name string
+		opts []Option
+	}{
+		{"Disabled", nil},
+		{"Enabled", []Option{WithStats()}},
+	}
+
+	for _, v := range variants {
+		b.Run(v.name, func(b *testing.B) {
+			queue := NewLockFreeQueue[int](v.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				queue.Enqueue(i)
+				queue.Dequeue()
+			}
+		})
+	}
+}
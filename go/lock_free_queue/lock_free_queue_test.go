@@ -1,292 +1,923 @@
 package lockfreequeue
 
 import (
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 )
 
-func TestQueue_BasicOperations(t *testing.T) {
-	queue := NewLockFreeQueue[int]()
+// queueImplementation describes a Queue implementation for the shared tests
+// and benchmarks. newQueue must return a queue that can hold at least
+// capacity elements.
+type queueImplementation struct {
+	name           string
+	newQueue       func(capacity int) Queue[int]
+	singleProducer bool // only one goroutine may call Enqueue
+	singleConsumer bool // only one goroutine may call Dequeue and Peek
+	exactSize      bool // Size is linearizable under concurrency
+	weakEmpty      bool // Dequeue may report empty while an Enqueue is in flight
+}
 
-	// Test initial state
-	if !queue.IsEmpty() {
-		t.Error("New queue should be empty")
+// workers returns how many producer and consumer goroutines a concurrent test
+// may run against this implementation, given the number it would like to use.
+func (impl queueImplementation) workers(n int) (producers, consumers int) {
+	producers, consumers = n, n
+	if impl.singleProducer {
+		producers = 1
 	}
-	if queue.Size() != 0 {
-		t.Errorf("New queue should have size 0, got %d", queue.Size())
+	if impl.singleConsumer {
+		consumers = 1
 	}
+	return producers, consumers
+}
 
-	// Test Enqueue
-	queue.Enqueue(1)
-	if queue.IsEmpty() {
-		t.Error("Queue should not be empty after enqueue")
-	}
-	if queue.Size() != 1 {
-		t.Errorf("Queue should have size 1, got %d", queue.Size())
+// queueImplementations lists every Queue implementation the shared tests and
+// benchmarks run against.
+var queueImplementations = []queueImplementation{
+	{name: "LockFreeQueue", newQueue: func(int) Queue[int] { return NewLockFreeQueue[int]() }, exactSize: true},
+	{name: "RecyclingLockFreeQueue", newQueue: func(int) Queue[int] { return NewLockFreeQueue[int](WithNodeRecycling()) }, exactSize: true},
+	{name: "RingQueue", newQueue: func(capacity int) Queue[int] { return NewRingQueue[int](capacity) }},
+	{name: "SPSCQueue", newQueue: func(int) Queue[int] { return NewSPSCQueue[int]() }, singleProducer: true, singleConsumer: true},
+	{name: "MPSCQueue", newQueue: func(int) Queue[int] { return NewMPSCQueue[int]() }, singleConsumer: true, weakEmpty: true},
+}
+
+func TestQueue_BasicOperations(t *testing.T) {
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			queue := impl.newQueue(1)
+
+			// Test initial state
+			if !queue.IsEmpty() {
+				t.Error("New queue should be empty")
+			}
+			if queue.Size() != 0 {
+				t.Errorf("New queue should have size 0, got %d", queue.Size())
+			}
+
+			// Test Enqueue
+			queue.Enqueue(1)
+			if queue.IsEmpty() {
+				t.Error("Queue should not be empty after enqueue")
+			}
+			if queue.Size() != 1 {
+				t.Errorf("Queue should have size 1, got %d", queue.Size())
+			}
+
+			// Test Peek
+			val, ok := queue.Peek()
+			if !ok {
+				t.Error("Peek should succeed on non-empty queue")
+			}
+			if val != 1 {
+				t.Errorf("Peek should return 1, got %d", val)
+			}
+			if queue.Size() != 1 {
+				t.Errorf("Peek should not change queue size, expected 1, got %d", queue.Size())
+			}
+
+			// Test Dequeue
+			val, ok = queue.Dequeue()
+			if !ok {
+				t.Error("Dequeue should succeed on non-empty queue")
+			}
+			if val != 1 {
+				t.Errorf("Dequeue should return 1, got %d", val)
+			}
+			if !queue.IsEmpty() {
+				t.Error("Queue should be empty after dequeuing only element")
+			}
+
+			// Test empty queue operations
+			val, ok = queue.Peek()
+			if ok {
+				t.Error("Peek should fail on empty queue")
+			}
+
+			val, ok = queue.Dequeue()
+			if ok {
+				t.Error("Dequeue should fail on empty queue")
+			}
+		})
 	}
+}
 
-	// Test Peek
-	val, ok := queue.Peek()
-	if !ok {
-		t.Error("Peek should succeed on non-empty queue")
+func TestQueue_FIFO(t *testing.T) {
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			queue := impl.newQueue(3)
+
+			// Enqueue multiple elements
+			queue.Enqueue(1)
+			queue.Enqueue(2)
+			queue.Enqueue(3)
+
+			// Verify FIFO order
+			for i := 1; i <= 3; i++ {
+				val, ok := queue.Dequeue()
+				if !ok {
+					t.Errorf("Dequeue #%d should succeed", i)
+				}
+				if val != i {
+					t.Errorf("Expected %d, got %d", i, val)
+				}
+			}
+		})
 	}
-	if val != 1 {
-		t.Errorf("Peek should return 1, got %d", val)
+}
+
+func TestQueue_ConcurrentEnqueueDequeue(t *testing.T) {
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			itemCount := 1000
+			workerCount := 4
+			queue := impl.newQueue(workerCount * itemCount)
+
+			// Split the same total work across as many goroutines as the
+			// implementation allows.
+			producers, consumers := impl.workers(workerCount)
+			total := workerCount * itemCount
+
+			// Use a wait group to synchronize goroutines
+			var wg sync.WaitGroup
+
+			// Launch producer goroutines
+			for w := 0; w < producers; w++ {
+				wg.Add(1)
+				go func(workerID int) {
+					defer wg.Done()
+					perProducer := total / producers
+					for i := 0; i < perProducer; i++ {
+						queue.Enqueue(workerID*perProducer + i)
+					}
+				}(w)
+			}
+
+			// Wait for enqueuing to finish
+			wg.Wait()
+
+			// Verify queue size
+			if queue.Size() != total {
+				t.Errorf("Expected queue size %d, got %d", total, queue.Size())
+			}
+
+			// Launch consumer goroutines
+			var consumed sync.Map
+			for w := 0; w < consumers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < total/consumers; i++ {
+						val, ok := queue.Dequeue()
+						if !ok {
+							t.Error("Dequeue failed unexpectedly")
+							return
+						}
+						consumed.Store(val, true)
+					}
+				}()
+			}
+
+			// Wait for dequeuing to finish
+			wg.Wait()
+
+			// Verify all items were consumed
+			for val := 0; val < total; val++ {
+				if _, exists := consumed.Load(val); !exists {
+					t.Errorf("Item %d was not consumed", val)
+				}
+			}
+
+			// Verify queue is empty
+			if !queue.IsEmpty() {
+				t.Error("Queue should be empty after all dequeues")
+			}
+		})
 	}
-	if queue.Size() != 1 {
-		t.Errorf("Peek should not change queue size, expected 1, got %d", queue.Size())
+}
+
+func TestQueue_StressTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stress test in short mode")
 	}
 
-	// Test Dequeue
-	val, ok = queue.Dequeue()
-	if !ok {
-		t.Error("Dequeue should succeed on non-empty queue")
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			const iterations = 10000 // Reduced for stability
+			const workerCount = 4    // Reduced for stability
+			queue := impl.newQueue(workerCount * iterations)
+			producers, consumers := impl.workers(workerCount)
+
+			// Count of completed operations
+			var enqueueDone int64
+			var dequeueDone int64
+
+			var wg sync.WaitGroup
+
+			// Barrier to start all goroutines at around the same time
+			var startBarrier, finishBarrier sync.WaitGroup
+			startBarrier.Add(1)
+
+			// Start concurrent enqueue workers
+			wg.Add(producers)
+			for i := 0; i < producers; i++ {
+				go func(id int) {
+					defer wg.Done()
+					// Wait for the start signal
+					startBarrier.Wait()
+
+					for j := 0; j < workerCount*iterations/producers; j++ {
+						queue.Enqueue(j)
+						atomic.AddInt64(&enqueueDone, 1)
+					}
+					// Signal this goroutine is done with enqueues
+					finishBarrier.Done()
+				}(i)
+			}
+
+			// Start concurrent dequeue workers
+			wg.Add(consumers)
+			finishBarrier.Add(producers + consumers) // For all producers and consumers
+
+			for i := 0; i < consumers; i++ {
+				go func() {
+					defer wg.Done()
+					// Wait for the start signal
+					startBarrier.Wait()
+
+					for j := 0; j < workerCount*iterations/consumers; j++ {
+						// Try to dequeue with exponential backoff
+						var success bool
+						backoff := 1 * time.Nanosecond
+						maxBackoff := 100 * time.Microsecond
+
+						for !success {
+							if _, ok := queue.Dequeue(); ok {
+								atomic.AddInt64(&dequeueDone, 1)
+								success = true
+							} else {
+								// If queue is empty, back off a bit
+								time.Sleep(backoff)
+								// Exponential backoff with a cap
+								backoff *= 2
+								if backoff > maxBackoff {
+									backoff = maxBackoff
+								}
+							}
+						}
+					}
+					// Signal this goroutine is done with dequeues
+					finishBarrier.Done()
+				}()
+			}
+
+			// Now start all goroutines at once
+			startBarrier.Done()
+
+			// Wait for all operations to complete
+			finishBarrier.Wait()
+
+			// Verify all operations completed
+			expectedOps := int64(workerCount * iterations)
+			if atomic.LoadInt64(&enqueueDone) != expectedOps {
+				t.Errorf("Expected %d enqueues, got %d", expectedOps, atomic.LoadInt64(&enqueueDone))
+			}
+			if atomic.LoadInt64(&dequeueDone) != expectedOps {
+				t.Errorf("Expected %d dequeues, got %d", expectedOps, atomic.LoadInt64(&dequeueDone))
+			}
+
+			// Wait for any pending operations to complete
+			wg.Wait()
+
+			// Give extra time for any pending operations
+			time.Sleep(500 * time.Millisecond)
+
+			// Final queue size should be 0 since we have equal enqueues and dequeues
+			qSize := queue.Size()
+			if qSize != 0 {
+				// For debugging
+				t.Logf("Enqueues: %d, Dequeues: %d", atomic.LoadInt64(&enqueueDone), atomic.LoadInt64(&dequeueDone))
+
+				// Force empty the queue to debug what's still in it
+				var remaining []int
+				for i := 0; i < 100 && !queue.IsEmpty(); i++ {
+					if val, ok := queue.Dequeue(); ok {
+						remaining = append(remaining, val)
+					}
+				}
+
+				t.Errorf("Queue size should be 0 after equal enqueues and dequeues, got %d. Remaining items: %v", qSize, remaining)
+			} else {
+				t.Log("Queue successfully emptied")
+			}
+		})
 	}
-	if val != 1 {
-		t.Errorf("Dequeue should return 1, got %d", val)
+}
+
+func TestQueue_PerProducerFIFO(t *testing.T) {
+	for _, impl := range queueImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			const itemCount = 2000
+			producers, _ := impl.workers(4)
+			queue := impl.newQueue(producers * itemCount)
+
+			// Producers enqueue increasing sequence numbers tagged with their ID
+			var wg sync.WaitGroup
+			for w := 0; w < producers; w++ {
+				wg.Add(1)
+				go func(workerID int) {
+					defer wg.Done()
+					for i := 0; i < itemCount; i++ {
+						queue.Enqueue(workerID*itemCount + i)
+					}
+				}(w)
+			}
+
+			// A single consumer must see each producer's items in order
+			last := make([]int, producers)
+			for i := range last {
+				last[i] = -1
+			}
+			for received := 0; received < producers*itemCount; {
+				val, ok := queue.Dequeue()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				workerID, seq := val/itemCount, val%itemCount
+				if seq <= last[workerID] {
+					t.Fatalf("Producer %d: item %d dequeued after %d", workerID, seq, last[workerID])
+				}
+				last[workerID] = seq
+				received++
+			}
+
+			wg.Wait()
+		})
 	}
-	if !queue.IsEmpty() {
-		t.Error("Queue should be empty after dequeuing only element")
+}
+
+// Test different types
+func TestQueue_DifferentTypes(t *testing.T) {
+	// String queue
+	strQueue := NewLockFreeQueue[string]()
+	strQueue.Enqueue("hello")
+	strQueue.Enqueue("world")
+
+	val, ok := strQueue.Dequeue()
+	if !ok || val != "hello" {
+		t.Errorf("Expected 'hello', got '%s'", val)
 	}
 
-	// Test empty queue operations
-	val, ok = queue.Peek()
-	if ok {
-		t.Error("Peek should fail on empty queue")
+	// Struct queue
+	type Person struct {
+		Name string
+		Age  int
 	}
 
-	val, ok = queue.Dequeue()
-	if ok {
-		t.Error("Dequeue should fail on empty queue")
+	personQueue := NewLockFreeQueue[Person]()
+	personQueue.Enqueue(Person{Name: "Alice", Age: 30})
+	personQueue.Enqueue(Person{Name: "Bob", Age: 25})
+
+	person, ok := personQueue.Dequeue()
+	if !ok || person.Name != "Alice" || person.Age != 30 {
+		t.Errorf("Expected Person{Name: 'Alice', Age: 30}, got %+v", person)
 	}
 }
 
-func TestQueue_FIFO(t *testing.T) {
+func TestQueue_BatchOperations(t *testing.T) {
 	queue := NewLockFreeQueue[int]()
 
-	// Enqueue multiple elements
-	queue.Enqueue(1)
-	queue.Enqueue(2)
-	queue.Enqueue(3)
+	// Empty batches are no-ops
+	queue.EnqueueBatch(nil)
+	if !queue.IsEmpty() {
+		t.Error("Queue should be empty after enqueuing an empty batch")
+	}
+	if n := queue.DequeueBatch(make([]int, 4), 4); n != 0 {
+		t.Errorf("DequeueBatch on empty queue should return 0, got %d", n)
+	}
 
-	// Verify FIFO order
-	for i := 1; i <= 3; i++ {
-		val, ok := queue.Dequeue()
-		if !ok {
-			t.Errorf("Dequeue #%d should succeed", i)
-		}
+	queue.Enqueue(0)
+	queue.EnqueueBatch([]int{1, 2, 3, 4, 5})
+	queue.Enqueue(6)
+	if queue.Size() != 7 {
+		t.Errorf("Queue should have size 7, got %d", queue.Size())
+	}
+
+	// max is capped by len(dst)
+	dst := make([]int, 3)
+	if n := queue.DequeueBatch(dst, 10); n != 3 {
+		t.Fatalf("Expected 3 items, got %d", n)
+	}
+	for i, val := range dst {
 		if val != i {
 			t.Errorf("Expected %d, got %d", i, val)
 		}
 	}
+
+	// dst is bigger than max
+	dst = make([]int, 10)
+	if n := queue.DequeueBatch(dst, 2); n != 2 {
+		t.Fatalf("Expected 2 items, got %d", n)
+	}
+	if dst[0] != 3 || dst[1] != 4 {
+		t.Errorf("Expected [3 4], got %v", dst[:2])
+	}
+
+	// Fewer items than requested
+	if n := queue.DequeueBatch(dst, 10); n != 2 {
+		t.Fatalf("Expected 2 items, got %d", n)
+	}
+	if dst[0] != 5 || dst[1] != 6 {
+		t.Errorf("Expected [5 6], got %v", dst[:2])
+	}
+
+	if !queue.IsEmpty() {
+		t.Error("Queue should be empty after draining all batches")
+	}
+
+	// The queue keeps working after being drained by a batch
+	queue.Enqueue(7)
+	if val, ok := queue.Dequeue(); !ok || val != 7 {
+		t.Errorf("Expected 7, got %d (ok=%v)", val, ok)
+	}
 }
 
-func TestQueue_ConcurrentEnqueueDequeue(t *testing.T) {
+func TestQueue_ConcurrentBatches(t *testing.T) {
 	queue := NewLockFreeQueue[int]()
-	itemCount := 1000
-	workerCount := 4
+	const batchCount = 250
+	const batchSize = 8
+	const workerCount = 4
+	const total = workerCount * batchCount * batchSize
 
-	// Use a wait group to synchronize goroutines
 	var wg sync.WaitGroup
+	var dequeued int64
+	var consumed sync.Map
 
-	// Launch producer goroutines
+	// Launch producer goroutines that enqueue batches of consecutive values
 	for w := 0; w < workerCount; w++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
-			for i := 0; i < itemCount; i++ {
-				queue.Enqueue(workerID*itemCount + i)
+			batch := make([]int, batchSize)
+			for b := 0; b < batchCount; b++ {
+				for i := range batch {
+					batch[i] = (workerID*batchCount+b)*batchSize + i
+				}
+				queue.EnqueueBatch(batch)
 			}
 		}(w)
 	}
 
-	// Wait for enqueuing to finish
-	wg.Wait()
-
-	// Verify queue size
-	expectedSize := workerCount * itemCount
-	if queue.Size() != expectedSize {
-		t.Errorf("Expected queue size %d, got %d", expectedSize, queue.Size())
-	}
-
-	// Launch consumer goroutines
-	var consumed sync.Map
+	// Launch consumer goroutines mixing batch and single dequeues
 	for w := 0; w < workerCount; w++ {
 		wg.Add(1)
-		go func() {
+		go func(workerID int) {
 			defer wg.Done()
-			for i := 0; i < itemCount; i++ {
-				val, ok := queue.Dequeue()
-				if !ok {
-					t.Error("Dequeue failed unexpectedly")
-					return
+			dst := make([]int, batchSize+workerID)
+			for atomic.LoadInt64(&dequeued) < total {
+				var n int
+				if workerID%2 == 0 {
+					n = queue.DequeueBatch(dst, len(dst))
+				} else if val, ok := queue.Dequeue(); ok {
+					dst[0] = val
+					n = 1
+				}
+				for _, val := range dst[:n] {
+					if _, dup := consumed.LoadOrStore(val, true); dup {
+						t.Errorf("Item %d was dequeued twice", val)
+					}
 				}
-				consumed.Store(val, true)
+				atomic.AddInt64(&dequeued, int64(n))
 			}
-		}()
+		}(w)
 	}
 
-	// Wait for dequeuing to finish
 	wg.Wait()
 
-	// Verify all items were consumed
-	for w := 0; w < workerCount; w++ {
-		for i := 0; i < itemCount; i++ {
-			val := w*itemCount + i
-			if _, exists := consumed.Load(val); !exists {
-				t.Errorf("Item %d was not consumed", val)
-			}
+	for val := 0; val < total; val++ {
+		if _, exists := consumed.Load(val); !exists {
+			t.Errorf("Item %d was not consumed", val)
 		}
 	}
-
-	// Verify queue is empty
 	if !queue.IsEmpty() {
 		t.Error("Queue should be empty after all dequeues")
 	}
 }
 
-func TestQueue_StressTest(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping stress test in short mode")
-	}
-
+func TestQueue_ClearAndDrain(t *testing.T) {
 	queue := NewLockFreeQueue[int]()
-	const iterations = 10000 // Reduced for stability
-	const workerCount = 4    // Reduced for stability
 
-	// Count of completed operations
-	var enqueueDone int64
-	var dequeueDone int64
+	// Clearing or draining an empty queue is a no-op
+	queue.Clear()
+	for range queue.Drain() {
+		t.Error("Drain should not yield from an empty queue")
+	}
 
-	var wg sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		queue.Enqueue(i)
+	}
 
-	// Barrier to start all goroutines at around the same time
-	var startBarrier, finishBarrier sync.WaitGroup
-	startBarrier.Add(1)
+	var drained []int
+	for val := range queue.Drain() {
+		drained = append(drained, val)
+	}
+	if len(drained) != 5 {
+		t.Fatalf("Expected 5 drained items, got %v", drained)
+	}
+	for i, val := range drained {
+		if val != i+1 {
+			t.Errorf("Expected %d, got %d", i+1, val)
+		}
+	}
+	if !queue.IsEmpty() || queue.Size() != 0 {
+		t.Errorf("Queue should be empty after Drain, size %d", queue.Size())
+	}
 
-	// Start concurrent enqueue workers
-	wg.Add(workerCount)
-	for i := 0; i < workerCount; i++ {
-		go func(id int) {
-			defer wg.Done()
-			// Wait for the start signal
-			startBarrier.Wait()
+	// Stopping early puts the rest of the detached elements back, in order,
+	// behind anything enqueued in the meantime
+	for i := 1; i <= 5; i++ {
+		queue.Enqueue(i)
+	}
+	drained = drained[:0]
+	for val := range queue.Drain() {
+		drained = append(drained, val)
+		if val == 2 {
+			queue.Enqueue(6)
+			break
+		}
+	}
+	if len(drained) != 2 {
+		t.Errorf("Expected Drain to stop after 2 items, got %v", drained)
+	}
+	for _, expected := range []int{6, 3, 4, 5} {
+		if val, ok := queue.Dequeue(); !ok || val != expected {
+			t.Errorf("Expected %d, got %d (ok=%v)", expected, val, ok)
+		}
+	}
+	if !queue.IsEmpty() {
+		t.Error("Queue should be empty after dequeuing the remaining items")
+	}
 
-			for j := 0; j < iterations; j++ {
-				queue.Enqueue(j)
-				atomic.AddInt64(&enqueueDone, 1)
-			}
-			// Signal this goroutine is done with enqueues
-			finishBarrier.Done()
-		}(i)
+	// Clear empties the queue and it keeps working afterwards
+	queue.Enqueue(6)
+	queue.Enqueue(7)
+	queue.Clear()
+	if !queue.IsEmpty() || queue.Size() != 0 {
+		t.Errorf("Queue should be empty after Clear, size %d", queue.Size())
+	}
+	queue.Enqueue(8)
+	if val, ok := queue.Dequeue(); !ok || val != 8 {
+		t.Errorf("Expected 8, got %d (ok=%v)", val, ok)
 	}
+}
+
+func TestQueue_DrainWithActiveProducers(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithNodeRecycling()}} {
+		queue := NewLockFreeQueue[int](opts...)
+		const itemCount = 5000
+		const workerCount = 4
+
+		var wg sync.WaitGroup
+		var producersDone int32
+
+		for w := 0; w < workerCount; w++ {
+			wg.Add(1)
+			go func(workerID int) {
+				defer wg.Done()
+				for i := 0; i < itemCount; i++ {
+					queue.Enqueue(workerID*itemCount + i)
+				}
+			}(w)
+		}
 
-	// Start concurrent dequeue workers
-	wg.Add(workerCount)
-	finishBarrier.Add(workerCount * 2) // For all producers and consumers
+		// Drain and Dequeue concurrently with the producers; every item must
+		// come out exactly once and in per-producer order.
+		seen := make(map[int]bool)
+		last := make([]int, workerCount)
+		for i := range last {
+			last[i] = -1
+		}
+		record := func(val int) bool {
+			if seen[val] {
+				t.Errorf("Item %d was received twice", val)
+			}
+			seen[val] = true
+			workerID, seq := val/itemCount, val%itemCount
+			if seq <= last[workerID] {
+				t.Errorf("Producer %d: item %d received after %d", workerID, seq, last[workerID])
+			}
+			last[workerID] = seq
+			return true
+		}
 
-	for i := 0; i < workerCount; i++ {
 		go func() {
-			defer wg.Done()
-			// Wait for the start signal
-			startBarrier.Wait()
+			wg.Wait()
+			atomic.StoreInt32(&producersDone, 1)
+		}()
 
-			for j := 0; j < iterations; j++ {
-				// Try to dequeue with exponential backoff
-				var success bool
-				backoff := 1 * time.Nanosecond
-				maxBackoff := 100 * time.Microsecond
+		for atomic.LoadInt32(&producersDone) == 0 {
+			queue.Drain()(record)
+			if val, ok := queue.Dequeue(); ok {
+				record(val)
+			}
+			runtime.Gosched()
+		}
+		queue.Drain()(record)
 
-				for !success {
-					if _, ok := queue.Dequeue(); ok {
-						atomic.AddInt64(&dequeueDone, 1)
-						success = true
-					} else {
-						// If queue is empty, back off a bit
-						time.Sleep(backoff)
-						// Exponential backoff with a cap
-						backoff *= 2
-						if backoff > maxBackoff {
-							backoff = maxBackoff
-						}
-					}
+		if len(seen) != workerCount*itemCount {
+			t.Errorf("Expected %d items, got %d", workerCount*itemCount, len(seen))
+		}
+		if !queue.IsEmpty() {
+			t.Error("Queue should be empty after the final Drain")
+		}
+	}
+}
+
+func TestQueue_ClearWithActiveProducers(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithNodeRecycling()}} {
+		queue := NewLockFreeQueue[int](opts...)
+		const itemCount = 5000
+		const workerCount = 4
+
+		var wg sync.WaitGroup
+		for w := 0; w < workerCount; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < itemCount; i++ {
+					queue.Enqueue(i)
 				}
+			}()
+		}
+
+		// Clear repeatedly while producers are running, alongside consumers.
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				queue.Clear()
+				runtime.Gosched()
 			}
-			// Signal this goroutine is done with dequeues
-			finishBarrier.Done()
 		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < itemCount; i++ {
+				queue.Dequeue()
+			}
+		}()
+		wg.Wait()
+
+		// The queue must still be a well-formed FIFO: whatever is left is
+		// removed by one more Clear, and new items come out in order.
+		queue.Clear()
+		if !queue.IsEmpty() {
+			t.Error("Queue should be empty after Clear")
+		}
+		for i := 0; i < 10; i++ {
+			queue.Enqueue(i)
+		}
+		for i := 0; i < 10; i++ {
+			if val, ok := queue.Dequeue(); !ok || val != i {
+				t.Fatalf("Expected %d, got %d (ok=%v)", i, val, ok)
+			}
+		}
+		if !queue.IsEmpty() {
+			t.Error("Queue should be empty after all dequeues")
+		}
 	}
+}
+
+func TestQueue_All(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithNodeRecycling()}} {
+		queue := NewLockFreeQueue[int](opts...)
 
-	// Now start all goroutines at once
-	startBarrier.Done()
+		for range queue.All() {
+			t.Error("All should not yield from an empty queue")
+		}
 
-	// Wait for all operations to complete
-	finishBarrier.Wait()
+		for i := 1; i <= 5; i++ {
+			queue.Enqueue(i)
+		}
 
-	// Verify all operations completed
-	expectedOps := int64(workerCount * iterations)
-	if atomic.LoadInt64(&enqueueDone) != expectedOps {
-		t.Errorf("Expected %d enqueues, got %d", expectedOps, atomic.LoadInt64(&enqueueDone))
+		var seen []int
+		for val := range queue.All() {
+			seen = append(seen, val)
+			// Elements enqueued after iteration started are not yielded
+			queue.Enqueue(val + 100)
+		}
+		if len(seen) != 5 {
+			t.Fatalf("Expected 5 items, got %v", seen)
+		}
+		for i, val := range seen {
+			if val != i+1 {
+				t.Errorf("Expected %d, got %d", i+1, val)
+			}
+		}
+
+		// All does not consume
+		if queue.Size() != 10 {
+			t.Errorf("Expected size 10, got %d", queue.Size())
+		}
+
+		// Breaking out early stops the traversal
+		count := 0
+		for range queue.All() {
+			count++
+			if count == 3 {
+				break
+			}
+		}
+		if count != 3 {
+			t.Errorf("Expected to stop after 3 items, got %d", count)
+		}
 	}
-	if atomic.LoadInt64(&dequeueDone) != expectedOps {
-		t.Errorf("Expected %d dequeues, got %d", expectedOps, atomic.LoadInt64(&dequeueDone))
+}
+
+func TestQueue_AllWithConcurrentDequeues(t *testing.T) {
+	queue := NewLockFreeQueue[int](WithNodeRecycling())
+	const itemCount = 10000
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < itemCount; i++ {
+			queue.Enqueue(i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for received := 0; received < itemCount; {
+			if _, ok := queue.Dequeue(); ok {
+				received++
+			} else {
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	// Traversals must always see values in increasing order, even while
+	// the nodes they walk are being dequeued and recycled.
+	for i := 0; i < 200; i++ {
+		last := -1
+		for val := range queue.All() {
+			if val <= last {
+				t.Fatalf("All yielded %d after %d", val, last)
+			}
+			last = val
+		}
+		runtime.Gosched()
 	}
 
-	// Wait for any pending operations to complete
 	wg.Wait()
+}
 
-	// Give extra time for any pending operations
-	time.Sleep(500 * time.Millisecond)
+func TestQueue_Snapshot(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithNodeRecycling()}} {
+		queue := NewLockFreeQueue[int](opts...)
 
-	// Force a size reset to ensure accuracy
-	queue.ResetSize()
+		if snapshot := queue.Snapshot(); len(snapshot) != 0 {
+			t.Errorf("Snapshot of empty queue should be empty, got %v", snapshot)
+		}
 
-	// Final queue size should be 0 since we have equal enqueues and dequeues
-	qSize := queue.Size()
-	if qSize != 0 {
-		// For debugging
-		t.Logf("Enqueues: %d, Dequeues: %d", atomic.LoadInt64(&enqueueDone), atomic.LoadInt64(&dequeueDone))
+		for i := 0; i < 5; i++ {
+			queue.Enqueue(i)
+		}
+		queue.EnqueueBatch([]int{5, 6})
+		queue.Dequeue()
 
-		// Force empty the queue to debug what's still in it
-		var remaining []int
-		for i := 0; i < 100 && !queue.IsEmpty(); i++ {
-			if val, ok := queue.Dequeue(); ok {
-				remaining = append(remaining, val)
+		snapshot := queue.Snapshot()
+		if len(snapshot) != 6 {
+			t.Fatalf("Expected 6 items, got %v", snapshot)
+		}
+		for i, val := range snapshot {
+			if val != i+1 {
+				t.Errorf("Expected %d, got %d", i+1, val)
 			}
 		}
 
-		t.Errorf("Queue size should be 0 after equal enqueues and dequeues, got %d. Remaining items: %v", qSize, remaining)
-	} else {
-		t.Log("Queue successfully emptied")
+		// The snapshot is a copy
+		snapshot[0] = 100
+		if val, _ := queue.Peek(); val != 1 {
+			t.Errorf("Modifying the snapshot changed the queue, front is %d", val)
+		}
+		if queue.Size() != 6 {
+			t.Errorf("Snapshot should not consume, size %d", queue.Size())
+		}
 	}
 }
 
-// Test different types
-func TestQueue_DifferentTypes(t *testing.T) {
-	// String queue
-	strQueue := NewLockFreeQueue[string]()
-	strQueue.Enqueue("hello")
-	strQueue.Enqueue("world")
+func TestQueue_SizeUnderContention(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithNodeRecycling()}} {
+		queue := NewLockFreeQueue[int](opts...)
+		const producers = 4
+		const itemsPerProducer = 5000
+
+		var enqueued int64
+		var done int32
+		var wg sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < itemsPerProducer; i++ {
+					queue.Enqueue(i)
+					atomic.AddInt64(&enqueued, 1)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < itemsPerProducer/2; {
+					if _, ok := queue.Dequeue(); ok {
+						i++
+					} else {
+						runtime.Gosched()
+					}
+				}
+			}()
+		}
 
-	val, ok := strQueue.Dequeue()
-	if !ok || val != "hello" {
-		t.Errorf("Expected 'hello', got '%s'", val)
-	}
+		// Size must never go negative or exceed what has been enqueued.
+		// enqueued is read after the size and trails the queue by at most
+		// one in-flight element per producer.
+		var readers sync.WaitGroup
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for atomic.LoadInt32(&done) == 0 {
+				size := queue.Size()
+				upper := atomic.LoadInt64(&enqueued) + producers
+				if size < 0 || int64(size) > upper {
+					t.Errorf("Size %d outside [0, %d]", size, upper)
+					return
+				}
+				runtime.Gosched()
+			}
+		}()
 
-	// Struct queue
-	type Person struct {
-		Name string
-		Age  int
+		wg.Wait()
+		atomic.StoreInt32(&done, 1)
+		readers.Wait()
+
+		// At quiescence the size is exact, without any repair step.
+		expected := producers*itemsPerProducer - producers*(itemsPerProducer/2)
+		if queue.Size() != expected {
+			t.Errorf("Expected size %d, got %d", expected, queue.Size())
+		}
+		if len(queue.Snapshot()) != expected {
+			t.Errorf("Expected snapshot of %d items, got %d", expected, len(queue.Snapshot()))
+		}
 	}
+}
 
-	personQueue := NewLockFreeQueue[Person]()
-	personQueue.Enqueue(Person{Name: "Alice", Age: 30})
-	personQueue.Enqueue(Person{Name: "Bob", Age: 25})
+func TestQueue_SnapshotUnderContention(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithNodeRecycling()}} {
+		queue := NewLockFreeQueue[int](opts...)
+		const producers = 2
+		const itemsPerProducer = 10000
+
+		var wg sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			wg.Add(2)
+			go func(id int) {
+				defer wg.Done()
+				for i := 0; i < itemsPerProducer; i++ {
+					queue.Enqueue(id*itemsPerProducer + i)
+				}
+			}(p)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < itemsPerProducer; {
+					if _, ok := queue.Dequeue(); ok {
+						i++
+					} else {
+						runtime.Gosched()
+					}
+				}
+			}()
+		}
 
-	person, ok := personQueue.Dequeue()
-	if !ok || person.Name != "Alice" || person.Age != 30 {
-		t.Errorf("Expected Person{Name: 'Alice', Age: 30}, got %+v", person)
+		// At any instant the queue holds, for each producer, a run of
+		// consecutive values: everything it enqueued that was not dequeued
+		// yet. A snapshot mixing two instants would show a gap or a value
+		// out of order in some producer's run.
+		for s := 0; s < 200; s++ {
+			last := make([]int, producers)
+			for p := range last {
+				last[p] = -1
+			}
+			for _, val := range queue.Snapshot() {
+				p := val / itemsPerProducer
+				if last[p] >= 0 && val != last[p]+1 {
+					t.Fatalf("Snapshot has %d after %d", val, last[p])
+				}
+				last[p] = val
+			}
+			runtime.Gosched()
+		}
+
+		wg.Wait()
 	}
 }
@@ -0,0 +1,101 @@
+package lockfreequeue
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// MPSCQueue is an unbounded queue for any number of producer goroutines and
+// exactly one consumer goroutine, based on Dmitry Vyukov's MPSC queue.
+// Producers link nodes with a single atomic swap instead of a CAS loop, and
+// the consumer never contends with other consumers.
+//
+// Dequeue and Peek must only be called by the consumer. Enqueue, Size and
+// IsEmpty are safe from any goroutine.
+//
+// A producer that has swapped the tail but not yet linked its node hides
+// every element enqueued after it until the link is written, so the consumer
+// can briefly observe the queue as empty while producers are mid-Enqueue.
+type MPSCQueue[T any] struct {
+	_        cacheLinePad
+	head     unsafe.Pointer // sentinel node, owned by the consumer
+	dequeued uint64         // written only by the consumer
+	_        cacheLinePad
+	tail     unsafe.Pointer // last node, swapped by producers
+	enqueued uint64         // incremented by producers
+	_        cacheLinePad
+}
+
+// NewMPSCQueue initializes a new multi-producer single-consumer queue with a
+// sentinel node.
+func NewMPSCQueue[T any]() *MPSCQueue[T] {
+	sentinel := unsafe.Pointer(&Node[T]{})
+	return &MPSCQueue[T]{
+		head: sentinel,
+		tail: sentinel,
+	}
+}
+
+// Enqueue inserts an element at the end of the queue.
+func (q *MPSCQueue[T]) Enqueue(value T) {
+	newNode := unsafe.Pointer(&Node[T]{value: value})
+
+	// Claim the tail position, then link the previous tail to the new node.
+	prev := atomic.SwapPointer(&q.tail, newNode)
+	atomic.StorePointer(&((*Node[T])(prev).next), newNode)
+	atomic.AddUint64(&q.enqueued, 1)
+}
+
+// Dequeue removes and returns the element at the front of the queue.
+// It returns the zero value of T and false if the queue is empty.
+// It must only be called from the consumer goroutine.
+func (q *MPSCQueue[T]) Dequeue() (T, bool) {
+	var zeroValue T
+
+	head := atomic.LoadPointer(&q.head)
+	next := atomic.LoadPointer(&((*Node[T])(head).next))
+	if next == nil {
+		return zeroValue, false
+	}
+
+	// next becomes the new sentinel; clear its value so the GC can reclaim it.
+	nextNode := (*Node[T])(next)
+	value := nextNode.value
+	nextNode.value = zeroValue
+
+	atomic.StorePointer(&q.head, next)
+	atomic.StoreUint64(&q.dequeued, atomic.LoadUint64(&q.dequeued)+1)
+	return value, true
+}
+
+// Peek returns the value at the front of the queue without removing it.
+// It returns the zero value of T and false if the queue is empty.
+// It must only be called from the consumer goroutine.
+func (q *MPSCQueue[T]) Peek() (T, bool) {
+	var zeroValue T
+
+	head := atomic.LoadPointer(&q.head)
+	next := atomic.LoadPointer(&((*Node[T])(head).next))
+	if next == nil {
+		return zeroValue, false
+	}
+	return (*Node[T])(next).value, true
+}
+
+// Size returns the current size of the queue.
+func (q *MPSCQueue[T]) Size() int {
+	// Producers count an element only after linking it, so the consumer's
+	// counter can briefly be ahead. Clamp instead of going negative.
+	dequeued := atomic.LoadUint64(&q.dequeued)
+	enqueued := atomic.LoadUint64(&q.enqueued)
+	if enqueued < dequeued {
+		return 0
+	}
+	return int(enqueued - dequeued)
+}
+
+// IsEmpty returns true if the queue is empty.
+func (q *MPSCQueue[T]) IsEmpty() bool {
+	head := atomic.LoadPointer(&q.head)
+	return atomic.LoadPointer(&((*Node[T])(head).next)) == nil
+}
@@ -0,0 +1,331 @@
+package lockfreequeue
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	// hazardsPerRecord is the number of nodes a single operation may need
+	// to protect at once (the head or tail, and its successor).
+	hazardsPerRecord = 2
+
+	// retireThreshold is how many retired nodes a record collects before it
+	// scans the hazard pointers and moves the unreferenced ones to its free list.
+	retireThreshold = 64
+
+	// maxFreeNodes bounds the free list of a record so that a burst of
+	// dequeues cannot pin an unbounded amount of memory.
+	maxFreeNodes = 1024
+)
+
+// hazardRecord belongs to exactly one in-flight queue operation at a time.
+// It publishes the nodes that operation is about to dereference, and keeps the
+// nodes the operation retired or can reuse. Only the owner touches retired and
+// free, so they need no synchronization.
+type hazardRecord[T any] struct {
+	hazards [hazardsPerRecord]unsafe.Pointer
+	active  int32            // 1 while owned by an operation
+	next    *hazardRecord[T] // immutable once the record is published
+	retired []unsafe.Pointer // dequeued nodes that may still be referenced
+	free    []*Node[T]       // nodes no operation can reference any more
+	scratch []unsafe.Pointer // reused buffer for scanning hazard pointers
+}
+
+// nodeRecycler implements hazard pointer based safe memory reclamation for
+// LockFreeQueue nodes. Before dereferencing a node an operation publishes it
+// in a hazard slot and re-validates that the node is still reachable; a
+// retired node is only reused once no hazard slot points to it. This stops a
+// node from being recycled under a concurrent operation, so a CAS can never
+// succeed against a node that was dequeued and re-enqueued in between (ABA).
+type nodeRecycler[T any] struct {
+	records unsafe.Pointer // *hazardRecord[T], push-only list of all records
+	pool    sync.Pool      // idle records, for cheap reuse across goroutines
+	walkers int64          // traversals in progress, see pinWalk
+}
+
+// acquire returns a record owned exclusively by the caller until release.
+func (r *nodeRecycler[T]) acquire() *hazardRecord[T] {
+	if rec, ok := r.pool.Get().(*hazardRecord[T]); ok {
+		if atomic.CompareAndSwapInt32(&rec.active, 0, 1) {
+			return rec
+		}
+	}
+
+	// The pool may have dropped idle records; look for one in the list.
+	for rec := (*hazardRecord[T])(atomic.LoadPointer(&r.records)); rec != nil; rec = rec.next {
+		if atomic.LoadInt32(&rec.active) == 0 && atomic.CompareAndSwapInt32(&rec.active, 0, 1) {
+			return rec
+		}
+	}
+
+	// Every record is busy, publish a new one.
+	rec := &hazardRecord[T]{active: 1}
+	for {
+		head := atomic.LoadPointer(&r.records)
+		rec.next = (*hazardRecord[T])(head)
+		if atomic.CompareAndSwapPointer(&r.records, head, unsafe.Pointer(rec)) {
+			return rec
+		}
+	}
+}
+
+// pinWalk stops retired nodes from being reused until the matching unpinWalk.
+// Traversals that follow many next pointers use it instead of protecting
+// every node they pass with a hazard pointer: a walk that starts after pinWalk
+// only reaches nodes that were still linked, and nothing retired before or
+// during the walk is reused while it runs.
+func (r *nodeRecycler[T]) pinWalk() {
+	atomic.AddInt64(&r.walkers, 1)
+}
+
+// unpinWalk ends a traversal started with pinWalk.
+func (r *nodeRecycler[T]) unpinWalk() {
+	atomic.AddInt64(&r.walkers, -1)
+}
+
+// release clears the hazard pointers of rec and hands it back for reuse.
+func (r *nodeRecycler[T]) release(rec *hazardRecord[T]) {
+	for i := range rec.hazards {
+		atomic.StorePointer(&rec.hazards[i], nil)
+	}
+	atomic.StoreInt32(&rec.active, 0)
+	r.pool.Put(rec)
+}
+
+// protect publishes node in hazard slot i of rec.
+func (rec *hazardRecord[T]) protect(i int, node unsafe.Pointer) {
+	atomic.StorePointer(&rec.hazards[i], node)
+}
+
+// newNode returns a node holding value, reusing a free node when possible.
+func (rec *hazardRecord[T]) newNode(value T) unsafe.Pointer {
+	if n := len(rec.free); n > 0 {
+		node := rec.free[n-1]
+		rec.free[n-1] = nil
+		rec.free = rec.free[:n-1]
+		node.value = value
+		return unsafe.Pointer(node)
+	}
+	return unsafe.Pointer(&Node[T]{value: value})
+}
+
+// retire records that node has been unlinked from the queue. It is reused once
+// no hazard pointer refers to it any more.
+func (r *nodeRecycler[T]) retire(rec *hazardRecord[T], node unsafe.Pointer) {
+	rec.retired = append(rec.retired, node)
+	if len(rec.retired) >= retireThreshold {
+		r.scan(rec)
+	}
+}
+
+// scan moves every retired node of rec that is not protected by any hazard
+// pointer to the free list of rec.
+func (r *nodeRecycler[T]) scan(rec *hazardRecord[T]) {
+	if atomic.LoadInt64(&r.walkers) > 0 {
+		// A traversal may be standing on any retired node; try again later.
+		return
+	}
+
+	protected := rec.scratch[:0]
+	for other := (*hazardRecord[T])(atomic.LoadPointer(&r.records)); other != nil; other = other.next {
+		for i := range other.hazards {
+			if hp := atomic.LoadPointer(&other.hazards[i]); hp != nil {
+				protected = append(protected, hp)
+			}
+		}
+	}
+	rec.scratch = protected
+
+	var zeroValue T
+	remaining := rec.retired[:0]
+	for _, node := range rec.retired {
+		if containsPointer(protected, node) {
+			remaining = append(remaining, node)
+			continue
+		}
+		if len(rec.free) < maxFreeNodes {
+			n := (*Node[T])(node)
+			n.value = zeroValue // drop the reference for the GC
+			atomic.StorePointer(&n.next, nil)
+			rec.free = append(rec.free, n)
+		}
+	}
+	for i := len(remaining); i < len(rec.retired); i++ {
+		rec.retired[i] = nil
+	}
+	rec.retired = remaining
+}
+
+// containsPointer reports whether ptrs contains p. The list of hazard
+// pointers is short, so a linear search beats building a set.
+func containsPointer(ptrs []unsafe.Pointer, p unsafe.Pointer) bool {
+	for _, ptr := range ptrs {
+		if ptr == p {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueRecycled is Enqueue for queues with node recycling enabled. It is the
+// Michael-Scott enqueue with the tail protected by a hazard pointer.
+func (q *LockFreeQueue[T]) enqueueRecycled(value T) {
+	rec := q.recycler.acquire()
+	defer q.recycler.release(rec)
+
+	newNode := rec.newNode(value)
+
+	for {
+		tail := atomic.LoadPointer(&q.tail)
+		rec.protect(0, tail)
+		// Re-validate so the protected tail cannot have been retired already.
+		if tail != atomic.LoadPointer(&q.tail) {
+			continue
+		}
+
+		next := atomic.LoadPointer(&((*Node[T])(tail).next))
+		if tail != atomic.LoadPointer(&q.tail) {
+			continue
+		}
+
+		if next == nil {
+			(*Node[T])(newNode).index = (*Node[T])(tail).index + 1
+			if atomic.CompareAndSwapPointer(&((*Node[T])(tail).next), nil, newNode) {
+				atomic.CompareAndSwapPointer(&q.tail, tail, newNode)
+				q.stats.enqueued(1)
+				return
+			}
+			q.stats.enqueueCASFailed()
+		} else {
+			// Tail is lagging, move it forward.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			q.stats.helpedTail()
+		}
+	}
+}
+
+// enqueueBatchRecycled is EnqueueBatch for queues with node recycling
+// enabled. The chain is built from recycled nodes and linked after a tail
+// protected by a hazard pointer, as in enqueueRecycled.
+func (q *LockFreeQueue[T]) enqueueBatchRecycled(values []T) {
+	rec := q.recycler.acquire()
+	defer q.recycler.release(rec)
+
+	// Pre-build the chain of nodes outside of the CAS loop. Nobody else can
+	// reach these nodes until the chain is linked in.
+	first := rec.newNode(values[0])
+	last := first
+	for _, value := range values[1:] {
+		node := rec.newNode(value)
+		atomic.StorePointer(&((*Node[T])(last).next), node)
+		last = node
+	}
+
+	for {
+		tail := atomic.LoadPointer(&q.tail)
+		rec.protect(0, tail)
+		// Re-validate so the protected tail cannot have been retired already.
+		if tail != atomic.LoadPointer(&q.tail) {
+			continue
+		}
+
+		next := atomic.LoadPointer(&((*Node[T])(tail).next))
+		if tail != atomic.LoadPointer(&q.tail) {
+			continue
+		}
+
+		if next == nil {
+			// Number the chain after the current last node.
+			index := (*Node[T])(tail).index
+			for node := first; node != nil; node = atomic.LoadPointer(&((*Node[T])(node).next)) {
+				index++
+				(*Node[T])(node).index = index
+			}
+
+			if atomic.CompareAndSwapPointer(&((*Node[T])(tail).next), nil, first) {
+				atomic.CompareAndSwapPointer(&q.tail, tail, last)
+				q.stats.enqueued(int64(len(values)))
+				return
+			}
+			q.stats.enqueueCASFailed()
+		} else {
+			// Tail is lagging, move it forward.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			q.stats.helpedTail()
+		}
+	}
+}
+
+// dequeueRecycled is Dequeue for queues with node recycling enabled. The head
+// and its successor are protected by hazard pointers, and the old sentinel is
+// retired instead of being dropped.
+func (q *LockFreeQueue[T]) dequeueRecycled() (T, bool) {
+	var zeroValue T
+
+	rec := q.recycler.acquire()
+	defer q.recycler.release(rec)
+
+	for {
+		head := atomic.LoadPointer(&q.head)
+		rec.protect(0, head)
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+
+		tail := atomic.LoadPointer(&q.tail)
+		next := atomic.LoadPointer(&((*Node[T])(head).next))
+		rec.protect(1, next)
+		// head still being the head guarantees next is its live successor.
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+
+		if next == nil {
+			// Queue is empty.
+			return zeroValue, false
+		}
+		if head == tail {
+			// Tail is lagging, move it forward.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			q.stats.helpedTail()
+			continue
+		}
+
+		value := (*Node[T])(next).value
+		if atomic.CompareAndSwapPointer(&q.head, head, next) {
+			q.stats.dequeued(1)
+			q.recycler.retire(rec, head)
+			return value, true
+		}
+		q.stats.dequeueCASFailed()
+	}
+}
+
+// peekRecycled is Peek for queues with node recycling enabled.
+func (q *LockFreeQueue[T]) peekRecycled() (T, bool) {
+	var zeroValue T
+
+	rec := q.recycler.acquire()
+	defer q.recycler.release(rec)
+
+	for {
+		head := atomic.LoadPointer(&q.head)
+		rec.protect(0, head)
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+
+		next := atomic.LoadPointer(&((*Node[T])(head).next))
+		rec.protect(1, next)
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+
+		if next == nil {
+			return zeroValue, false
+		}
+		return (*Node[T])(next).value, true
+	}
+}
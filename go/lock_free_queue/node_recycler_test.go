@@ -0,0 +1,179 @@
+package lockfreequeue
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNodeRecycling_ReusesNodes(t *testing.T) {
+	queue := NewLockFreeQueue[int](WithNodeRecycling())
+
+	// Warm up so that retired nodes have been scanned onto a free list.
+	for i := 0; i < 4*retireThreshold; i++ {
+		queue.Enqueue(i)
+		queue.Dequeue()
+	}
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		queue.Enqueue(1)
+		queue.Dequeue()
+	})
+	if allocs >= 1 {
+		t.Errorf("Expected recycled enqueue/dequeue to avoid allocating, got %.2f allocs/op", allocs)
+	}
+
+	plain := NewLockFreeQueue[int]()
+	plainAllocs := testing.AllocsPerRun(1000, func() {
+		plain.Enqueue(1)
+		plain.Dequeue()
+	})
+	if plainAllocs < 1 {
+		t.Errorf("Expected plain enqueue/dequeue to allocate a node, got %.2f allocs/op", plainAllocs)
+	}
+}
+
+func TestNodeRecycling_ProtectedNodesAreNotReused(t *testing.T) {
+	r := &nodeRecycler[int]{}
+	owner := r.acquire()
+	reader := r.acquire()
+
+	// reader holds a hazard pointer to the node owner is about to retire.
+	protectedNode := owner.newNode(1)
+	reader.protect(0, protectedNode)
+
+	for i := 0; i < retireThreshold-1; i++ {
+		r.retire(owner, owner.newNode(i))
+	}
+	r.retire(owner, protectedNode)
+
+	if len(owner.retired) != 1 || owner.retired[0] != protectedNode {
+		t.Fatalf("Protected node should stay retired, retired list has %d nodes", len(owner.retired))
+	}
+	for _, node := range owner.free {
+		if node == (*Node[int])(protectedNode) {
+			t.Fatal("Protected node must not be on the free list")
+		}
+	}
+	if len(owner.free) != retireThreshold-1 {
+		t.Errorf("Expected %d free nodes, got %d", retireThreshold-1, len(owner.free))
+	}
+
+	// Once the hazard is cleared the node is reclaimed on the next scan.
+	r.release(reader)
+	r.scan(owner)
+	if len(owner.retired) != 0 {
+		t.Errorf("Expected no retired nodes after the hazard is cleared, got %d", len(owner.retired))
+	}
+	r.release(owner)
+}
+
+func TestNodeRecycling_ConcurrentNoLossOrDuplication(t *testing.T) {
+	queue := NewLockFreeQueue[int](WithNodeRecycling())
+	const itemCount = 5000
+	const workerCount = 4
+
+	var wg sync.WaitGroup
+	var consumed sync.Map
+	results := make(chan int, workerCount*itemCount)
+
+	// Producers and consumers run at the same time so that nodes are
+	// recycled while other operations still hold references to them.
+	for w := 0; w < workerCount; w++ {
+		wg.Add(2)
+		go func(workerID int) {
+			defer wg.Done()
+			for i := 0; i < itemCount; i++ {
+				queue.Enqueue(workerID*itemCount + i)
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for received := 0; received < itemCount; {
+				if val, ok := queue.Dequeue(); ok {
+					results <- val
+					received++
+				}
+				queue.Peek()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	for val := range results {
+		if _, dup := consumed.LoadOrStore(val, true); dup {
+			t.Errorf("Item %d was dequeued twice", val)
+		}
+	}
+	for val := 0; val < workerCount*itemCount; val++ {
+		if _, exists := consumed.Load(val); !exists {
+			t.Errorf("Item %d was not consumed", val)
+		}
+	}
+	if !queue.IsEmpty() {
+		t.Error("Queue should be empty after all dequeues")
+	}
+}
+
+func TestNodeRecycling_ConcurrentEnqueueBatch(t *testing.T) {
+	queue := NewLockFreeQueue[int](WithNodeRecycling())
+	const batchCount = 500
+	const batchSize = 8
+	const workerCount = 4
+	const perWorker = batchCount * batchSize
+
+	var wg sync.WaitGroup
+	results := make(chan int, workerCount*perWorker)
+
+	// Batches link recycled nodes after tails that consumers retire and
+	// recycle concurrently. Every producer also drains the queue now and
+	// then, and stops early so detachAll re-enqueues through EnqueueBatch.
+	for w := 0; w < workerCount; w++ {
+		wg.Add(2)
+		go func(workerID int) {
+			defer wg.Done()
+			batch := make([]int, batchSize)
+			for b := 0; b < batchCount; b++ {
+				for i := range batch {
+					batch[i] = workerID*perWorker + b*batchSize + i
+				}
+				queue.EnqueueBatch(batch)
+				if b%50 == 0 {
+					for val := range queue.Drain() {
+						results <- val
+						break
+					}
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker/2; {
+				if val, ok := queue.Dequeue(); ok {
+					results <- val
+					i++
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	for val, ok := queue.Dequeue(); ok; val, ok = queue.Dequeue() {
+		results <- val
+	}
+	close(results)
+
+	seen := make(map[int]bool, workerCount*perWorker)
+	for val := range results {
+		if seen[val] {
+			t.Errorf("Item %d was dequeued twice", val)
+		}
+		seen[val] = true
+	}
+	for val := 0; val < workerCount*perWorker; val++ {
+		if !seen[val] {
+			t.Errorf("Item %d was lost", val)
+		}
+	}
+}
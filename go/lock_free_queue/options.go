@@ -0,0 +1,32 @@
+package lockfreequeue
+
+// Option configures optional behaviour of a LockFreeQueue.
+type Option func(*queueOptions)
+
+// queueOptions collects the settings applied by Option values.
+type queueOptions struct {
+	recycleNodes bool
+	collectStats bool
+}
+
+// WithNodeRecycling makes the queue reuse dequeued nodes for later enqueues
+// instead of leaving them to the garbage collector. Nodes are only reused once
+// no in-flight operation can still reference them (see nodeRecycler), which
+// protects the queue from the ABA problem.
+//
+// Recycling trades a little per-operation bookkeeping for far fewer
+// allocations, which pays off when the queue sits in a hot path.
+func WithNodeRecycling() Option {
+	return func(o *queueOptions) {
+		o.recycleNodes = true
+	}
+}
+
+// WithStats makes the queue count enqueues, dequeues, CAS failures, tail
+// helping and its peak size, for reading through Stats. Without it the
+// counters are not allocated and the queue only pays for a nil check.
+func WithStats() Option {
+	return func(o *queueOptions) {
+		o.collectStats = true
+	}
+}
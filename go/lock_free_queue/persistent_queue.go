@@ -0,0 +1,642 @@
+package lockfreequeue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by operations on a PersistentQueue after Close.
+	ErrClosed = errors.New("lockfreequeue: queue is closed")
+
+	// ErrCorruptLog is returned by OpenPersistentQueue when a segment other
+	// than the last one holds an invalid record. A torn record at the end of
+	// the last segment is expected after a crash and is truncated instead.
+	ErrCorruptLog = errors.New("lockfreequeue: corrupt log segment")
+)
+
+// SyncPolicy controls when a PersistentQueue calls fsync on its log files.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs after every Enqueue and Ack, so nothing acknowledged
+	// to the caller is lost on a crash. It is the default.
+	SyncAlways SyncPolicy = iota
+
+	// SyncInterval syncs written files in the background every sync
+	// interval, losing at most that much work on a machine crash.
+	SyncInterval
+
+	// SyncNever leaves flushing to the operating system, and only syncs on
+	// Close. Writes survive a process crash but not a machine crash.
+	SyncNever
+)
+
+const (
+	defaultSegmentSize  = 64 << 20
+	defaultSyncInterval = 100 * time.Millisecond
+
+	// recordHeaderSize is the length and CRC-32 that precede every record.
+	// The CRC covers the length as well as the payload, so a zero-filled
+	// tail, which a crash can leave behind after a file was extended, does
+	// not read as empty records.
+	recordHeaderSize = 8
+
+	// ackRecordSize is the size of a sequence number in an ack file.
+	ackRecordSize = 8
+
+	segmentDataExt = ".log"
+	segmentAckExt  = ".ack"
+)
+
+// PersistentOption configures a PersistentQueue.
+type PersistentOption func(*persistentOptions)
+
+// persistentOptions collects the settings applied by PersistentOption values.
+type persistentOptions struct {
+	segmentSize  int64
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+}
+
+// WithSegmentSize sets the size in bytes after which the log rolls over to a
+// new segment file. Segments are deleted once every record in them has been
+// acknowledged, so smaller segments give disk space back sooner.
+func WithSegmentSize(size int64) PersistentOption {
+	return func(o *persistentOptions) {
+		o.segmentSize = size
+	}
+}
+
+// WithSyncPolicy sets when the log is synced to disk.
+func WithSyncPolicy(policy SyncPolicy) PersistentOption {
+	return func(o *persistentOptions) {
+		o.syncPolicy = policy
+	}
+}
+
+// WithSyncInterval sets how often the log is synced under SyncInterval.
+func WithSyncInterval(interval time.Duration) PersistentOption {
+	return func(o *persistentOptions) {
+		o.syncInterval = interval
+	}
+}
+
+// segment is one file of the log, holding the records with sequence numbers
+// base, base+1, ... and a companion file of acknowledged sequence numbers.
+type segment struct {
+	base      uint64
+	count     uint64   // records in the segment
+	acked     uint64   // records acknowledged so far
+	size      int64    // bytes in the data file
+	data      *os.File // open for appending while the segment is active
+	acks      *os.File
+	dataDirty bool // written since the last sync
+	acksDirty bool
+}
+
+// persistentItem is an element of the hot buffer.
+type persistentItem[T any] struct {
+	seg   *segment
+	seq   uint64
+	value T
+}
+
+// PersistentQueue is a FIFO queue whose elements survive process restarts.
+// Every element is appended to a segmented log on disk before it becomes
+// visible, and stays in the log until it is acknowledged. Reads are served
+// from a LockFreeQueue holding every unconsumed element, so Dequeue never
+// touches the disk; the log is for durability and the queue must fit in
+// memory.
+//
+// Delivery is at-least-once: Dequeue returns an AckHandle, and an element
+// that is not acknowledged before a crash or Close is delivered again when
+// the queue is reopened.
+//
+// Enqueue and Ack serialize on a mutex around the log writes; Dequeue, Peek,
+// Size and IsEmpty are lock-free.
+type PersistentQueue[T any] struct {
+	dir     string
+	codec   Codec[T]
+	options persistentOptions
+	hot     *LockFreeQueue[persistentItem[T]]
+
+	mu       sync.Mutex // guards the fields below and all file writes
+	segments []*segment // live segments, oldest first; the last one is active
+	nextSeq  uint64
+	closed   bool
+	err      error // sticky error from a failed sync
+
+	stop chan struct{} // closed by Close to stop the background syncer
+	done chan struct{} // closed when the background syncer has exited
+}
+
+// AckHandle acknowledges one element returned by PersistentQueue.Dequeue.
+type AckHandle[T any] struct {
+	q    *PersistentQueue[T]
+	item persistentItem[T]
+	done int32 // atomic, set by the first Ack or Nack
+}
+
+// Ack records that the element has been processed, so it is not delivered
+// again after a restart. Only the first Ack or Nack of a handle has an effect.
+func (h *AckHandle[T]) Ack() error {
+	if !atomic.CompareAndSwapInt32(&h.done, 0, 1) {
+		return nil
+	}
+	return h.q.ack(h.item)
+}
+
+// Nack gives the element back to the queue, where it is delivered again after
+// the elements currently queued. Only the first Ack or Nack of a handle has an
+// effect.
+func (h *AckHandle[T]) Nack() {
+	if atomic.CompareAndSwapInt32(&h.done, 0, 1) {
+		h.q.hot.Enqueue(h.item)
+	}
+}
+
+// OpenPersistentQueue opens the queue stored in dir, creating the directory
+// if needed, and recovers every element that was enqueued but not
+// acknowledged. Elements are encoded with codec, which must be the same
+// codec the queue was written with.
+func OpenPersistentQueue[T any](dir string, codec Codec[T], opts ...PersistentOption) (*PersistentQueue[T], error) {
+	options := persistentOptions{
+		segmentSize:  defaultSegmentSize,
+		syncPolicy:   SyncAlways,
+		syncInterval: defaultSyncInterval,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	q := &PersistentQueue[T]{
+		dir:     dir,
+		codec:   codec,
+		options: options,
+		hot:     NewLockFreeQueue[persistentItem[T]](),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := q.recover(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+
+	if options.syncPolicy == SyncInterval {
+		go q.syncLoop()
+	} else {
+		close(q.done)
+	}
+	return q, nil
+}
+
+// recover loads every segment in the directory, oldest first.
+func (q *PersistentQueue[T]) recover() error {
+	bases, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+
+	for i, base := range bases {
+		if err := q.recoverSegment(base, i == len(bases)-1); err != nil {
+			return err
+		}
+	}
+
+	if len(q.segments) == 0 {
+		return q.newSegment(0)
+	}
+	return nil
+}
+
+// recoverSegment reads one segment, queues its unacknowledged records and
+// keeps the segment if anything in it is still unacknowledged or it is the
+// last one, which becomes the active segment again.
+func (q *PersistentQueue[T]) recoverSegment(base uint64, last bool) error {
+	dataPath := q.segmentPath(base, segmentDataExt)
+	ackPath := q.segmentPath(base, segmentAckExt)
+
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		return err
+	}
+	records, valid := parseRecords(data)
+	if valid < int64(len(data)) {
+		if !last {
+			return fmt.Errorf("%w: %s at offset %d", ErrCorruptLog, dataPath, valid)
+		}
+		// Torn write from a crash, drop the partial record.
+		if err := os.Truncate(dataPath, valid); err != nil {
+			return err
+		}
+	}
+
+	acked, err := readAcks(ackPath)
+	if err != nil {
+		return err
+	}
+
+	seg := &segment{
+		base:  base,
+		count: uint64(len(records)),
+		size:  valid,
+	}
+	for i, record := range records {
+		seq := base + uint64(i)
+		if acked[seq] {
+			seg.acked++
+			continue
+		}
+		value, err := q.codec.Decode(record)
+		if err != nil {
+			return fmt.Errorf("lockfreequeue: decode record %d of %s: %w", seq, dataPath, err)
+		}
+		q.hot.Enqueue(persistentItem[T]{seg: seg, seq: seq, value: value})
+	}
+	q.nextSeq = base + seg.count
+
+	if !last && seg.acked == seg.count {
+		return removeSegmentFiles(dataPath, ackPath)
+	}
+
+	if seg.acks, err = os.OpenFile(ackPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+		return err
+	}
+	q.segments = append(q.segments, seg)
+	if last {
+		if seg.data, err = os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enqueue appends value to the log and then makes it available to Dequeue.
+// Under SyncAlways the record is on disk when Enqueue returns.
+func (q *PersistentQueue[T]) Enqueue(value T) error {
+	payload, err := q.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("lockfreequeue: encode: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.err != nil {
+		return q.err
+	}
+
+	seg := q.activeSegment()
+	recordSize := int64(recordHeaderSize + len(payload))
+	if seg.size > 0 && seg.size+recordSize > q.options.segmentSize {
+		if err := q.roll(); err != nil {
+			return err
+		}
+		seg = q.activeSegment()
+	}
+
+	if err := writeRecord(seg.data, payload); err != nil {
+		// Cut off whatever part of the record made it to the file, so
+		// later records stay readable.
+		seg.data.Truncate(seg.size)
+		return err
+	}
+	seg.size += recordSize
+	seg.count++
+	seg.dataDirty = true
+	if err := q.syncIfRequired(seg.data, &seg.dataDirty); err != nil {
+		return err
+	}
+
+	// Still under the lock, so the hot buffer keeps the order of the log.
+	seq := q.nextSeq
+	q.nextSeq++
+	q.hot.Enqueue(persistentItem[T]{seg: seg, seq: seq, value: value})
+	return nil
+}
+
+// Dequeue removes and returns the element at the front of the queue together
+// with the handle to acknowledge it. It returns false if the queue is empty.
+func (q *PersistentQueue[T]) Dequeue() (T, *AckHandle[T], bool) {
+	item, ok := q.hot.Dequeue()
+	if !ok {
+		var zeroValue T
+		return zeroValue, nil, false
+	}
+	return item.value, &AckHandle[T]{q: q, item: item}, true
+}
+
+// Peek returns the element at the front of the queue without removing it.
+// It returns the zero value of T and false if the queue is empty.
+func (q *PersistentQueue[T]) Peek() (T, bool) {
+	item, ok := q.hot.Peek()
+	return item.value, ok
+}
+
+// Size returns the number of elements waiting to be dequeued. Elements that
+// were dequeued but not yet acknowledged are not counted.
+func (q *PersistentQueue[T]) Size() int {
+	return q.hot.Size()
+}
+
+// IsEmpty returns true if no element is waiting to be dequeued.
+func (q *PersistentQueue[T]) IsEmpty() bool {
+	return q.hot.IsEmpty()
+}
+
+// ack appends the sequence number of item to its segment's ack file, and
+// deletes the segment once all of its records are acknowledged.
+func (q *PersistentQueue[T]) ack(item persistentItem[T]) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.err != nil {
+		return q.err
+	}
+
+	seg := item.seg
+	var buf [ackRecordSize]byte
+	binary.LittleEndian.PutUint64(buf[:], item.seq)
+	if _, err := seg.acks.Write(buf[:]); err != nil {
+		return err
+	}
+	seg.acked++
+	seg.acksDirty = true
+
+	if seg != q.activeSegment() && seg.acked == seg.count {
+		return q.removeSegment(seg)
+	}
+	return q.syncIfRequired(seg.acks, &seg.acksDirty)
+}
+
+// Close syncs and closes the log files. Elements that were not acknowledged
+// are delivered again when the queue is reopened.
+func (q *PersistentQueue[T]) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	// The syncer takes the lock, so stop it before taking the lock again.
+	if q.options.syncPolicy == SyncInterval {
+		close(q.stop)
+	}
+	<-q.done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	err := q.err
+	for _, seg := range q.segments {
+		if seg.data != nil && seg.dataDirty {
+			err = errors.Join(err, seg.data.Sync())
+		}
+		if seg.acksDirty {
+			err = errors.Join(err, seg.acks.Sync())
+		}
+	}
+	return errors.Join(err, q.closeFiles())
+}
+
+// activeSegment returns the segment new records are appended to.
+func (q *PersistentQueue[T]) activeSegment() *segment {
+	return q.segments[len(q.segments)-1]
+}
+
+// roll seals the active segment and starts a new one.
+func (q *PersistentQueue[T]) roll() error {
+	seg := q.activeSegment()
+	if seg.dataDirty && q.options.syncPolicy != SyncNever {
+		if err := seg.data.Sync(); err != nil {
+			q.err = err
+			return err
+		}
+	}
+	if err := seg.data.Close(); err != nil {
+		return err
+	}
+	seg.data = nil
+	seg.dataDirty = false
+
+	if err := q.newSegment(q.nextSeq); err != nil {
+		return err
+	}
+	if seg.acked == seg.count {
+		return q.removeSegment(seg)
+	}
+	return nil
+}
+
+// newSegment creates the files of a segment starting at base and makes it the
+// active segment.
+func (q *PersistentQueue[T]) newSegment(base uint64) error {
+	data, err := os.OpenFile(q.segmentPath(base, segmentDataExt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	acks, err := os.OpenFile(q.segmentPath(base, segmentAckExt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		data.Close()
+		return err
+	}
+	q.segments = append(q.segments, &segment{base: base, data: data, acks: acks})
+	return nil
+}
+
+// removeSegment closes and deletes a sealed, fully acknowledged segment.
+func (q *PersistentQueue[T]) removeSegment(seg *segment) error {
+	q.segments = slices.DeleteFunc(q.segments, func(s *segment) bool { return s == seg })
+	seg.acks.Close()
+	return removeSegmentFiles(q.segmentPath(seg.base, segmentDataExt), q.segmentPath(seg.base, segmentAckExt))
+}
+
+// syncIfRequired syncs f if the sync policy asks for a sync on every write.
+// A failed sync leaves the queue unusable: after fsync fails the kernel may
+// have dropped the dirty pages, so retrying cannot make the data durable.
+func (q *PersistentQueue[T]) syncIfRequired(f *os.File, dirty *bool) error {
+	if q.options.syncPolicy != SyncAlways {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		q.err = err
+		return err
+	}
+	*dirty = false
+	return nil
+}
+
+// syncLoop syncs dirty files every sync interval until Close.
+func (q *PersistentQueue[T]) syncLoop() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.options.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-q.stop:
+			return
+		}
+
+		q.mu.Lock()
+		for _, seg := range q.segments {
+			if q.err != nil {
+				break
+			}
+			if seg.dataDirty {
+				q.err = seg.data.Sync()
+				seg.dataDirty = false
+			}
+			if q.err == nil && seg.acksDirty {
+				q.err = seg.acks.Sync()
+				seg.acksDirty = false
+			}
+		}
+		q.mu.Unlock()
+	}
+}
+
+// closeFiles closes every open file of the queue.
+func (q *PersistentQueue[T]) closeFiles() error {
+	var err error
+	for _, seg := range q.segments {
+		if seg.data != nil {
+			err = errors.Join(err, seg.data.Close())
+		}
+		if seg.acks != nil {
+			err = errors.Join(err, seg.acks.Close())
+		}
+	}
+	return err
+}
+
+func (q *PersistentQueue[T]) segmentPath(base uint64, ext string) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", base, ext))
+}
+
+// listSegments returns the base sequence numbers of the segments in dir in
+// ascending order.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var bases []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentDataExt)
+		if !ok {
+			continue
+		}
+		base, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	slices.Sort(bases)
+	return bases, nil
+}
+
+// writeRecord appends payload to f, preceded by its length and CRC-32, with a
+// single write.
+func writeRecord(f *os.File, payload []byte) error {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], recordChecksum(buf[0:4], payload))
+	copy(buf[recordHeaderSize:], payload)
+	_, err := f.Write(buf)
+	return err
+}
+
+// recordChecksum returns the CRC-32 of a record's encoded length followed by
+// its payload.
+func recordChecksum(length, payload []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(length), crc32.IEEETable, payload)
+}
+
+// parseRecords splits the contents of a data file into record payloads. It
+// stops at the first incomplete or corrupt record and also returns the
+// length of the valid prefix of data.
+func parseRecords(data []byte) ([][]byte, int64) {
+	var records [][]byte
+	offset := 0
+	for len(data)-offset >= recordHeaderSize {
+		length := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		checksum := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		start := offset + recordHeaderSize
+		if length > len(data)-start {
+			break
+		}
+		payload := data[start : start+length]
+		if recordChecksum(data[offset:offset+4], payload) != checksum {
+			break
+		}
+		records = append(records, payload)
+		offset = start + length
+	}
+	return records, int64(offset)
+}
+
+// readAcks returns the set of sequence numbers in an ack file. A missing file
+// has no acks, and a torn trailing entry from a crash is truncated: losing an
+// ack only means the element is delivered again.
+func readAcks(path string) (map[uint64]bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if torn := len(data) % ackRecordSize; torn != 0 {
+		data = data[:len(data)-torn]
+		if err := os.Truncate(path, int64(len(data))); err != nil {
+			return nil, err
+		}
+	}
+
+	acked := make(map[uint64]bool, len(data)/ackRecordSize)
+	for offset := 0; offset+ackRecordSize <= len(data); offset += ackRecordSize {
+		acked[binary.LittleEndian.Uint64(data[offset:])] = true
+	}
+	return acked, nil
+}
+
+// removeSegmentFiles deletes the data and ack files of a segment. The data
+// file goes first, so a crash in between cannot leave records without the
+// acks that cover them.
+func removeSegmentFiles(dataPath, ackPath string) error {
+	if err := os.Remove(dataPath); err != nil {
+		return err
+	}
+	if err := os.Remove(ackPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
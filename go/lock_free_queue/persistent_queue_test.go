@@ -0,0 +1,350 @@
+package lockfreequeue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func openTestQueue(t *testing.T, dir string, opts ...PersistentOption) *PersistentQueue[int] {
+	t.Helper()
+	queue, err := OpenPersistentQueue[int](dir, GobCodec[int]{}, opts...)
+	if err != nil {
+		t.Fatalf("OpenPersistentQueue failed: %v", err)
+	}
+	return queue
+}
+
+// segmentFiles returns the names of the data files in dir.
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+segmentDataExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestPersistentQueue_Basic(t *testing.T) {
+	queue := openTestQueue(t, t.TempDir())
+	defer queue.Close()
+
+	if !queue.IsEmpty() {
+		t.Error("New queue should be empty")
+	}
+	if _, _, ok := queue.Dequeue(); ok {
+		t.Error("Dequeue on empty queue should return false")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Enqueue(i); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+	if queue.Size() != 3 {
+		t.Errorf("Queue should have size 3, got %d", queue.Size())
+	}
+	if val, ok := queue.Peek(); !ok || val != 0 {
+		t.Errorf("Peek: expected 0, got %d (ok=%v)", val, ok)
+	}
+
+	for i := 0; i < 3; i++ {
+		val, ack, ok := queue.Dequeue()
+		if !ok || val != i {
+			t.Fatalf("Expected %d, got %d (ok=%v)", i, val, ok)
+		}
+		if err := ack.Ack(); err != nil {
+			t.Fatalf("Ack failed: %v", err)
+		}
+	}
+	if !queue.IsEmpty() {
+		t.Error("Queue should be empty")
+	}
+}
+
+func TestPersistentQueue_Recovery(t *testing.T) {
+	dir := t.TempDir()
+	queue := openTestQueue(t, dir)
+
+	for i := 0; i < 10; i++ {
+		queue.Enqueue(i)
+	}
+	// Acknowledge the even elements, take the odd ones without acknowledging
+	// them and leave the rest in the queue.
+	for i := 0; i < 6; i++ {
+		_, ack, _ := queue.Dequeue()
+		if i%2 == 0 {
+			ack.Ack()
+		}
+	}
+	if err := queue.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	queue = openTestQueue(t, dir)
+	defer queue.Close()
+
+	for _, expected := range []int{1, 3, 5, 6, 7, 8, 9} {
+		val, ack, ok := queue.Dequeue()
+		if !ok || val != expected {
+			t.Fatalf("Expected %d, got %d (ok=%v)", expected, val, ok)
+		}
+		ack.Ack()
+	}
+	if !queue.IsEmpty() {
+		t.Error("Every unacknowledged element should have been recovered exactly once")
+	}
+
+	// New elements continue after the recovered ones.
+	queue.Enqueue(10)
+	if val, _, ok := queue.Dequeue(); !ok || val != 10 {
+		t.Errorf("Expected 10, got %d (ok=%v)", val, ok)
+	}
+}
+
+func TestPersistentQueue_Nack(t *testing.T) {
+	queue := openTestQueue(t, t.TempDir())
+	defer queue.Close()
+
+	queue.Enqueue(1)
+	queue.Enqueue(2)
+
+	_, ack, _ := queue.Dequeue()
+	ack.Nack()
+	ack.Nack()
+	if err := ack.Ack(); err != nil {
+		t.Errorf("Ack after Nack should be a no-op, got %v", err)
+	}
+
+	for _, expected := range []int{2, 1} {
+		if val, _, ok := queue.Dequeue(); !ok || val != expected {
+			t.Errorf("Expected %d, got %d (ok=%v)", expected, val, ok)
+		}
+	}
+}
+
+func TestPersistentQueue_Segments(t *testing.T) {
+	dir := t.TempDir()
+	// Each gob-encoded int plus its header is well over 8 bytes, so a tiny
+	// segment size gives every few records their own segment.
+	queue := openTestQueue(t, dir, WithSegmentSize(64))
+
+	for i := 0; i < 20; i++ {
+		queue.Enqueue(i)
+	}
+	if n := len(segmentFiles(t, dir)); n < 3 {
+		t.Fatalf("Expected the log to roll over into several segments, got %d", n)
+	}
+
+	for i := 0; i < 20; i++ {
+		_, ack, _ := queue.Dequeue()
+		ack.Ack()
+	}
+	// Fully acknowledged segments are deleted, the active one stays.
+	if n := len(segmentFiles(t, dir)); n != 1 {
+		t.Errorf("Expected only the active segment to remain, got %d", n)
+	}
+	queue.Close()
+
+	queue = openTestQueue(t, dir, WithSegmentSize(64))
+	defer queue.Close()
+	if !queue.IsEmpty() {
+		t.Errorf("Acknowledged elements should not be recovered, got size %d", queue.Size())
+	}
+}
+
+func TestPersistentQueue_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	queue := openTestQueue(t, dir)
+	queue.Enqueue(1)
+	queue.Enqueue(2)
+	queue.Close()
+
+	// Simulate a crash in the middle of appending a record and an ack.
+	files := segmentFiles(t, dir)
+	appendBytes := func(path string, data []byte) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(data)
+		f.Close()
+	}
+	appendBytes(files[0], []byte{42, 0, 0, 0, 1, 2})
+	appendBytes(strings.TrimSuffix(files[0], segmentDataExt)+segmentAckExt, []byte{1, 2, 3})
+
+	queue = openTestQueue(t, dir)
+	defer queue.Close()
+
+	for _, expected := range []int{1, 2} {
+		val, ack, ok := queue.Dequeue()
+		if !ok || val != expected {
+			t.Fatalf("Expected %d, got %d (ok=%v)", expected, val, ok)
+		}
+		ack.Ack()
+	}
+	if !queue.IsEmpty() {
+		t.Error("The torn record should have been dropped")
+	}
+
+	// Appends after the truncated tail are readable again.
+	queue.Enqueue(3)
+	queue.Close()
+	queue = openTestQueue(t, dir)
+	if val, _, ok := queue.Dequeue(); !ok || val != 3 {
+		t.Errorf("Expected 3, got %d (ok=%v)", val, ok)
+	}
+	queue.Close()
+}
+
+func TestPersistentQueue_ZeroFilledTail(t *testing.T) {
+	dir := t.TempDir()
+	queue := openTestQueue(t, dir)
+	queue.Enqueue(1)
+	queue.Close()
+
+	// Simulate a crash after the file was extended but before the record
+	// reached the disk, which leaves zeros where the record should be.
+	files := segmentFiles(t, dir)
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 4*recordHeaderSize))
+	f.Close()
+
+	queue = openTestQueue(t, dir)
+	if val, ack, ok := queue.Dequeue(); !ok || val != 1 {
+		t.Fatalf("Expected 1, got %d (ok=%v)", val, ok)
+	} else {
+		ack.Ack()
+	}
+	if !queue.IsEmpty() {
+		t.Errorf("The zero-filled tail was read as %d records", queue.Size())
+	}
+
+	// Appends after the truncated tail are readable again.
+	queue.Enqueue(2)
+	queue.Close()
+	queue = openTestQueue(t, dir)
+	defer queue.Close()
+	if val, _, ok := queue.Dequeue(); !ok || val != 2 {
+		t.Errorf("Expected 2, got %d (ok=%v)", val, ok)
+	}
+}
+
+func TestPersistentQueue_CorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	queue := openTestQueue(t, dir, WithSegmentSize(64))
+	for i := 0; i < 20; i++ {
+		queue.Enqueue(i)
+	}
+	queue.Close()
+
+	// Flip a payload byte in the oldest segment.
+	files := segmentFiles(t, dir)
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[recordHeaderSize] ^= 0xff
+	os.WriteFile(files[0], data, 0o644)
+
+	if _, err := OpenPersistentQueue[int](dir, GobCodec[int]{}); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("Expected ErrCorruptLog, got %v", err)
+	}
+}
+
+func TestPersistentQueue_SyncPolicies(t *testing.T) {
+	type event struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		dir := t.TempDir()
+		queue, err := OpenPersistentQueue[event](dir, JSONCodec[event]{}, WithSyncPolicy(policy))
+		if err != nil {
+			t.Fatalf("OpenPersistentQueue failed: %v", err)
+		}
+		queue.Enqueue(event{ID: 1, Name: "created"})
+		queue.Enqueue(event{ID: 2, Name: "updated"})
+		if err := queue.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		if err := queue.Enqueue(event{}); !errors.Is(err, ErrClosed) {
+			t.Errorf("Enqueue after Close: expected ErrClosed, got %v", err)
+		}
+
+		queue, err = OpenPersistentQueue[event](dir, JSONCodec[event]{}, WithSyncPolicy(policy))
+		if err != nil {
+			t.Fatalf("Reopen failed: %v", err)
+		}
+		if val, _, ok := queue.Dequeue(); !ok || val.ID != 1 || val.Name != "created" {
+			t.Errorf("Policy %d: expected first event, got %+v (ok=%v)", policy, val, ok)
+		}
+		queue.Close()
+	}
+}
+
+func TestPersistentQueue_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	queue := openTestQueue(t, dir, WithSegmentSize(1024), WithSyncPolicy(SyncNever))
+	const numGoroutines = 4
+	const itemsPerGoroutine = 250
+
+	var wg sync.WaitGroup
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := 0; i < itemsPerGoroutine; i++ {
+				if err := queue.Enqueue(id*itemsPerGoroutine + i); err != nil {
+					t.Errorf("Enqueue failed: %v", err)
+					return
+				}
+			}
+		}(g)
+	}
+
+	seen := make(map[int]bool)
+	var mu sync.Mutex
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < itemsPerGoroutine; {
+				val, ack, ok := queue.Dequeue()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				mu.Lock()
+				seen[val] = true
+				mu.Unlock()
+				if err := ack.Ack(); err != nil {
+					t.Errorf("Ack failed: %v", err)
+					return
+				}
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+	queue.Close()
+
+	if len(seen) != numGoroutines*itemsPerGoroutine {
+		t.Errorf("Expected %d distinct values, got %d", numGoroutines*itemsPerGoroutine, len(seen))
+	}
+
+	queue = openTestQueue(t, dir)
+	defer queue.Close()
+	if !queue.IsEmpty() {
+		t.Errorf("Everything was acknowledged, got size %d after reopening", queue.Size())
+	}
+}
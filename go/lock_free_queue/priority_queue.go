@@ -0,0 +1,257 @@
+package lockfreequeue
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"sync/atomic"
+	"unsafe"
+)
+
+// pqMaxLevel is the number of levels in the skiplist, enough for a few
+// million elements before searches degrade.
+const pqMaxLevel = 24
+
+// pqRef is an immutable (successor, mark) pair stored in a node's next
+// pointer at one level. Go cannot steal a bit from a pointer to mark it, so a
+// node is logically deleted at a level by swapping in a marked pqRef.
+// Because every update installs a freshly allocated pqRef, a CAS against the
+// pqRef that was read can never succeed against a recycled value (no ABA).
+type pqRef[K, V any] struct {
+	node   *pqNode[K, V]
+	marked bool
+}
+
+// pqNode is an element of the skiplist.
+type pqNode[K, V any] struct {
+	key   K
+	value V
+	seq   uint64           // insertion order, breaks ties between equal keys
+	taken int32            // set by the PopMin that claimed this node
+	next  []unsafe.Pointer // *pqRef[K, V] per level
+}
+
+func (n *pqNode[K, V]) loadNext(level int) *pqRef[K, V] {
+	return (*pqRef[K, V])(atomic.LoadPointer(&n.next[level]))
+}
+
+func (n *pqNode[K, V]) casNext(level int, old *pqRef[K, V], succ *pqNode[K, V], marked bool) bool {
+	return atomic.CompareAndSwapPointer(&n.next[level], unsafe.Pointer(old), unsafe.Pointer(&pqRef[K, V]{node: succ, marked: marked}))
+}
+
+// PriorityQueue is a concurrent priority queue built on a lock-free skiplist
+// (Herlihy and Shavit's lock-free skiplist with Lotan and Shavit's PopMin).
+// Elements are ordered by key using the comparator given to
+// NewPriorityQueue; elements with equal keys come out in insertion order.
+//
+// PopMin claims the first unclaimed node on the bottom level and then unlinks
+// it. Under concurrency a Push of a smaller key racing with a PopMin may be
+// missed by that PopMin, which then returns the next smallest element; once
+// operations quiesce the queue always yields the true minimum.
+type PriorityQueue[K, V any] struct {
+	head    *pqNode[K, V] // sentinel, smaller than every key
+	compare func(a, b K) int
+	seq     uint64 // atomic counter for insertion order
+	size    int64  // atomic counter for queue size
+}
+
+// NewPriorityQueue creates an empty priority queue ordered by compare, which
+// must return a negative number when a < b, zero when a == b and a positive
+// number when a > b, like cmp.Compare. PopMin returns the smallest key first;
+// reverse the comparator for a max-queue.
+func NewPriorityQueue[K, V any](compare func(a, b K) int) *PriorityQueue[K, V] {
+	head := &pqNode[K, V]{next: make([]unsafe.Pointer, pqMaxLevel)}
+	for level := range head.next {
+		head.next[level] = unsafe.Pointer(&pqRef[K, V]{})
+	}
+	return &PriorityQueue[K, V]{
+		head:    head,
+		compare: compare,
+	}
+}
+
+// before reports whether node n sorts before the position (key, seq).
+func (q *PriorityQueue[K, V]) before(n *pqNode[K, V], key K, seq uint64) bool {
+	if c := q.compare(n.key, key); c != 0 {
+		return c < 0
+	}
+	return n.seq < seq
+}
+
+// find fills preds and succs with the nodes around position (key, seq) on
+// every level, physically unlinking marked nodes it passes on the way.
+func (q *PriorityQueue[K, V]) find(key K, seq uint64, preds, succs *[pqMaxLevel]*pqNode[K, V]) {
+retry:
+	for {
+		pred := q.head
+		for level := pqMaxLevel - 1; level >= 0; level-- {
+			curr := pred.loadNext(level).node
+			for curr != nil {
+				ref := curr.loadNext(level)
+				for ref.marked {
+					// curr is deleted at this level, snip it out of pred.
+					predRef := pred.loadNext(level)
+					if predRef.marked || predRef.node != curr || !pred.casNext(level, predRef, ref.node, false) {
+						continue retry
+					}
+					curr = ref.node
+					if curr == nil {
+						break
+					}
+					ref = curr.loadNext(level)
+				}
+				if curr == nil || !q.before(curr, key, seq) {
+					break
+				}
+				pred = curr
+				curr = ref.node
+			}
+			preds[level] = pred
+			succs[level] = curr
+		}
+		return
+	}
+}
+
+// randomLevel picks the height of a new node: level n with probability 2^-n.
+func randomLevel() int {
+	return 1 + bits.TrailingZeros64(rand.Uint64()|1<<(pqMaxLevel-1))
+}
+
+// Push inserts value with the given key.
+func (q *PriorityQueue[K, V]) Push(key K, value V) {
+	q.push(key, value)
+}
+
+// push inserts value with the given key and returns its node, which delete
+// takes to remove that element wherever it is in the queue.
+func (q *PriorityQueue[K, V]) push(key K, value V) *pqNode[K, V] {
+	topLevel := randomLevel()
+	node := &pqNode[K, V]{
+		key:   key,
+		value: value,
+		seq:   atomic.AddUint64(&q.seq, 1),
+		next:  make([]unsafe.Pointer, topLevel),
+	}
+
+	var preds, succs [pqMaxLevel]*pqNode[K, V]
+	for {
+		q.find(key, node.seq, &preds, &succs)
+		for level := 0; level < topLevel; level++ {
+			atomic.StorePointer(&node.next[level], unsafe.Pointer(&pqRef[K, V]{node: succs[level]}))
+		}
+
+		// Linking the bottom level is what makes the node part of the queue.
+		pred := preds[0]
+		predRef := pred.loadNext(0)
+		if !predRef.marked && predRef.node == succs[0] && pred.casNext(0, predRef, node, false) {
+			break
+		}
+	}
+	atomic.AddInt64(&q.size, 1)
+
+	// Link the upper levels, which only speed up searches.
+	for level := 1; level < topLevel; level++ {
+		for {
+			nodeRef := node.loadNext(level)
+			if nodeRef.marked {
+				// A PopMin already claimed the node and is unlinking it.
+				return node
+			}
+			succ := succs[level]
+			if nodeRef.node != succ && !node.casNext(level, nodeRef, succ, false) {
+				continue
+			}
+
+			pred := preds[level]
+			predRef := pred.loadNext(level)
+			if !predRef.marked && predRef.node == succ && pred.casNext(level, predRef, node, false) {
+				break
+			}
+			q.find(key, node.seq, &preds, &succs)
+		}
+	}
+	return node
+}
+
+// remove logically deletes a claimed node by marking its next pointers from
+// the top level down, then lets find unlink it physically.
+func (q *PriorityQueue[K, V]) remove(node *pqNode[K, V]) {
+	for level := len(node.next) - 1; level >= 0; level-- {
+		for {
+			ref := node.loadNext(level)
+			if ref.marked || node.casNext(level, ref, ref.node, true) {
+				break
+			}
+		}
+	}
+
+	var preds, succs [pqMaxLevel]*pqNode[K, V]
+	q.find(node.key, node.seq, &preds, &succs)
+}
+
+// delete claims node and removes it from the queue. It returns false if a
+// PopMin or another delete claimed the node first.
+func (q *PriorityQueue[K, V]) delete(node *pqNode[K, V]) bool {
+	if atomic.LoadInt32(&node.taken) != 0 || !atomic.CompareAndSwapInt32(&node.taken, 0, 1) {
+		return false
+	}
+	q.remove(node)
+	atomic.AddInt64(&q.size, -1)
+	return true
+}
+
+// PopMin removes and returns the element with the smallest key.
+// It returns zero values and false if the queue is empty.
+func (q *PriorityQueue[K, V]) PopMin() (K, V, bool) {
+	for curr := q.head.loadNext(0).node; curr != nil; {
+		ref := curr.loadNext(0)
+		if !ref.marked && q.delete(curr) {
+			return curr.key, curr.value, true
+		}
+		curr = ref.node
+	}
+
+	var zeroKey K
+	var zeroValue V
+	return zeroKey, zeroValue, false
+}
+
+// PeekMin returns the element with the smallest key without removing it.
+// It returns zero values and false if the queue is empty.
+func (q *PriorityQueue[K, V]) PeekMin() (K, V, bool) {
+	if node := q.peekMinNode(); node != nil {
+		return node.key, node.value, true
+	}
+
+	var zeroKey K
+	var zeroValue V
+	return zeroKey, zeroValue, false
+}
+
+// peekMinNode returns the first unclaimed node, or nil if the queue is empty.
+func (q *PriorityQueue[K, V]) peekMinNode() *pqNode[K, V] {
+	for curr := q.head.loadNext(0).node; curr != nil; {
+		ref := curr.loadNext(0)
+		if !ref.marked && atomic.LoadInt32(&curr.taken) == 0 {
+			return curr
+		}
+		curr = ref.node
+	}
+	return nil
+}
+
+// Size returns the number of elements in the queue.
+func (q *PriorityQueue[K, V]) Size() int {
+	size := atomic.LoadInt64(&q.size)
+	if size < 0 {
+		// A PopMin may briefly run ahead of the Push that counts the node.
+		return 0
+	}
+	return int(size)
+}
+
+// IsEmpty returns true if the queue is empty.
+func (q *PriorityQueue[K, V]) IsEmpty() bool {
+	_, _, ok := q.PeekMin()
+	return !ok
+}
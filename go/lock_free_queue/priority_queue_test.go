@@ -0,0 +1,196 @@
+package lockfreequeue
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestPriorityQueue_Basic(t *testing.T) {
+	queue := NewPriorityQueue[int, string](cmp.Compare[int])
+
+	if !queue.IsEmpty() {
+		t.Error("New queue should be empty")
+	}
+	if _, _, ok := queue.PopMin(); ok {
+		t.Error("PopMin on empty queue should return false")
+	}
+	if _, _, ok := queue.PeekMin(); ok {
+		t.Error("PeekMin on empty queue should return false")
+	}
+
+	queue.Push(3, "three")
+	queue.Push(1, "one")
+	queue.Push(2, "two")
+
+	if queue.Size() != 3 {
+		t.Errorf("Queue should have size 3, got %d", queue.Size())
+	}
+	if key, val, ok := queue.PeekMin(); !ok || key != 1 || val != "one" {
+		t.Errorf("Expected (1, one), got (%d, %s) (ok=%v)", key, val, ok)
+	}
+	if queue.Size() != 3 {
+		t.Errorf("PeekMin should not change size, got %d", queue.Size())
+	}
+
+	for i, expected := range []string{"one", "two", "three"} {
+		key, val, ok := queue.PopMin()
+		if !ok || key != i+1 || val != expected {
+			t.Errorf("Expected (%d, %s), got (%d, %s) (ok=%v)", i+1, expected, key, val, ok)
+		}
+	}
+
+	if !queue.IsEmpty() || queue.Size() != 0 {
+		t.Errorf("Queue should be empty after popping everything, size %d", queue.Size())
+	}
+}
+
+func TestPriorityQueue_Ordering(t *testing.T) {
+	queue := NewPriorityQueue[int, int](cmp.Compare[int])
+
+	keys := rand.Perm(10000)
+	for _, key := range keys {
+		queue.Push(key, key*2)
+	}
+
+	for i := 0; i < len(keys); i++ {
+		key, val, ok := queue.PopMin()
+		if !ok || key != i || val != i*2 {
+			t.Fatalf("Expected (%d, %d), got (%d, %d) (ok=%v)", i, i*2, key, val, ok)
+		}
+	}
+}
+
+func TestPriorityQueue_EqualKeysFIFO(t *testing.T) {
+	queue := NewPriorityQueue[int, int](cmp.Compare[int])
+
+	// Interleave two priorities; each must come out in insertion order.
+	for i := 0; i < 100; i++ {
+		queue.Push(i%2, i)
+	}
+
+	for _, key := range []int{0, 1} {
+		for i := key; i < 100; i += 2 {
+			k, val, ok := queue.PopMin()
+			if !ok || k != key || val != i {
+				t.Fatalf("Expected (%d, %d), got (%d, %d) (ok=%v)", key, i, k, val, ok)
+			}
+		}
+	}
+}
+
+func TestPriorityQueue_CustomComparator(t *testing.T) {
+	// Reversing the comparator turns it into a max-queue.
+	queue := NewPriorityQueue[string, int](func(a, b string) int {
+		return cmp.Compare(b, a)
+	})
+
+	for i, key := range []string{"banana", "cherry", "apple"} {
+		queue.Push(key, i)
+	}
+
+	for _, expected := range []string{"cherry", "banana", "apple"} {
+		if key, _, ok := queue.PopMin(); !ok || key != expected {
+			t.Errorf("Expected %s, got %s (ok=%v)", expected, key, ok)
+		}
+	}
+}
+
+func TestPriorityQueue_ConcurrentPushPop(t *testing.T) {
+	queue := NewPriorityQueue[int, int](cmp.Compare[int])
+	const numGoroutines = 8
+	const itemsPerGoroutine = 2000
+
+	var wg sync.WaitGroup
+	results := make(chan int, numGoroutines*itemsPerGoroutine)
+
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(2)
+		go func(id int) {
+			defer wg.Done()
+			for i := 0; i < itemsPerGoroutine; i++ {
+				value := id*itemsPerGoroutine + i
+				queue.Push(rand.IntN(100), value)
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < itemsPerGoroutine; i++ {
+				for {
+					if _, val, ok := queue.PopMin(); ok {
+						results <- val
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	// Every value must come out exactly once.
+	seen := make([]bool, numGoroutines*itemsPerGoroutine)
+	count := 0
+	for val := range results {
+		if seen[val] {
+			t.Fatalf("Value %d popped twice", val)
+		}
+		seen[val] = true
+		count++
+	}
+	if count != numGoroutines*itemsPerGoroutine {
+		t.Errorf("Expected %d values, got %d", numGoroutines*itemsPerGoroutine, count)
+	}
+	if !queue.IsEmpty() || queue.Size() != 0 {
+		t.Errorf("Queue should be empty, size %d", queue.Size())
+	}
+}
+
+func TestPriorityQueue_ConcurrentPopOrder(t *testing.T) {
+	queue := NewPriorityQueue[int, int](cmp.Compare[int])
+	const numItems = 10000
+	const numGoroutines = 8
+
+	for _, key := range rand.Perm(numItems) {
+		queue.Push(key, key)
+	}
+
+	// Without concurrent pushes every popper sees non-decreasing keys, and
+	// together they pop every key exactly once.
+	var wg sync.WaitGroup
+	popped := make([][]int, numGoroutines)
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for {
+				key, _, ok := queue.PopMin()
+				if !ok {
+					return
+				}
+				popped[id] = append(popped[id], key)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	var all []int
+	for id, keys := range popped {
+		if !slices.IsSorted(keys) {
+			t.Errorf("Goroutine %d popped keys out of order", id)
+		}
+		all = append(all, keys...)
+	}
+	slices.Sort(all)
+	if len(all) != numItems {
+		t.Fatalf("Expected %d keys, got %d", numItems, len(all))
+	}
+	for i, key := range all {
+		if key != i {
+			t.Fatalf("Expected key %d, got %d", i, key)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package lockfreequeue
+
+// Queue is the method set shared by the FIFO queue implementations in this
+// package, so callers can swap one implementation for another.
+type Queue[T any] interface {
+	// Enqueue inserts an element at the end of the queue.
+	Enqueue(value T)
+	// Dequeue removes and returns the element at the front of the queue.
+	// It returns the zero value of T and false if the queue is empty.
+	Dequeue() (T, bool)
+	// Peek returns the value at the front of the queue without removing it.
+	// It returns the zero value of T and false if the queue is empty.
+	Peek() (T, bool)
+	// Size returns the current size of the queue.
+	Size() int
+	// IsEmpty returns true if the queue is empty.
+	IsEmpty() bool
+}
+
+var (
+	_ Queue[int] = (*LockFreeQueue[int])(nil)
+	_ Queue[int] = (*RingQueue[int])(nil)
+	_ Queue[int] = (*SPSCQueue[int])(nil)
+	_ Queue[int] = (*MPSCQueue[int])(nil)
+)
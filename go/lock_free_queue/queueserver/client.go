@@ -0,0 +1,147 @@
+package queueserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrClientClosed is returned by requests on a closed Client.
+var ErrClientClosed = errors.New("queueserver: client closed")
+
+// Client talks to a Server over one TCP connection. It is safe for concurrent
+// use; requests from different goroutines are sent one at a time, so a
+// blocking DequeueWait holds up the other requests on the same Client.
+type Client struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	closed bool
+}
+
+// Dial connects to the server at the TCP address addr.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient wraps an established connection to a server.
+func NewClient(conn net.Conn) *Client {
+	return &Client{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+// Enqueue adds value to the end of the named queue.
+func (c *Client) Enqueue(queue string, value []byte) error {
+	_, err := c.roundTrip(request{op: OpEnqueue, queue: queue, value: value})
+	return err
+}
+
+// Dequeue removes and returns the element at the front of the named queue.
+// It returns false if the queue is empty.
+func (c *Client) Dequeue(queue string) ([]byte, bool, error) {
+	return c.value(request{op: OpDequeue, queue: queue})
+}
+
+// DequeueWait is like Dequeue, but waits up to timeout for an element to
+// arrive if the queue is empty. The timeout has millisecond resolution.
+func (c *Client) DequeueWait(queue string, timeout time.Duration) ([]byte, bool, error) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	return c.value(request{op: OpDequeueWait, queue: queue, timeout: timeout})
+}
+
+// Peek returns the element at the front of the named queue without removing
+// it. It returns false if the queue is empty.
+func (c *Client) Peek(queue string) ([]byte, bool, error) {
+	return c.value(request{op: OpPeek, queue: queue})
+}
+
+// Size returns the number of elements in the named queue.
+func (c *Client) Size(queue string) (int, error) {
+	resp, err := c.roundTrip(request{op: OpSize, queue: queue})
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.body) != 8 {
+		return 0, ErrMalformed
+	}
+	return int(binary.BigEndian.Uint64(resp.body)), nil
+}
+
+// Close closes the connection. Requests in flight fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// value sends a request that answers with an element or StatusEmpty.
+func (c *Client) value(req request) ([]byte, bool, error) {
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.status == StatusEmpty {
+		return nil, false, nil
+	}
+	return resp.body, true, nil
+}
+
+// roundTrip sends req and waits for its response. A StatusError response is
+// returned as an error; any other failure leaves the stream in an unknown
+// state, so the connection is closed.
+func (c *Client) roundTrip(req request) (response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return response{}, ErrClientClosed
+	}
+	if len(req.queue) > MaxNameLength {
+		return response{}, fmt.Errorf("queueserver: queue name longer than %d bytes", MaxNameLength)
+	}
+
+	resp, err := c.exchange(req)
+	if err != nil {
+		c.closed = true
+		c.conn.Close()
+		return response{}, fmt.Errorf("queueserver: %s %q: %w", req.op, req.queue, err)
+	}
+	switch resp.status {
+	case StatusOK, StatusEmpty:
+		return resp, nil
+	case StatusError:
+		return response{}, fmt.Errorf("queueserver: %s %q: server error: %s", req.op, req.queue, resp.body)
+	}
+	return response{}, fmt.Errorf("queueserver: %s %q: unknown status %d", req.op, req.queue, resp.status)
+}
+
+func (c *Client) exchange(req request) (response, error) {
+	if err := writeRequest(c.w, req); err != nil {
+		return response{}, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return response{}, err
+	}
+	frame, err := readFrame(c.r)
+	if err != nil {
+		return response{}, err
+	}
+	return parseResponse(frame)
+}
@@ -0,0 +1,201 @@
+// Package queueserver shares named LockFreeQueue[[]byte] instances between
+// processes over a small length-prefixed TCP protocol.
+//
+// Every message is a frame: a 4-byte big-endian length followed by that many
+// bytes. A request frame starts with an opcode and the queue name, a response
+// frame with a status:
+//
+//	request:  op (1) | name length (2) | name | op-specific body
+//	response: status (1) | status-specific body
+//
+// Op-specific request bodies are the value for OpEnqueue and an 8-byte
+// timeout in milliseconds for OpDequeueWait. A StatusOK response carries the
+// value for the dequeue and peek ops and an 8-byte size for OpSize;
+// StatusError carries a message.
+package queueserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Op is a request opcode.
+type Op byte
+
+const (
+	OpEnqueue Op = iota + 1
+	OpDequeue
+	OpDequeueWait
+	OpPeek
+	OpSize
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpEnqueue:
+		return "Enqueue"
+	case OpDequeue:
+		return "Dequeue"
+	case OpDequeueWait:
+		return "DequeueWait"
+	case OpPeek:
+		return "Peek"
+	case OpSize:
+		return "Size"
+	}
+	return fmt.Sprintf("Op(%d)", byte(op))
+}
+
+// Status is the first byte of a response.
+type Status byte
+
+const (
+	StatusOK Status = iota + 1
+	StatusEmpty
+	StatusError
+)
+
+const (
+	// MaxFrameSize bounds the frames either side accepts, so a corrupt or
+	// hostile length prefix cannot make the reader allocate without limit.
+	MaxFrameSize = 64 << 20
+
+	// MaxNameLength is the longest queue name the protocol can carry.
+	MaxNameLength = 1<<16 - 1
+
+	frameHeaderSize = 4
+)
+
+var (
+	// ErrFrameTooLarge is returned when a frame exceeds MaxFrameSize.
+	ErrFrameTooLarge = errors.New("queueserver: frame too large")
+
+	// ErrMalformed is returned for a frame that cannot be decoded.
+	ErrMalformed = errors.New("queueserver: malformed frame")
+)
+
+// request is a decoded request frame.
+type request struct {
+	op      Op
+	queue   string
+	value   []byte        // OpEnqueue
+	timeout time.Duration // OpDequeueWait
+}
+
+// response is a decoded response frame.
+type response struct {
+	status Status
+	body   []byte
+}
+
+// readFrame reads one length-prefixed frame from r.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+// writeFrame writes the concatenation of parts to w as one frame.
+func writeFrame(w io.Writer, parts ...[]byte) error {
+	length := 0
+	for _, part := range parts {
+		length += len(part)
+	}
+	if length > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(length))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRequest encodes req as a frame.
+func writeRequest(w io.Writer, req request) error {
+	if len(req.queue) > MaxNameLength {
+		return fmt.Errorf("queueserver: queue name longer than %d bytes", MaxNameLength)
+	}
+
+	head := make([]byte, 3, 3+len(req.queue)+8)
+	head[0] = byte(req.op)
+	binary.BigEndian.PutUint16(head[1:3], uint16(len(req.queue)))
+	head = append(head, req.queue...)
+
+	switch req.op {
+	case OpEnqueue:
+		return writeFrame(w, head, req.value)
+	case OpDequeueWait:
+		head = binary.BigEndian.AppendUint64(head, uint64(req.timeout.Milliseconds()))
+	}
+	return writeFrame(w, head)
+}
+
+// parseRequest decodes a request frame.
+func parseRequest(frame []byte) (request, error) {
+	if len(frame) < 3 {
+		return request{}, ErrMalformed
+	}
+	req := request{op: Op(frame[0])}
+	nameLength := int(binary.BigEndian.Uint16(frame[1:3]))
+	body := frame[3:]
+	if len(body) < nameLength {
+		return request{}, ErrMalformed
+	}
+	req.queue = string(body[:nameLength])
+	body = body[nameLength:]
+
+	switch req.op {
+	case OpEnqueue:
+		req.value = body
+	case OpDequeueWait:
+		if len(body) != 8 {
+			return request{}, ErrMalformed
+		}
+		req.timeout = time.Duration(binary.BigEndian.Uint64(body)) * time.Millisecond
+	case OpDequeue, OpPeek, OpSize:
+		if len(body) != 0 {
+			return request{}, ErrMalformed
+		}
+	default:
+		return request{}, fmt.Errorf("%w: unknown op %d", ErrMalformed, frame[0])
+	}
+	return req, nil
+}
+
+// writeResponse encodes resp as a frame.
+func writeResponse(w io.Writer, resp response) error {
+	return writeFrame(w, []byte{byte(resp.status)}, resp.body)
+}
+
+// parseResponse decodes a response frame.
+func parseResponse(frame []byte) (response, error) {
+	if len(frame) < 1 {
+		return response{}, ErrMalformed
+	}
+	return response{status: Status(frame[0]), body: frame[1:]}, nil
+}
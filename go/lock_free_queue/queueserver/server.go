@@ -0,0 +1,342 @@
+package queueserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lockfreequeue"
+)
+
+const (
+	// minPollInterval and maxPollInterval bound the exponential backoff a
+	// blocking dequeue uses while its queue is empty.
+	minPollInterval = 10 * time.Microsecond
+	maxPollInterval = time.Millisecond
+)
+
+// DefaultMaxQueues is the number of queues clients can create on a server
+// that was not given WithMaxQueues.
+const DefaultMaxQueues = 1024
+
+var (
+	// ErrServerClosed is returned by Serve after Close.
+	ErrServerClosed = errors.New("queueserver: server closed")
+
+	// ErrTooManyQueues is reported to a client whose enqueue would create a
+	// queue beyond the server's limit.
+	ErrTooManyQueues = errors.New("queueserver: too many queues")
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithMaxQueues limits the number of queues clients can create to n, so a
+// client cannot exhaust the server's memory by naming new queues. Once the
+// limit is reached, enqueues to new queues fail and requests that only read
+// treat unknown queues as empty.
+func WithMaxQueues(n int) Option {
+	return func(s *Server) {
+		s.maxQueues = int64(n)
+	}
+}
+
+// Server hosts named queues of byte slices. A queue is created the first time
+// an enqueue names it and lives as long as the server.
+//
+// Delivery is at most once: an element the server dequeued for a client whose
+// connection then fails is put back at the tail of its queue, but once the
+// response has been written the server cannot tell whether it arrived.
+type Server struct {
+	queues    sync.Map // string -> *lockfreequeue.LockFreeQueue[[]byte]
+	numQueues int64    // atomic count of entries in queues
+	maxQueues int64
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+
+	done     chan struct{} // closed by Close, wakes blocking dequeues
+	handlers sync.WaitGroup
+}
+
+// NewServer creates a server with no queues.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		maxQueues: DefaultMaxQueues,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Queue returns the queue with the given name, creating it if needed. The
+// process hosting the server can use it directly, next to remote clients.
+// Queues created here count towards the limit but are not refused by it.
+func (s *Server) Queue(name string) *lockfreequeue.LockFreeQueue[[]byte] {
+	if q, ok := s.queues.Load(name); ok {
+		return q.(*lockfreequeue.LockFreeQueue[[]byte])
+	}
+	atomic.AddInt64(&s.numQueues, 1)
+	return s.store(name)
+}
+
+// lookup returns the queue with the given name, or nil if there is none.
+func (s *Server) lookup(name string) *lockfreequeue.LockFreeQueue[[]byte] {
+	if q, ok := s.queues.Load(name); ok {
+		return q.(*lockfreequeue.LockFreeQueue[[]byte])
+	}
+	return nil
+}
+
+// create returns the queue with the given name for a client's enqueue,
+// creating it if the limit allows.
+func (s *Server) create(name string) (*lockfreequeue.LockFreeQueue[[]byte], error) {
+	if q := s.lookup(name); q != nil {
+		return q, nil
+	}
+	if atomic.AddInt64(&s.numQueues, 1) > s.maxQueues {
+		atomic.AddInt64(&s.numQueues, -1)
+		// Another request may have created it meanwhile.
+		if q := s.lookup(name); q != nil {
+			return q, nil
+		}
+		return nil, ErrTooManyQueues
+	}
+	return s.store(name), nil
+}
+
+// store adds a queue under name after the caller counted it, and uncounts it
+// again if another goroutine stored one first.
+func (s *Server) store(name string) *lockfreequeue.LockFreeQueue[[]byte] {
+	q, loaded := s.queues.LoadOrStore(name, lockfreequeue.NewLockFreeQueue[[]byte]())
+	if loaded {
+		atomic.AddInt64(&s.numQueues, -1)
+	}
+	return q.(*lockfreequeue.LockFreeQueue[[]byte])
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves each on its own goroutine. It
+// returns ErrServerClosed after Close, or the error that stopped Accept.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.handlers.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops every listener, closes every connection and waits for the
+// connection handlers to exit. Queued elements are kept in memory, so a
+// server can be closed and its queues inspected afterwards.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	var err error
+	for l := range s.listeners {
+		err = errors.Join(err, l.Close())
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.handlers.Wait()
+	return err
+}
+
+// serveConn handles the requests of one connection in order until the client
+// disconnects or sends a frame that cannot be decoded.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.handlers.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("queueserver: %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		var resp response
+		req, err := parseRequest(frame)
+		if err != nil {
+			resp = response{status: StatusError, body: []byte(err.Error())}
+		} else {
+			resp = s.handle(req)
+		}
+
+		err = writeResponse(w, resp)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			s.requeue(req, resp)
+			return
+		}
+		if req.op == 0 {
+			// The stream may be out of sync after a bad frame.
+			return
+		}
+	}
+}
+
+// handle runs one request against its queue. Only enqueues create queues;
+// the other ops treat a queue that does not exist as empty.
+func (s *Server) handle(req request) response {
+	if req.op == OpEnqueue {
+		q, err := s.create(req.queue)
+		if err != nil {
+			return response{status: StatusError, body: []byte(err.Error())}
+		}
+		// The frame buffer is not reused, so the queue can keep it.
+		q.Enqueue(req.value)
+		return response{status: StatusOK}
+	}
+
+	switch req.op {
+	case OpDequeue:
+		return valueResponse(s.dequeue(req.queue))
+	case OpDequeueWait:
+		return valueResponse(s.dequeueWait(req.queue, req.timeout))
+	case OpPeek:
+		if q := s.lookup(req.queue); q != nil {
+			return valueResponse(q.Peek())
+		}
+		return response{status: StatusEmpty}
+	case OpSize:
+		size := 0
+		if q := s.lookup(req.queue); q != nil {
+			size = q.Size()
+		}
+		return response{status: StatusOK, body: binary.BigEndian.AppendUint64(nil, uint64(size))}
+	}
+	return response{status: StatusError, body: []byte("unknown op")}
+}
+
+// dequeue dequeues from the named queue if it exists.
+func (s *Server) dequeue(name string) ([]byte, bool) {
+	if q := s.lookup(name); q != nil {
+		return q.Dequeue()
+	}
+	return nil, false
+}
+
+// requeue puts back an element that was dequeued for a response that could
+// not be written. It goes to the tail, so it loses its place in the queue.
+func (s *Server) requeue(req request, resp response) {
+	if resp.status != StatusOK || (req.op != OpDequeue && req.op != OpDequeueWait) {
+		return
+	}
+	if q := s.lookup(req.queue); q != nil {
+		q.Enqueue(resp.body)
+	}
+}
+
+// dequeueWait dequeues from the named queue, polling with a backoff while it
+// is empty or does not exist yet, until the timeout passes or the server is
+// closed.
+func (s *Server) dequeueWait(name string, timeout time.Duration) ([]byte, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTimer(0)
+	defer poll.Stop()
+	<-poll.C
+
+	backoff := minPollInterval
+	for {
+		if value, ok := s.dequeue(name); ok {
+			return value, true
+		}
+
+		poll.Reset(backoff)
+		select {
+		case <-poll.C:
+		case <-deadline.C:
+			// One last try so an element that arrived right at the
+			// deadline is not missed.
+			return s.dequeue(name)
+		case <-s.done:
+			return nil, false
+		}
+		backoff *= 2
+		if backoff > maxPollInterval {
+			backoff = maxPollInterval
+		}
+	}
+}
+
+func valueResponse(value []byte, ok bool) response {
+	if !ok {
+		return response{status: StatusEmpty}
+	}
+	return response{status: StatusOK, body: value}
+}
@@ -0,0 +1,323 @@
+package queueserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestServer starts a server on a loopback port and returns it with its
+// address. The server is closed when the test ends.
+func startTestServer(t *testing.T, opts ...Option) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	server := NewServer(opts...)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(l) }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve: expected ErrServerClosed, got %v", err)
+		}
+	})
+	return server, l.Addr().String()
+}
+
+func dialTestServer(t *testing.T, addr string) *Client {
+	t.Helper()
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestServer_Basic(t *testing.T) {
+	_, addr := startTestServer(t)
+	client := dialTestServer(t, addr)
+
+	if _, ok, err := client.Dequeue("jobs"); err != nil || ok {
+		t.Errorf("Dequeue on empty queue: expected false, got ok=%v err=%v", ok, err)
+	}
+	if size, err := client.Size("jobs"); err != nil || size != 0 {
+		t.Errorf("Expected size 0, got %d (err=%v)", size, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := client.Enqueue("jobs", []byte(fmt.Sprintf("job-%d", i))); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+	if size, err := client.Size("jobs"); err != nil || size != 3 {
+		t.Errorf("Expected size 3, got %d (err=%v)", size, err)
+	}
+	if val, ok, err := client.Peek("jobs"); err != nil || !ok || string(val) != "job-0" {
+		t.Errorf("Peek: expected job-0, got %q (ok=%v err=%v)", val, ok, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		val, ok, err := client.Dequeue("jobs")
+		if err != nil || !ok || string(val) != fmt.Sprintf("job-%d", i) {
+			t.Errorf("Expected job-%d, got %q (ok=%v err=%v)", i, val, ok, err)
+		}
+	}
+	if _, ok, err := client.Peek("jobs"); err != nil || ok {
+		t.Errorf("Peek on empty queue: expected false, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestServer_NamedQueues(t *testing.T) {
+	server, addr := startTestServer(t)
+	client := dialTestServer(t, addr)
+
+	client.Enqueue("a", []byte("1"))
+	client.Enqueue("b", []byte("2"))
+	client.Enqueue("", []byte("3"))
+
+	for _, tc := range []struct{ queue, value string }{{"b", "2"}, {"", "3"}, {"a", "1"}} {
+		if val, ok, _ := client.Dequeue(tc.queue); !ok || string(val) != tc.value {
+			t.Errorf("Queue %q: expected %s, got %q (ok=%v)", tc.queue, tc.value, val, ok)
+		}
+	}
+
+	// The hosting process shares the queues with remote clients.
+	server.Queue("local").Enqueue([]byte("from server"))
+	if val, ok, _ := client.Dequeue("local"); !ok || string(val) != "from server" {
+		t.Errorf("Expected the element enqueued in-process, got %q (ok=%v)", val, ok)
+	}
+}
+
+func TestServer_EmptyAndLargeValues(t *testing.T) {
+	_, addr := startTestServer(t)
+	client := dialTestServer(t, addr)
+
+	large := bytes.Repeat([]byte{0xab}, 1<<20)
+	client.Enqueue("q", nil)
+	client.Enqueue("q", large)
+
+	if val, ok, err := client.Dequeue("q"); err != nil || !ok || len(val) != 0 {
+		t.Errorf("Expected an empty value, got %d bytes (ok=%v err=%v)", len(val), ok, err)
+	}
+	if val, ok, err := client.Dequeue("q"); err != nil || !ok || !bytes.Equal(val, large) {
+		t.Errorf("Large value did not round-trip: got %d bytes (ok=%v err=%v)", len(val), ok, err)
+	}
+
+	if err := client.Enqueue(strings.Repeat("x", MaxNameLength+1), nil); err == nil {
+		t.Error("Expected an error for an overlong queue name")
+	}
+	// A rejected name does not break the connection.
+	if _, err := client.Size("q"); err != nil {
+		t.Errorf("Client should still work, got %v", err)
+	}
+}
+
+func TestServer_DequeueWait(t *testing.T) {
+	_, addr := startTestServer(t)
+	consumer := dialTestServer(t, addr)
+	producer := dialTestServer(t, addr)
+
+	start := time.Now()
+	if _, ok, err := consumer.DequeueWait("q", 50*time.Millisecond); err != nil || ok {
+		t.Errorf("Expected a timeout, got ok=%v err=%v", ok, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("DequeueWait returned after %v, before its timeout", elapsed)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		producer.Enqueue("q", []byte("late"))
+	}()
+	val, ok, err := consumer.DequeueWait("q", 5*time.Second)
+	if err != nil || !ok || string(val) != "late" {
+		t.Errorf("Expected the element enqueued while waiting, got %q (ok=%v err=%v)", val, ok, err)
+	}
+}
+
+func TestServer_CloseWakesWaiters(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	go server.Serve(l)
+	client := dialTestServer(t, l.Addr().String())
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.DequeueWait("q", time.Minute)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	server.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not release a blocked DequeueWait")
+	}
+	if _, err := client.Size("q"); err == nil {
+		t.Error("Requests after the server closed should fail")
+	}
+}
+
+func TestServer_MalformedFrame(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Unknown opcode 0x7f with an empty queue name.
+	writeFrame(conn, []byte{0x7f, 0, 0})
+	frame, err := readFrame(conn)
+	if err != nil {
+		t.Fatalf("Expected an error response, got %v", err)
+	}
+	if resp, _ := parseResponse(frame); resp.status != StatusError {
+		t.Errorf("Expected StatusError, got %d", resp.status)
+	}
+	// The server drops the connection after a frame it could not decode.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := readFrame(conn); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+}
+
+func TestServer_MaxQueues(t *testing.T) {
+	server, addr := startTestServer(t, WithMaxQueues(2))
+	client := dialTestServer(t, addr)
+
+	// Reads do not create queues, so they do not count towards the limit.
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("read-%d", i)
+		if _, ok, err := client.Dequeue(name); err != nil || ok {
+			t.Errorf("Dequeue on unknown queue: expected false, got ok=%v err=%v", ok, err)
+		}
+		if _, ok, err := client.DequeueWait(name, time.Millisecond); err != nil || ok {
+			t.Errorf("DequeueWait on unknown queue: expected false, got ok=%v err=%v", ok, err)
+		}
+	}
+
+	for _, name := range []string{"a", "b", "a"} {
+		if err := client.Enqueue(name, []byte("x")); err != nil {
+			t.Errorf("Enqueue to %s failed: %v", name, err)
+		}
+	}
+	err := client.Enqueue("c", []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), ErrTooManyQueues.Error()) {
+		t.Errorf("Expected %v, got %v", ErrTooManyQueues, err)
+	}
+	if size, err := client.Size("c"); err != nil || size != 0 {
+		t.Errorf("Refused queue should not exist, size %d (err=%v)", size, err)
+	}
+	if size, err := client.Size("a"); err != nil || size != 2 {
+		t.Errorf("Expected size 2, got %d (err=%v)", size, err)
+	}
+
+	// The hosting process is trusted and can still add queues.
+	server.Queue("local").Enqueue([]byte("x"))
+	if size, err := client.Size("local"); err != nil || size != 1 {
+		t.Errorf("Expected size 1, got %d (err=%v)", size, err)
+	}
+}
+
+func TestServer_RequeueOnWriteFailure(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.Queue("q").Enqueue([]byte("first"))
+	server.Queue("q").Enqueue([]byte("second"))
+
+	clientConn, serverConn := net.Pipe()
+	server.handlers.Add(1)
+	done := make(chan struct{})
+	go func() {
+		server.serveConn(serverConn)
+		close(done)
+	}()
+
+	// The client hangs up before reading the response, so writing it fails
+	// and the dequeued element goes back to the queue.
+	if err := writeRequest(clientConn, request{op: OpDequeue, queue: "q"}); err != nil {
+		t.Fatalf("writeRequest failed: %v", err)
+	}
+	clientConn.Close()
+	<-done
+
+	q := server.Queue("q")
+	for _, want := range []string{"second", "first"} {
+		if val, ok := q.Dequeue(); !ok || string(val) != want {
+			t.Errorf("Expected %s, got %q (ok=%v)", want, val, ok)
+		}
+	}
+}
+
+func TestServer_Concurrent(t *testing.T) {
+	server, addr := startTestServer(t)
+	const numClients = 4
+	const itemsPerClient = 250
+
+	var wg sync.WaitGroup
+	for c := 0; c < numClients; c++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			client, err := Dial(addr)
+			if err != nil {
+				t.Errorf("Dial failed: %v", err)
+				return
+			}
+			defer client.Close()
+			for i := 0; i < itemsPerClient; i++ {
+				if err := client.Enqueue("q", []byte(fmt.Sprintf("%d-%d", id, i))); err != nil {
+					t.Errorf("Enqueue failed: %v", err)
+					return
+				}
+			}
+		}(c)
+	}
+
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	for c := 0; c < numClients; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := Dial(addr)
+			if err != nil {
+				t.Errorf("Dial failed: %v", err)
+				return
+			}
+			defer client.Close()
+			for i := 0; i < itemsPerClient; i++ {
+				val, ok, err := client.DequeueWait("q", 5*time.Second)
+				if err != nil || !ok {
+					t.Errorf("DequeueWait failed: ok=%v err=%v", ok, err)
+					return
+				}
+				mu.Lock()
+				seen[string(val)] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != numClients*itemsPerClient {
+		t.Errorf("Expected %d distinct values, got %d", numClients*itemsPerClient, len(seen))
+	}
+	if !server.Queue("q").IsEmpty() {
+		t.Error("Queue should be empty")
+	}
+}
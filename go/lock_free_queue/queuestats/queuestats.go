@@ -0,0 +1,82 @@
+// Package queuestats exports the stats of lockfreequeue queues created with
+// WithStats to expvar and in the Prometheus text format. It lives apart from
+// the queue package so that programs which do not export stats do not link
+// net/http, and importing expvar does not register /debug/vars for them.
+package queuestats
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"lockfreequeue"
+)
+
+// PublishExpvar publishes the stats of q under name in the expvar registry,
+// where they are served as JSON on /debug/vars. Like expvar.Publish, it
+// panics if name is already registered.
+func PublishExpvar(name string, q lockfreequeue.StatsProvider) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return q.Stats()
+	}))
+}
+
+// prometheusMetrics lists the exported metrics in output order.
+var prometheusMetrics = []struct {
+	name, kind, help string
+	value            func(lockfreequeue.Stats) float64
+}{
+	{"lockfreequeue_enqueues_total", "counter", "Elements enqueued.",
+		func(s lockfreequeue.Stats) float64 { return float64(s.Enqueues) }},
+	{"lockfreequeue_dequeues_total", "counter", "Elements dequeued.",
+		func(s lockfreequeue.Stats) float64 { return float64(s.Dequeues) }},
+	{"lockfreequeue_enqueue_cas_failures_total", "counter", "Enqueue CAS attempts that had to be retried.",
+		func(s lockfreequeue.Stats) float64 { return float64(s.EnqueueCASFailures) }},
+	{"lockfreequeue_dequeue_cas_failures_total", "counter", "Dequeue CAS attempts that had to be retried.",
+		func(s lockfreequeue.Stats) float64 { return float64(s.DequeueCASFailures) }},
+	{"lockfreequeue_tail_helps_total", "counter", "Times a lagging tail was moved forward by another operation.",
+		func(s lockfreequeue.Stats) float64 { return float64(s.TailHelps) }},
+	{"lockfreequeue_size", "gauge", "Current number of elements.",
+		func(s lockfreequeue.Stats) float64 { return float64(s.Size) }},
+	{"lockfreequeue_peak_size", "gauge", "Largest number of elements seen.",
+		func(s lockfreequeue.Stats) float64 { return float64(s.PeakSize) }},
+}
+
+// WritePrometheus writes the stats of the given queues, keyed by queue name,
+// to w in the Prometheus text exposition format. Each queue becomes a series
+// with a queue label; queues are written in name order.
+func WritePrometheus(w io.Writer, queues map[string]lockfreequeue.StatsProvider) error {
+	names := make([]string, 0, len(queues))
+	stats := make(map[string]lockfreequeue.Stats, len(queues))
+	for name, q := range queues {
+		names = append(names, name)
+		stats[name] = q.Stats()
+	}
+	slices.Sort(names)
+
+	for _, metric := range prometheusMetrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%s{queue=%q} %s\n", metric.name, name, strconv.FormatFloat(metric.value(stats[name]), 'f', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PrometheusHandler returns an http.Handler that serves the stats of the given
+// queues in the Prometheus text format, for mounting on a /metrics endpoint.
+func PrometheusHandler(queues map[string]lockfreequeue.StatsProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := WritePrometheus(w, queues); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
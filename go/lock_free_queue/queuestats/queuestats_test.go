@@ -0,0 +1,64 @@
+package queuestats
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lockfreequeue"
+)
+
+func TestPrometheus(t *testing.T) {
+	orders := lockfreequeue.NewLockFreeQueue[int](lockfreequeue.WithStats())
+	orders.Enqueue(1)
+	orders.Enqueue(2)
+	orders.Dequeue()
+	events := lockfreequeue.NewLockFreeQueue[string](lockfreequeue.WithStats())
+
+	var sb strings.Builder
+	queues := map[string]lockfreequeue.StatsProvider{"orders": orders, "events": events}
+	if err := WritePrometheus(&sb, queues); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	out := sb.String()
+
+	for _, line := range []string{
+		"# TYPE lockfreequeue_enqueues_total counter",
+		`lockfreequeue_enqueues_total{queue="orders"} 2`,
+		`lockfreequeue_dequeues_total{queue="orders"} 1`,
+		`lockfreequeue_enqueues_total{queue="events"} 0`,
+		"# TYPE lockfreequeue_peak_size gauge",
+		`lockfreequeue_peak_size{queue="orders"} 2`,
+		`lockfreequeue_size{queue="orders"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Output is missing %q:\n%s", line, out)
+		}
+	}
+	if strings.Index(out, `{queue="events"}`) > strings.Index(out, `{queue="orders"}`) {
+		t.Error("Queues should be written in name order")
+	}
+
+	// The handler serves the same text.
+	rec := httptest.NewRecorder()
+	PrometheusHandler(queues).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Body.String() != out {
+		t.Errorf("Handler output differs from WritePrometheus:\n%s", rec.Body.String())
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	queue := lockfreequeue.NewLockFreeQueue[int](lockfreequeue.WithStats())
+	queue.Enqueue(1)
+	PublishExpvar("lockfreequeue_test_queue", queue)
+
+	var stats lockfreequeue.Stats
+	if err := json.Unmarshal([]byte(expvar.Get("lockfreequeue_test_queue").String()), &stats); err != nil {
+		t.Fatalf("Published value is not valid JSON: %v", err)
+	}
+	if stats.Enqueues != 1 || stats.Size != 1 {
+		t.Errorf("Expected 1 enqueue and size 1, got %+v", stats)
+	}
+}
@@ -0,0 +1,191 @@
+package lockfreequeue
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// cacheLinePad keeps hot atomic counters on separate cache lines so that
+// producers and consumers do not false-share.
+type cacheLinePad [64]byte
+
+// ringCell is a single slot in the ring buffer.
+type ringCell[T any] struct {
+	sequence uint64 // position this cell is ready for (see RingQueue)
+	peekers  int32  // number of Peek calls currently reading value
+	value    T
+}
+
+// RingQueue is a bounded multi-producer multi-consumer queue backed by a
+// fixed array of cells, using Dmitry Vyukov's sequence number algorithm.
+// Unlike LockFreeQueue it does not allocate on Enqueue, which keeps GC
+// pressure flat in hot paths.
+//
+// Each cell carries a sequence number. A cell at index pos&mask is free for
+// the producer claiming position pos when sequence == pos, and holds a value
+// for the consumer claiming position pos when sequence == pos+1. Producers and
+// consumers claim positions with a CAS on enqueuePos and dequeuePos.
+type RingQueue[T any] struct {
+	_          cacheLinePad
+	enqueuePos uint64 // next position to be claimed by a producer
+	_          cacheLinePad
+	dequeuePos uint64 // next position to be claimed by a consumer
+	_          cacheLinePad
+	mask       uint64
+	cells      []ringCell[T]
+}
+
+// NewRingQueue initializes a ring buffer queue that can hold at least capacity
+// elements. The capacity is rounded up to the next power of two.
+// It panics if capacity is not positive.
+func NewRingQueue[T any](capacity int) *RingQueue[T] {
+	if capacity <= 0 {
+		panic("lockfreequeue: capacity must be positive")
+	}
+
+	size := 1
+	for size < capacity {
+		size <<= 1
+	}
+
+	cells := make([]ringCell[T], size)
+	for i := range cells {
+		cells[i].sequence = uint64(i)
+	}
+
+	return &RingQueue[T]{
+		mask:  uint64(size - 1),
+		cells: cells,
+	}
+}
+
+// TryEnqueue inserts an element at the end of the queue.
+// It returns false without blocking if the queue is full.
+func (q *RingQueue[T]) TryEnqueue(value T) bool {
+	pos := atomic.LoadUint64(&q.enqueuePos)
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := atomic.LoadUint64(&cell.sequence)
+		diff := int64(seq) - int64(pos)
+
+		if diff == 0 {
+			// The cell is free for this position, try to claim it.
+			if atomic.CompareAndSwapUint64(&q.enqueuePos, pos, pos+1) {
+				cell.value = value
+				// Publish the value to the consumer of this position.
+				atomic.StoreUint64(&cell.sequence, pos+1)
+				return true
+			}
+			pos = atomic.LoadUint64(&q.enqueuePos)
+		} else if diff < 0 {
+			// The cell still holds a value from the previous lap: queue is full.
+			return false
+		} else {
+			// Another producer claimed this position, catch up.
+			pos = atomic.LoadUint64(&q.enqueuePos)
+		}
+	}
+}
+
+// Enqueue inserts an element at the end of the queue.
+// If the queue is full it yields the processor until a slot frees up.
+func (q *RingQueue[T]) Enqueue(value T) {
+	for !q.TryEnqueue(value) {
+		runtime.Gosched()
+	}
+}
+
+// Dequeue removes and returns the element at the front of the queue.
+// It returns the zero value of T and false if the queue is empty.
+func (q *RingQueue[T]) Dequeue() (T, bool) {
+	var zeroValue T
+
+	pos := atomic.LoadUint64(&q.dequeuePos)
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := atomic.LoadUint64(&cell.sequence)
+		diff := int64(seq) - int64(pos+1)
+
+		if diff == 0 {
+			// The cell holds the value for this position, try to claim it.
+			if atomic.CompareAndSwapUint64(&q.dequeuePos, pos, pos+1) {
+				value := cell.value
+
+				// Wait for in-flight Peek calls before clearing the slot.
+				for atomic.LoadInt32(&cell.peekers) != 0 {
+					runtime.Gosched()
+				}
+				cell.value = zeroValue // drop the reference for the GC
+
+				// Hand the cell to the producer of the next lap.
+				atomic.StoreUint64(&cell.sequence, pos+q.mask+1)
+				return value, true
+			}
+			pos = atomic.LoadUint64(&q.dequeuePos)
+		} else if diff < 0 {
+			// The cell has not been filled for this position: queue is empty.
+			return zeroValue, false
+		} else {
+			// Another consumer claimed this position, catch up.
+			pos = atomic.LoadUint64(&q.dequeuePos)
+		}
+	}
+}
+
+// Peek returns the value at the front of the queue without removing it.
+// It returns the zero value of T and false if the queue is empty.
+func (q *RingQueue[T]) Peek() (T, bool) {
+	var zeroValue T
+
+	for {
+		pos := atomic.LoadUint64(&q.dequeuePos)
+		cell := &q.cells[pos&q.mask]
+		if atomic.LoadUint64(&cell.sequence) != pos+1 {
+			if pos == atomic.LoadUint64(&q.dequeuePos) {
+				return zeroValue, false
+			}
+			continue
+		}
+
+		// Register as a reader, then make sure no consumer claimed the
+		// position in the meantime. A consumer that claims it afterwards
+		// waits for peekers to drop to zero before touching the value.
+		atomic.AddInt32(&cell.peekers, 1)
+		if pos != atomic.LoadUint64(&q.dequeuePos) {
+			atomic.AddInt32(&cell.peekers, -1)
+			continue
+		}
+		value := cell.value
+		atomic.AddInt32(&cell.peekers, -1)
+		return value, true
+	}
+}
+
+// Size returns the current size of the queue.
+func (q *RingQueue[T]) Size() int {
+	dequeuePos := atomic.LoadUint64(&q.dequeuePos)
+	enqueuePos := atomic.LoadUint64(&q.enqueuePos)
+
+	// Positions are claimed before their cells are filled or emptied and the
+	// two counters are read separately, so clamp to the valid range.
+	size := int64(enqueuePos - dequeuePos)
+	if size < 0 {
+		return 0
+	}
+	if size > int64(q.Cap()) {
+		return q.Cap()
+	}
+	return int(size)
+}
+
+// IsEmpty returns true if the queue is empty.
+func (q *RingQueue[T]) IsEmpty() bool {
+	pos := atomic.LoadUint64(&q.dequeuePos)
+	cell := &q.cells[pos&q.mask]
+	return atomic.LoadUint64(&cell.sequence) != pos+1
+}
+
+// Cap returns the maximum number of elements the queue can hold.
+func (q *RingQueue[T]) Cap() int {
+	return len(q.cells)
+}
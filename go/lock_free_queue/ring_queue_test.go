@@ -0,0 +1,165 @@
+package lockfreequeue
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRingQueue_Capacity(t *testing.T) {
+	tests := []struct {
+		capacity int
+		expected int
+	}{
+		{1, 1},
+		{2, 2},
+		{3, 4},
+		{1000, 1024},
+	}
+
+	for _, tt := range tests {
+		queue := NewRingQueue[int](tt.capacity)
+		if queue.Cap() != tt.expected {
+			t.Errorf("NewRingQueue(%d): expected capacity %d, got %d", tt.capacity, tt.expected, queue.Cap())
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewRingQueue should panic on zero capacity")
+		}
+	}()
+	NewRingQueue[int](0)
+}
+
+func TestRingQueue_Full(t *testing.T) {
+	queue := NewRingQueue[int](4)
+
+	for i := 0; i < 4; i++ {
+		if !queue.TryEnqueue(i) {
+			t.Errorf("TryEnqueue #%d should succeed below capacity", i)
+		}
+	}
+	if queue.TryEnqueue(4) {
+		t.Error("TryEnqueue should fail on full queue")
+	}
+	if queue.Size() != 4 {
+		t.Errorf("Queue should have size 4, got %d", queue.Size())
+	}
+
+	if val, ok := queue.Dequeue(); !ok || val != 0 {
+		t.Errorf("Expected 0, got %d (ok=%v)", val, ok)
+	}
+	if !queue.TryEnqueue(4) {
+		t.Error("TryEnqueue should succeed after a slot is freed")
+	}
+}
+
+func TestRingQueue_WrapAround(t *testing.T) {
+	queue := NewRingQueue[int](4)
+
+	// Cycle through the buffer many times to exercise sequence numbers
+	// across laps.
+	next := 0
+	for lap := 0; lap < 100; lap++ {
+		for i := 0; i < 3; i++ {
+			queue.Enqueue(lap*3 + i)
+		}
+		for i := 0; i < 3; i++ {
+			val, ok := queue.Dequeue()
+			if !ok {
+				t.Fatalf("Dequeue failed on lap %d", lap)
+			}
+			if val != next {
+				t.Fatalf("Expected %d, got %d", next, val)
+			}
+			next++
+		}
+	}
+
+	if !queue.IsEmpty() {
+		t.Error("Queue should be empty after all dequeues")
+	}
+}
+
+func TestRingQueue_DifferentTypes(t *testing.T) {
+	// String queue
+	strQueue := NewRingQueue[string](2)
+	strQueue.Enqueue("hello")
+	strQueue.Enqueue("world")
+
+	val, ok := strQueue.Dequeue()
+	if !ok || val != "hello" {
+		t.Errorf("Expected 'hello', got '%s'", val)
+	}
+
+	// Struct queue
+	type Person struct {
+		Name string
+		Age  int
+	}
+
+	personQueue := NewRingQueue[Person](2)
+	personQueue.Enqueue(Person{Name: "Alice", Age: 30})
+	personQueue.Enqueue(Person{Name: "Bob", Age: 25})
+
+	person, ok := personQueue.Dequeue()
+	if !ok || person.Name != "Alice" || person.Age != 30 {
+		t.Errorf("Expected Person{Name: 'Alice', Age: 30}, got %+v", person)
+	}
+}
+
+func TestRingQueue_ConcurrentPeek(t *testing.T) {
+	// A small buffer forces producers to overwrite cells that peekers may be
+	// reading. Run with -race to catch unsynchronized access.
+	queue := NewRingQueue[int](2)
+	const itemCount = 10000
+
+	var wg sync.WaitGroup
+	var done int32
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < itemCount; i++ {
+			queue.Enqueue(i)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		next := 0
+		for next < itemCount {
+			if val, ok := queue.Dequeue(); ok {
+				if val != next {
+					t.Errorf("Expected %d, got %d", next, val)
+				}
+				next++
+			} else {
+				runtime.Gosched()
+			}
+		}
+		atomic.StoreInt32(&done, 1)
+	}()
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := -1
+			for atomic.LoadInt32(&done) == 0 {
+				if val, ok := queue.Peek(); ok {
+					if val < last || val >= itemCount {
+						t.Errorf("Peek returned %d after %d", val, last)
+					}
+					last = val
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,98 @@
+package lockfreequeue
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// SPSCQueue is an unbounded queue for exactly one producer goroutine and one
+// consumer goroutine. Because each end has a single owner it needs no CAS
+// loops: every operation is a handful of plain atomic loads and stores.
+//
+// Enqueue must only be called by the producer; Dequeue and Peek must only be
+// called by the consumer. Size and IsEmpty are safe from any goroutine.
+type SPSCQueue[T any] struct {
+	_        cacheLinePad
+	head     unsafe.Pointer // sentinel node, owned by the consumer
+	dequeued uint64         // written only by the consumer
+	_        cacheLinePad
+	tail     unsafe.Pointer // last node, owned by the producer
+	enqueued uint64         // written only by the producer
+	_        cacheLinePad
+}
+
+// NewSPSCQueue initializes a new single-producer single-consumer queue with a
+// sentinel node.
+func NewSPSCQueue[T any]() *SPSCQueue[T] {
+	sentinel := unsafe.Pointer(&Node[T]{})
+	return &SPSCQueue[T]{
+		head: sentinel,
+		tail: sentinel,
+	}
+}
+
+// Enqueue inserts an element at the end of the queue.
+// It must only be called from the producer goroutine.
+func (q *SPSCQueue[T]) Enqueue(value T) {
+	newNode := unsafe.Pointer(&Node[T]{value: value})
+
+	tail := atomic.LoadPointer(&q.tail)
+	// Publishing the link is what makes the value visible to the consumer.
+	atomic.StorePointer(&((*Node[T])(tail).next), newNode)
+	atomic.StorePointer(&q.tail, newNode)
+	atomic.StoreUint64(&q.enqueued, atomic.LoadUint64(&q.enqueued)+1)
+}
+
+// Dequeue removes and returns the element at the front of the queue.
+// It returns the zero value of T and false if the queue is empty.
+// It must only be called from the consumer goroutine.
+func (q *SPSCQueue[T]) Dequeue() (T, bool) {
+	var zeroValue T
+
+	head := atomic.LoadPointer(&q.head)
+	next := atomic.LoadPointer(&((*Node[T])(head).next))
+	if next == nil {
+		return zeroValue, false
+	}
+
+	// next becomes the new sentinel; clear its value so the GC can reclaim it.
+	nextNode := (*Node[T])(next)
+	value := nextNode.value
+	nextNode.value = zeroValue
+
+	atomic.StorePointer(&q.head, next)
+	atomic.StoreUint64(&q.dequeued, atomic.LoadUint64(&q.dequeued)+1)
+	return value, true
+}
+
+// Peek returns the value at the front of the queue without removing it.
+// It returns the zero value of T and false if the queue is empty.
+// It must only be called from the consumer goroutine.
+func (q *SPSCQueue[T]) Peek() (T, bool) {
+	var zeroValue T
+
+	head := atomic.LoadPointer(&q.head)
+	next := atomic.LoadPointer(&((*Node[T])(head).next))
+	if next == nil {
+		return zeroValue, false
+	}
+	return (*Node[T])(next).value, true
+}
+
+// Size returns the current size of the queue.
+func (q *SPSCQueue[T]) Size() int {
+	// The producer counts an element only after publishing it, so the
+	// consumer's counter can briefly be ahead. Clamp instead of going negative.
+	dequeued := atomic.LoadUint64(&q.dequeued)
+	enqueued := atomic.LoadUint64(&q.enqueued)
+	if enqueued < dequeued {
+		return 0
+	}
+	return int(enqueued - dequeued)
+}
+
+// IsEmpty returns true if the queue is empty.
+func (q *SPSCQueue[T]) IsEmpty() bool {
+	head := atomic.LoadPointer(&q.head)
+	return atomic.LoadPointer(&((*Node[T])(head).next)) == nil
+}
@@ -0,0 +1,109 @@
+package lockfreequeue
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the counters of a queue created with WithStats.
+// The counters are read one at a time, so under concurrent use they are not
+// mutually consistent. The queuestats package exports them to expvar and
+// Prometheus.
+type Stats struct {
+	// Enqueues and Dequeues count elements, so a batch of n counts n times.
+	Enqueues uint64 `json:"enqueues"`
+	Dequeues uint64 `json:"dequeues"`
+
+	// EnqueueCASFailures and DequeueCASFailures count CAS attempts that
+	// lost against another goroutine and had to be retried.
+	EnqueueCASFailures uint64 `json:"enqueue_cas_failures"`
+	DequeueCASFailures uint64 `json:"dequeue_cas_failures"`
+
+	// TailHelps counts how often an operation found the tail lagging behind
+	// the last node and moved it forward on behalf of another enqueue.
+	TailHelps uint64 `json:"tail_helps"`
+
+	// Size is the size of the queue when the snapshot was taken and
+	// PeakSize the largest size seen since the queue was created.
+	Size     int `json:"size"`
+	PeakSize int `json:"peak_size"`
+}
+
+// StatsProvider is implemented by queues that report Stats.
+type StatsProvider interface {
+	Stats() Stats
+}
+
+var _ StatsProvider = (*LockFreeQueue[int])(nil)
+
+// queueStats holds the counters behind Stats. A queue without WithStats has a
+// nil *queueStats, and every method returns immediately on a nil receiver, so
+// instrumentation costs a single predictable branch when disabled.
+type queueStats struct {
+	enqueues           uint64
+	dequeues           uint64
+	enqueueCASFailures uint64
+	dequeueCASFailures uint64
+	tailHelps          uint64
+	size               int64 // enqueued minus dequeued, for tracking the peak
+	peakSize           int64
+}
+
+// enqueued records n enqueued elements.
+func (s *queueStats) enqueued(n int64) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.enqueues, uint64(n))
+	size := atomic.AddInt64(&s.size, n)
+	for {
+		peak := atomic.LoadInt64(&s.peakSize)
+		if size <= peak || atomic.CompareAndSwapInt64(&s.peakSize, peak, size) {
+			return
+		}
+	}
+}
+
+// dequeued records n dequeued elements.
+func (s *queueStats) dequeued(n int64) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.dequeues, uint64(n))
+	atomic.AddInt64(&s.size, -n)
+}
+
+func (s *queueStats) enqueueCASFailed() {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.enqueueCASFailures, 1)
+}
+
+func (s *queueStats) dequeueCASFailed() {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.dequeueCASFailures, 1)
+}
+
+func (s *queueStats) helpedTail() {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.tailHelps, 1)
+}
+
+// snapshot reads the counters into a Stats value.
+func (s *queueStats) snapshot() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	return Stats{
+		Enqueues:           atomic.LoadUint64(&s.enqueues),
+		Dequeues:           atomic.LoadUint64(&s.dequeues),
+		EnqueueCASFailures: atomic.LoadUint64(&s.enqueueCASFailures),
+		DequeueCASFailures: atomic.LoadUint64(&s.dequeueCASFailures),
+		TailHelps:          atomic.LoadUint64(&s.tailHelps),
+		PeakSize:           int(atomic.LoadInt64(&s.peakSize)),
+	}
+}
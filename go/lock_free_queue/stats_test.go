@@ -0,0 +1,90 @@
+package lockfreequeue
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStats_Disabled(t *testing.T) {
+	queue := NewLockFreeQueue[int]()
+	queue.Enqueue(1)
+	queue.Enqueue(2)
+	queue.Dequeue()
+
+	if stats := queue.Stats(); stats != (Stats{Size: 1}) {
+		t.Errorf("Queue without WithStats should only report size, got %+v", stats)
+	}
+}
+
+func TestStats_Sequential(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithStats()},
+		{WithStats(), WithNodeRecycling()},
+	} {
+		queue := NewLockFreeQueue[int](opts...)
+
+		for i := 0; i < 5; i++ {
+			queue.Enqueue(i)
+		}
+		queue.EnqueueBatch([]int{5, 6, 7})
+		queue.Dequeue()
+		queue.DequeueBatch(make([]int, 3), 3)
+		queue.Peek()
+		queue.Clear()
+
+		stats := queue.Stats()
+		if stats.Enqueues != 8 {
+			t.Errorf("Expected 8 enqueues, got %d", stats.Enqueues)
+		}
+		if stats.Dequeues != 8 {
+			t.Errorf("Expected 8 dequeues, got %d", stats.Dequeues)
+		}
+		if stats.PeakSize != 8 {
+			t.Errorf("Expected peak size 8, got %d", stats.PeakSize)
+		}
+		if stats.Size != 0 {
+			t.Errorf("Expected size 0, got %d", stats.Size)
+		}
+		if stats.EnqueueCASFailures != 0 || stats.DequeueCASFailures != 0 {
+			t.Errorf("Single goroutine should see no CAS failures, got %+v", stats)
+		}
+	}
+}
+
+func TestStats_Concurrent(t *testing.T) {
+	queue := NewLockFreeQueue[int](WithStats())
+	const numGoroutines = 8
+	const itemsPerGoroutine = 1000
+
+	var wg sync.WaitGroup
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < itemsPerGoroutine; j++ {
+				queue.Enqueue(j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < itemsPerGoroutine; j++ {
+				queue.Dequeue()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := queue.Stats()
+	total := uint64(numGoroutines * itemsPerGoroutine)
+	if stats.Enqueues != total || stats.Dequeues != total {
+		t.Errorf("Expected %d enqueues and dequeues, got %d and %d", total, stats.Enqueues, stats.Dequeues)
+	}
+	if stats.PeakSize != int(total) {
+		t.Errorf("Expected peak size %d, got %d", total, stats.PeakSize)
+	}
+}
@@ -0,0 +1,147 @@
+package lockfreequeue
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// minDequeCapacity is the initial size of the circular array of a
+// WorkStealingDeque.
+const minDequeCapacity = 32
+
+// dequeArray is the circular array behind a WorkStealingDeque. Slots hold
+// *T so that a thief reading a slot never races with the owner overwriting it
+// after the array wrapped around.
+type dequeArray[T any] struct {
+	slots []unsafe.Pointer // *T
+	mask  int64
+}
+
+func newDequeArray[T any](capacity int64) *dequeArray[T] {
+	return &dequeArray[T]{
+		slots: make([]unsafe.Pointer, capacity),
+		mask:  capacity - 1,
+	}
+}
+
+func (a *dequeArray[T]) load(i int64) *T {
+	return (*T)(atomic.LoadPointer(&a.slots[i&a.mask]))
+}
+
+func (a *dequeArray[T]) store(i int64, value *T) {
+	atomic.StorePointer(&a.slots[i&a.mask], unsafe.Pointer(value))
+}
+
+// grow returns an array twice as large holding the elements in [top, bottom).
+func (a *dequeArray[T]) grow(top, bottom int64) *dequeArray[T] {
+	grown := newDequeArray[T](2 * int64(len(a.slots)))
+	for i := top; i < bottom; i++ {
+		grown.store(i, a.load(i))
+	}
+	return grown
+}
+
+// WorkStealingDeque is a Chase-Lev work-stealing deque. A single owner
+// goroutine pushes and pops at the bottom, in LIFO order, while any number of
+// thieves steal from the top, in FIFO order. The owner only contends with
+// thieves when one element is left, so its operations are almost always plain
+// atomic loads and stores.
+//
+// The array grows when full and is never shrunk. Old arrays are left to the
+// garbage collector, which keeps them alive while a thief still reads them.
+type WorkStealingDeque[T any] struct {
+	top    int64          // atomic, next index to steal
+	bottom int64          // atomic, next index to push, owned by the owner
+	array  unsafe.Pointer // *dequeArray[T]
+}
+
+// NewWorkStealingDeque creates an empty work-stealing deque.
+func NewWorkStealingDeque[T any]() *WorkStealingDeque[T] {
+	return &WorkStealingDeque[T]{
+		array: unsafe.Pointer(newDequeArray[T](minDequeCapacity)),
+	}
+}
+
+// PushBottom adds an element at the bottom of the deque.
+// It must only be called by the owner goroutine.
+func (d *WorkStealingDeque[T]) PushBottom(value T) {
+	bottom := atomic.LoadInt64(&d.bottom)
+	top := atomic.LoadInt64(&d.top)
+	array := (*dequeArray[T])(atomic.LoadPointer(&d.array))
+
+	if bottom-top >= int64(len(array.slots)) {
+		array = array.grow(top, bottom)
+		atomic.StorePointer(&d.array, unsafe.Pointer(array))
+	}
+
+	array.store(bottom, &value)
+	atomic.StoreInt64(&d.bottom, bottom+1)
+}
+
+// PopBottom removes and returns the element at the bottom of the deque, the
+// one pushed last. It returns false if the deque is empty.
+// It must only be called by the owner goroutine.
+func (d *WorkStealingDeque[T]) PopBottom() (T, bool) {
+	var zeroValue T
+
+	// Reserve the bottom element before looking at top, so that a concurrent
+	// Steal either sees the reservation or is seen by the owner.
+	bottom := atomic.LoadInt64(&d.bottom) - 1
+	array := (*dequeArray[T])(atomic.LoadPointer(&d.array))
+	atomic.StoreInt64(&d.bottom, bottom)
+	top := atomic.LoadInt64(&d.top)
+
+	if top > bottom {
+		// Deque is empty, undo the reservation.
+		atomic.StoreInt64(&d.bottom, bottom+1)
+		return zeroValue, false
+	}
+
+	value := array.load(bottom)
+	if top == bottom {
+		// Last element, race the thieves for it.
+		won := atomic.CompareAndSwapInt64(&d.top, top, top+1)
+		atomic.StoreInt64(&d.bottom, bottom+1)
+		if !won {
+			return zeroValue, false
+		}
+	}
+	return *value, true
+}
+
+// Steal removes and returns the element at the top of the deque, the oldest
+// one. It returns false if the deque is empty or another goroutine won the
+// race for the element. It is safe to call from any goroutine.
+func (d *WorkStealingDeque[T]) Steal() (T, bool) {
+	var zeroValue T
+
+	top := atomic.LoadInt64(&d.top)
+	bottom := atomic.LoadInt64(&d.bottom)
+	if top >= bottom {
+		return zeroValue, false
+	}
+
+	array := (*dequeArray[T])(atomic.LoadPointer(&d.array))
+	value := array.load(top)
+	if !atomic.CompareAndSwapInt64(&d.top, top, top+1) {
+		// Lost the race against another thief or the owner.
+		return zeroValue, false
+	}
+	return *value, true
+}
+
+// Size returns the number of elements in the deque. Under concurrent use the
+// result is only a snapshot.
+func (d *WorkStealingDeque[T]) Size() int {
+	bottom := atomic.LoadInt64(&d.bottom)
+	top := atomic.LoadInt64(&d.top)
+	if bottom <= top {
+		return 0
+	}
+	return int(bottom - top)
+}
+
+// IsEmpty returns true if the deque is empty.
+func (d *WorkStealingDeque[T]) IsEmpty() bool {
+	return d.Size() == 0
+}
@@ -0,0 +1,139 @@
+package lockfreequeue
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWorkStealingDeque_Basic(t *testing.T) {
+	deque := NewWorkStealingDeque[int]()
+
+	if !deque.IsEmpty() {
+		t.Error("New deque should be empty")
+	}
+	if _, ok := deque.PopBottom(); ok {
+		t.Error("PopBottom on empty deque should return false")
+	}
+	if _, ok := deque.Steal(); ok {
+		t.Error("Steal on empty deque should return false")
+	}
+
+	for i := 0; i < 4; i++ {
+		deque.PushBottom(i)
+	}
+	if deque.Size() != 4 {
+		t.Errorf("Deque should have size 4, got %d", deque.Size())
+	}
+
+	// The owner pops newest first, thieves steal oldest first.
+	if val, ok := deque.PopBottom(); !ok || val != 3 {
+		t.Errorf("PopBottom: expected 3, got %d (ok=%v)", val, ok)
+	}
+	if val, ok := deque.Steal(); !ok || val != 0 {
+		t.Errorf("Steal: expected 0, got %d (ok=%v)", val, ok)
+	}
+	if val, ok := deque.PopBottom(); !ok || val != 2 {
+		t.Errorf("PopBottom: expected 2, got %d (ok=%v)", val, ok)
+	}
+	if val, ok := deque.Steal(); !ok || val != 1 {
+		t.Errorf("Steal: expected 1, got %d (ok=%v)", val, ok)
+	}
+
+	if !deque.IsEmpty() {
+		t.Errorf("Deque should be empty, size %d", deque.Size())
+	}
+	if _, ok := deque.PopBottom(); ok {
+		t.Error("PopBottom on drained deque should return false")
+	}
+}
+
+func TestWorkStealingDeque_Grow(t *testing.T) {
+	deque := NewWorkStealingDeque[int]()
+	const numItems = minDequeCapacity*8 + 3
+
+	// Move top away from zero so the copied range wraps around the array.
+	for i := 0; i < minDequeCapacity/2; i++ {
+		deque.PushBottom(-1)
+		deque.Steal()
+	}
+
+	for i := 0; i < numItems; i++ {
+		deque.PushBottom(i)
+	}
+	if deque.Size() != numItems {
+		t.Errorf("Deque should have size %d, got %d", numItems, deque.Size())
+	}
+
+	for i := 0; i < numItems/2; i++ {
+		if val, ok := deque.Steal(); !ok || val != i {
+			t.Fatalf("Steal: expected %d, got %d (ok=%v)", i, val, ok)
+		}
+	}
+	for i := numItems - 1; i >= numItems/2; i-- {
+		if val, ok := deque.PopBottom(); !ok || val != i {
+			t.Fatalf("PopBottom: expected %d, got %d (ok=%v)", i, val, ok)
+		}
+	}
+}
+
+func TestWorkStealingDeque_ConcurrentSteal(t *testing.T) {
+	deque := NewWorkStealingDeque[int]()
+	const numItems = 20000
+	const numThieves = 4
+
+	taken := make([]int32, numItems)
+	var popped int64
+	var ownerDone int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < numThieves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if val, ok := deque.Steal(); ok {
+					atomic.AddInt32(&taken[val], 1)
+					atomic.AddInt64(&popped, 1)
+					continue
+				}
+				if atomic.LoadInt32(&ownerDone) == 1 && deque.IsEmpty() {
+					return
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+
+	// The owner pushes everything and pops some of it back, racing the
+	// thieves for the last element.
+	for i := 0; i < numItems; i++ {
+		deque.PushBottom(i)
+		if i%3 == 0 {
+			if val, ok := deque.PopBottom(); ok {
+				atomic.AddInt32(&taken[val], 1)
+				atomic.AddInt64(&popped, 1)
+			}
+		}
+	}
+	for {
+		val, ok := deque.PopBottom()
+		if !ok {
+			break
+		}
+		atomic.AddInt32(&taken[val], 1)
+		atomic.AddInt64(&popped, 1)
+	}
+	atomic.StoreInt32(&ownerDone, 1)
+	wg.Wait()
+
+	if popped != numItems {
+		t.Errorf("Expected %d elements taken, got %d", numItems, popped)
+	}
+	for val, count := range taken {
+		if count != 1 {
+			t.Fatalf("Element %d taken %d times", val, count)
+		}
+	}
+}
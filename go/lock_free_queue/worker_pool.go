@@ -0,0 +1,152 @@
+package lockfreequeue
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Task is a unit of work run by a WorkerPool. It receives the worker running
+// it, which it can use to spawn subtasks.
+type Task func(w *Worker)
+
+// Worker is one goroutine of a WorkerPool together with its deque.
+type Worker struct {
+	id    int
+	pool  *WorkerPool
+	deque *WorkStealingDeque[Task]
+}
+
+// ID returns the index of the worker in its pool, from 0 to Workers()-1.
+func (w *Worker) ID() int {
+	return w.id
+}
+
+// Spawn schedules task on the worker's own deque. Subtasks run in LIFO order
+// on this worker unless idle workers steal them first, which keeps the working
+// set of recursive, fork-join style work local to one worker.
+// It must only be called from a task running on w.
+func (w *Worker) Spawn(task Task) {
+	w.pool.pending.Add(1)
+	w.deque.PushBottom(task)
+}
+
+// WorkerPool runs tasks on a fixed set of worker goroutines that balance load
+// by work stealing. Each worker has its own WorkStealingDeque; a worker first
+// runs tasks from its own deque, then tasks submitted from outside the pool,
+// and only then steals from the other workers.
+//
+// Idle workers poll for work with an exponential backoff of up to
+// maxPollInterval, like ToChan.
+type WorkerPool struct {
+	workers []*Worker
+	inject  *LockFreeQueue[Task] // tasks submitted from outside the pool
+	pending sync.WaitGroup       // tasks submitted or spawned but not yet finished
+	closed  int32                // atomic, set by Close
+	done    sync.WaitGroup       // running worker goroutines
+}
+
+// NewWorkerPool starts a pool of the given number of workers. It panics if
+// workers is not positive.
+func NewWorkerPool(workers int) *WorkerPool {
+	if workers <= 0 {
+		panic("lockfreequeue: worker pool needs at least one worker")
+	}
+
+	p := &WorkerPool{
+		workers: make([]*Worker, workers),
+		inject:  NewLockFreeQueue[Task](),
+	}
+	for i := range p.workers {
+		p.workers[i] = &Worker{
+			id:    i,
+			pool:  p,
+			deque: NewWorkStealingDeque[Task](),
+		}
+	}
+
+	p.done.Add(workers)
+	for _, w := range p.workers {
+		go w.run()
+	}
+	return p
+}
+
+// Workers returns the number of workers in the pool.
+func (p *WorkerPool) Workers() int {
+	return len(p.workers)
+}
+
+// Submit schedules task from outside the pool. Tasks already running on the
+// pool should use Worker.Spawn instead. Like sync.WaitGroup.Add, Submit must
+// not race with a Wait that may see no pending tasks.
+func (p *WorkerPool) Submit(task Task) {
+	p.pending.Add(1)
+	p.inject.Enqueue(task)
+}
+
+// Wait blocks until every submitted task, and every task they spawned, has
+// finished.
+func (p *WorkerPool) Wait() {
+	p.pending.Wait()
+}
+
+// Close stops the workers once they finish their current task and waits for
+// them to exit. Tasks that have not started yet are dropped, so call Wait
+// first to run everything that was submitted.
+func (p *WorkerPool) Close() {
+	atomic.StoreInt32(&p.closed, 1)
+	p.done.Wait()
+}
+
+// run is the scheduling loop of a worker goroutine.
+func (w *Worker) run() {
+	defer w.pool.done.Done()
+
+	backoff := minPollInterval
+	for atomic.LoadInt32(&w.pool.closed) == 0 {
+		task, ok := w.findTask()
+		if !ok {
+			// Nothing to do anywhere, wait a bit before looking again.
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxPollInterval {
+				backoff = maxPollInterval
+			}
+			continue
+		}
+
+		backoff = minPollInterval
+		task(w)
+		w.pool.pending.Done()
+	}
+}
+
+// findTask returns the next task for w: from its own deque, then from the
+// pool's submission queue, then stolen from another worker.
+func (w *Worker) findTask() (Task, bool) {
+	if task, ok := w.deque.PopBottom(); ok {
+		return task, true
+	}
+	if task, ok := w.pool.inject.Dequeue(); ok {
+		return task, true
+	}
+
+	// Start at a random victim so that thieves spread out.
+	workers := w.pool.workers
+	start := rand.IntN(len(workers))
+	for i := range workers {
+		victim := workers[(start+i)%len(workers)]
+		if victim == w {
+			continue
+		}
+		if task, ok := victim.deque.Steal(); ok {
+			return task, true
+		}
+	}
+
+	runtime.Gosched()
+	return nil, false
+}
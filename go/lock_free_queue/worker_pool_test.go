@@ -0,0 +1,102 @@
+package lockfreequeue
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestWorkerPool_Submit(t *testing.T) {
+	pool := NewWorkerPool(4)
+	defer pool.Close()
+
+	if pool.Workers() != 4 {
+		t.Errorf("Expected 4 workers, got %d", pool.Workers())
+	}
+
+	const numTasks = 1000
+	var sum int64
+	for i := 1; i <= numTasks; i++ {
+		pool.Submit(func(w *Worker) {
+			atomic.AddInt64(&sum, int64(i))
+		})
+	}
+	pool.Wait()
+
+	if expected := int64(numTasks * (numTasks + 1) / 2); sum != expected {
+		t.Errorf("Expected sum %d, got %d", expected, sum)
+	}
+}
+
+// fibTask computes Fibonacci numbers by spawning a subtask per recursive call.
+func fibTask(n int, result *int64) Task {
+	return func(w *Worker) {
+		if n < 2 {
+			atomic.AddInt64(result, int64(n))
+			return
+		}
+		w.Spawn(fibTask(n-1, result))
+		w.Spawn(fibTask(n-2, result))
+	}
+}
+
+func TestWorkerPool_Spawn(t *testing.T) {
+	pool := NewWorkerPool(4)
+	defer pool.Close()
+
+	var result int64
+	pool.Submit(fibTask(20, &result))
+	pool.Wait()
+
+	if result != 6765 {
+		t.Errorf("Expected fib(20) = 6765, got %d", result)
+	}
+}
+
+func TestWorkerPool_Stealing(t *testing.T) {
+	pool := NewWorkerPool(4)
+	defer pool.Close()
+
+	// A single submitted task spawns all the work onto one deque; the other
+	// workers can only get any of it by stealing.
+	var ran [4]int64
+	pool.Submit(func(w *Worker) {
+		for i := 0; i < 1000; i++ {
+			w.Spawn(func(w *Worker) {
+				atomic.AddInt64(&ran[w.ID()], 1)
+				for j := 0; j < 1000; j++ {
+					_ = j * j
+				}
+			})
+		}
+	})
+	pool.Wait()
+
+	var total int64
+	for _, n := range ran {
+		total += n
+	}
+	if total != 1000 {
+		t.Errorf("Expected 1000 tasks to run, got %d", total)
+	}
+}
+
+func TestWorkerPool_Close(t *testing.T) {
+	pool := NewWorkerPool(2)
+	var ran int32
+	pool.Submit(func(w *Worker) {
+		atomic.StoreInt32(&ran, 1)
+	})
+	pool.Wait()
+	pool.Close()
+
+	if atomic.LoadInt32(&ran) != 1 {
+		t.Error("Submitted task should have run before Close")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewWorkerPool should panic on zero workers")
+		}
+	}()
+	NewWorkerPool(0)
+}